@@ -0,0 +1,132 @@
+// Package bus publishes and consumes the stream messages main-service and
+// provider-service exchange, independently of the broker carrying them.
+//
+// The model is the one of Redis Streams: a stream is an append-only log of
+// messages with increasing "<ms>-<seq>" IDs. Plain readers tail a stream
+// from an ID of their choosing. Consumer groups share a stream among their
+// consumers: every message is delivered to one consumer of the group and
+// stays pending until acknowledged, and pending messages left by a consumer
+// that went away can be claimed by another one.
+//
+// NewRedis keeps messages in Redis Streams; NewMemory keeps them in the
+// process, with the same delivery semantics, for tests.
+package bus
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrNoGroup is returned when reading through a consumer group that does not
+// exist, e.g. because its stream was deleted.
+var ErrNoGroup = errors.New("consumer group does not exist")
+
+// Message is one entry of a stream.
+type Message struct {
+	Stream string
+	ID     string
+	// Values are the fields of the message. Values are published as given
+	// and read back as strings.
+	Values map[string]interface{}
+}
+
+// ReadArgs selects the messages of a plain read.
+type ReadArgs struct {
+	// Streams maps each stream to read to the ID after which to read it.
+	Streams map[string]string
+	// Count caps the messages returned per stream; zero returns them all.
+	Count int64
+	// Block is how long to wait for a message when there is none yet; zero
+	// returns at once.
+	Block time.Duration
+}
+
+// ReadGroupArgs selects the messages of a consumer group read.
+type ReadGroupArgs struct {
+	Stream   string
+	Group    string
+	Consumer string
+	// Count caps the messages returned; zero returns them all.
+	Count int64
+	// Block is how long to wait for a message when there is none yet; zero
+	// returns at once.
+	Block time.Duration
+}
+
+// ClaimArgs selects the pending messages a consumer takes over.
+type ClaimArgs struct {
+	Stream   string
+	Group    string
+	Consumer string
+	// MinIdle is how long a message must have been pending without being
+	// acknowledged before it is claimed.
+	MinIdle time.Duration
+	// Count caps the messages claimed at once; zero uses the broker's
+	// default.
+	Count int64
+}
+
+// defaultClaimCount caps a Claim without Count, like the default COUNT of
+// XAUTOCLAIM.
+const defaultClaimCount = 100
+
+// GroupInfo describes a consumer group of a stream.
+type GroupInfo struct {
+	Name string
+	// Pending is the number of messages delivered but not acknowledged.
+	Pending int64
+}
+
+// IPublisher adds messages to streams.
+//
+//go:generate mockery --name=IPublisher
+type IPublisher interface {
+	// Publish appends values to stream and returns the ID of the message.
+	// Messages older than retention are trimmed; zero keeps them all.
+	Publish(ctx context.Context, stream string, values map[string]interface{}, retention time.Duration) (string, error)
+}
+
+// ISubscriber reads messages from streams.
+//
+//go:generate mockery --name=ISubscriber
+type ISubscriber interface {
+	// Read returns the messages after the given IDs, waiting up to
+	// args.Block for one; a read that times out returns no messages and no
+	// error.
+	Read(ctx context.Context, args ReadArgs) ([]Message, error)
+	// CreateGroup creates group on stream, and stream if needed. The group
+	// receives the messages published from now on; an existing group is
+	// left as it is.
+	CreateGroup(ctx context.Context, stream, group string) error
+	// Groups lists the consumer groups of stream; a missing stream has none.
+	Groups(ctx context.Context, stream string) ([]GroupInfo, error)
+	// ReadGroup delivers the messages the group has not delivered yet to
+	// args.Consumer, waiting up to args.Block for one. They stay pending
+	// until acknowledged.
+	ReadGroup(ctx context.Context, args ReadGroupArgs) ([]Message, error)
+	// Ack acknowledges the messages of group with the given IDs.
+	Ack(ctx context.Context, stream, group string, ids ...string) error
+	// Claim hands the messages pending for longer than args.MinIdle to
+	// args.Consumer and returns them. Pending messages that were trimmed
+	// from the stream are dropped.
+	Claim(ctx context.Context, args ClaimArgs) ([]Message, error)
+}
+
+// IBus both publishes and reads messages.
+//
+//go:generate mockery --name=IBus
+type IBus interface {
+	IPublisher
+	ISubscriber
+}
+
+// MinID returns the ID of the oldest message kept by retention, or "" when
+// retention is not positive and nothing is trimmed.
+func MinID(retention time.Duration) string {
+	if retention <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(time.Now().Add(-retention).UnixMilli(), 10) + "-0"
+}
@@ -0,0 +1,235 @@
+package bus_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/bus"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBus runs the same cases against every implementation, so the
+// in-memory bus the tests use behaves like Redis.
+func TestBus(t *testing.T) {
+	implementations := map[string]func(t *testing.T) bus.IBus{
+		"memory": func(t *testing.T) bus.IBus { return bus.NewMemory() },
+		"redis":  newRedisBus,
+	}
+	cases := map[string]func(t *testing.T, b bus.IBus){
+		"group delivery":            testGroupDelivery,
+		"missing group":             testMissingGroup,
+		"claim":                     testClaim,
+		"claim past count":          testClaimPastCount,
+		"read blocks until publish": testReadBlocksUntilPublish,
+		"read without block":        testReadWithoutBlock,
+		"retention":                 testRetention,
+	}
+	for name, newBus := range implementations {
+		t.Run(name, func(t *testing.T) {
+			for c, run := range cases {
+				t.Run(c, func(t *testing.T) { run(t, newBus(t)) })
+			}
+		})
+	}
+}
+
+// newRedisBus runs against miniredis, or against the Redis server at
+// BUS_TEST_REDIS_ADDR, whose database is flushed, when it is set.
+func newRedisBus(t *testing.T) bus.IBus {
+	addr := os.Getenv("BUS_TEST_REDIS_ADDR")
+	if addr == "" {
+		addr = miniredis.RunT(t).Addr()
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { _ = rdb.Close() })
+	require.NoError(t, rdb.FlushDB(context.Background()).Err())
+	return bus.NewRedis(rdb)
+}
+
+func testGroupDelivery(t *testing.T, b bus.IBus) {
+	ctx := context.Background()
+
+	// The group only receives what is published after it was created.
+	_, err := b.Publish(ctx, "requests", map[string]interface{}{"n": 0}, 0)
+	require.NoError(t, err)
+	require.NoError(t, b.CreateGroup(ctx, "requests", "providers"))
+	require.NoError(t, b.CreateGroup(ctx, "requests", "providers"))
+
+	first, err := b.Publish(ctx, "requests", map[string]interface{}{"n": 1, "ok": true}, 0)
+	require.NoError(t, err)
+	second, err := b.Publish(ctx, "requests", map[string]interface{}{"n": 2}, 0)
+	require.NoError(t, err)
+
+	// Each message goes to one consumer of the group.
+	got, err := b.ReadGroup(ctx, bus.ReadGroupArgs{Stream: "requests", Group: "providers", Consumer: "a", Count: 1})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, first, got[0].ID)
+	assert.Equal(t, map[string]interface{}{"n": "1", "ok": "1"}, got[0].Values)
+
+	got, err = b.ReadGroup(ctx, bus.ReadGroupArgs{Stream: "requests", Group: "providers", Consumer: "b"})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, second, got[0].ID)
+
+	got, err = b.ReadGroup(ctx, bus.ReadGroupArgs{Stream: "requests", Group: "providers", Consumer: "a"})
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	groups, err := b.Groups(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, []bus.GroupInfo{{Name: "providers", Pending: 2}}, groups)
+
+	require.NoError(t, b.Ack(ctx, "requests", "providers", first, second))
+	groups, err = b.Groups(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, []bus.GroupInfo{{Name: "providers", Pending: 0}}, groups)
+}
+
+func testMissingGroup(t *testing.T, b bus.IBus) {
+	ctx := context.Background()
+
+	// Streams only exist once they have an entry or a group.
+	groups, err := b.Groups(ctx, "requests")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+
+	require.NoError(t, b.CreateGroup(ctx, "requests", "providers"))
+	_, err = b.ReadGroup(ctx, bus.ReadGroupArgs{Stream: "requests", Group: "missing", Consumer: "a"})
+	assert.ErrorIs(t, err, bus.ErrNoGroup)
+	_, err = b.Claim(ctx, bus.ClaimArgs{Stream: "requests", Group: "missing", Consumer: "a"})
+	assert.ErrorIs(t, err, bus.ErrNoGroup)
+}
+
+func testClaim(t *testing.T, b bus.IBus) {
+	ctx := context.Background()
+	require.NoError(t, b.CreateGroup(ctx, "requests", "providers"))
+
+	id, err := b.Publish(ctx, "requests", map[string]interface{}{"n": 1}, 0)
+	require.NoError(t, err)
+	_, err = b.ReadGroup(ctx, bus.ReadGroupArgs{Stream: "requests", Group: "providers", Consumer: "gone"})
+	require.NoError(t, err)
+
+	args := bus.ClaimArgs{Stream: "requests", Group: "providers", Consumer: "b", MinIdle: 50 * time.Millisecond}
+	got, err := b.Claim(ctx, args)
+	require.NoError(t, err)
+	assert.Empty(t, got, "not idle long enough")
+
+	time.Sleep(60 * time.Millisecond)
+	got, err = b.Claim(ctx, args)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, id, got[0].ID)
+
+	// Claiming resets the idle time.
+	got, err = b.Claim(ctx, args)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func testClaimPastCount(t *testing.T, b bus.IBus) {
+	ctx := context.Background()
+	require.NoError(t, b.CreateGroup(ctx, "requests", "providers"))
+
+	var ids []string
+	for n := range 25 {
+		id, err := b.Publish(ctx, "requests", map[string]interface{}{"n": n}, 0)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	_, err := b.ReadGroup(ctx, bus.ReadGroupArgs{Stream: "requests", Group: "providers", Consumer: "gone"})
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	// The first 24 are claimed again and are no longer idle: finding the
+	// last one means scanning past them.
+	args := bus.ClaimArgs{Stream: "requests", Group: "providers", Consumer: "b", MinIdle: 10 * time.Millisecond, Count: 24}
+	got, err := b.Claim(ctx, args)
+	require.NoError(t, err)
+	require.Len(t, got, 24)
+
+	args.Count = 1
+	got, err = b.Claim(ctx, args)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, ids[24], got[0].ID)
+}
+
+func testReadBlocksUntilPublish(t *testing.T, b bus.IBus) {
+	ctx := context.Background()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = b.Publish(ctx, "results", map[string]interface{}{"search_id": "s1"}, 0)
+	}()
+
+	got, err := b.Read(ctx, bus.ReadArgs{
+		Streams: map[string]string{"results": "0-0", "cancelled": "0-0"},
+		Block:   time.Second,
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "results", got[0].Stream)
+
+	// Nothing after the last ID: the read times out empty.
+	got, err = b.Read(ctx, bus.ReadArgs{
+		Streams: map[string]string{"results": got[0].ID},
+		Block:   10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = b.Read(cancelled, bus.ReadArgs{Streams: map[string]string{"results": "0-0"}, Block: time.Second})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func testReadWithoutBlock(t *testing.T, b bus.IBus) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, b.CreateGroup(ctx, "requests", "providers"))
+
+	// A zero Block returns at once instead of waiting for a message.
+	start := time.Now()
+	got, err := b.Read(ctx, bus.ReadArgs{Streams: map[string]string{"requests": "$"}})
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	got, err = b.ReadGroup(ctx, bus.ReadGroupArgs{Stream: "requests", Group: "providers", Consumer: "a"})
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func testRetention(t *testing.T, b bus.IBus) {
+	ctx := context.Background()
+	require.NoError(t, b.CreateGroup(ctx, "requests", "providers"))
+
+	_, err := b.Publish(ctx, "requests", map[string]interface{}{"n": 1}, 0)
+	require.NoError(t, err)
+	_, err = b.ReadGroup(ctx, bus.ReadGroupArgs{Stream: "requests", Group: "providers", Consumer: "gone"})
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	last, err := b.Publish(ctx, "requests", map[string]interface{}{"n": 2}, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	got, err := b.Read(ctx, bus.ReadArgs{Streams: map[string]string{"requests": "0-0"}})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, last, got[0].ID)
+
+	// The pending entry of the trimmed message is dropped rather than
+	// claimed.
+	got, err = b.Claim(ctx, bus.ClaimArgs{Stream: "requests", Group: "providers", Consumer: "b"})
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	groups, err := b.Groups(ctx, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), groups[0].Pending)
+}
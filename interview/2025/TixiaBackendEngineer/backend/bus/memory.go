@@ -0,0 +1,345 @@
+package bus
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a bus keeping its streams in the process. It delivers messages
+// like Redis Streams do, so services can run against it in tests: IDs
+// increase, group reads deliver a message once per group and keep it
+// pending until acknowledged, and values are read back as strings.
+type Memory struct {
+	mu      sync.Mutex
+	streams map[string]*memStream
+	// published is closed and replaced on every publish, waking the reads
+	// blocked for new messages.
+	published chan struct{}
+}
+
+type memStream struct {
+	messages []Message
+	last     streamID
+	groups   map[string]*memGroup
+}
+
+type memGroup struct {
+	delivered streamID
+	pending   map[string]*memPending
+}
+
+type memPending struct {
+	consumer    string
+	deliveredAt time.Time
+}
+
+var _ IBus = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		streams:   make(map[string]*memStream),
+		published: make(chan struct{}),
+	}
+}
+
+func (m *Memory) Publish(ctx context.Context, stream string, values map[string]interface{}, retention time.Duration) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stream(stream)
+	id := streamID{ms: uint64(time.Now().UnixMilli())}
+	if !s.last.less(id) {
+		id = streamID{ms: s.last.ms, seq: s.last.seq + 1}
+	}
+	s.last = id
+
+	copied := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		copied[k] = memValue(v)
+	}
+	s.messages = append(s.messages, Message{Stream: stream, ID: id.String(), Values: copied})
+	if minID := MinID(retention); minID != "" {
+		s.trim(parseStreamID(minID))
+	}
+
+	close(m.published)
+	m.published = make(chan struct{})
+	return id.String(), nil
+}
+
+func (m *Memory) Read(ctx context.Context, args ReadArgs) ([]Message, error) {
+	return m.wait(ctx, args.Block, func() ([]Message, error) {
+		names := make([]string, 0, len(args.Streams))
+		for stream := range args.Streams {
+			names = append(names, stream)
+		}
+		sort.Strings(names)
+
+		var messages []Message
+		for _, stream := range names {
+			s, ok := m.streams[stream]
+			if !ok {
+				continue
+			}
+			messages = append(messages, s.after(parseStreamID(args.Streams[stream]), args.Count)...)
+		}
+		return messages, nil
+	})
+}
+
+func (m *Memory) CreateGroup(ctx context.Context, stream, group string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stream(stream)
+	if _, ok := s.groups[group]; !ok {
+		s.groups[group] = &memGroup{
+			delivered: s.last,
+			pending:   make(map[string]*memPending),
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Groups(ctx context.Context, stream string) ([]GroupInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.streams[stream]
+	if !ok {
+		return nil, nil
+	}
+	infos := make([]GroupInfo, 0, len(s.groups))
+	for name, g := range s.groups {
+		infos = append(infos, GroupInfo{Name: name, Pending: int64(len(g.pending))})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+func (m *Memory) ReadGroup(ctx context.Context, args ReadGroupArgs) ([]Message, error) {
+	return m.wait(ctx, args.Block, func() ([]Message, error) {
+		g, err := m.group(args.Stream, args.Group)
+		if err != nil {
+			return nil, err
+		}
+		messages := m.streams[args.Stream].after(g.delivered, args.Count)
+		now := time.Now()
+		for _, msg := range messages {
+			g.pending[msg.ID] = &memPending{consumer: args.Consumer, deliveredAt: now}
+			g.delivered = parseStreamID(msg.ID)
+		}
+		return messages, nil
+	})
+}
+
+func (m *Memory) Ack(ctx context.Context, stream, group string, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, err := m.group(stream, group)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(g.pending, id)
+	}
+	return nil
+}
+
+func (m *Memory) Claim(ctx context.Context, args ClaimArgs) ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, err := m.group(args.Stream, args.Group)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return parseStreamID(ids[i]).less(parseStreamID(ids[j])) })
+
+	count := int(args.Count)
+	if count <= 0 {
+		count = defaultClaimCount
+	}
+	s := m.streams[args.Stream]
+	now := time.Now()
+	var messages []Message
+	for _, id := range ids {
+		if len(messages) == count {
+			break
+		}
+		p := g.pending[id]
+		if now.Sub(p.deliveredAt) < args.MinIdle {
+			continue
+		}
+		msg, ok := s.get(id)
+		if !ok {
+			delete(g.pending, id)
+			continue
+		}
+		p.consumer = args.Consumer
+		p.deliveredAt = now
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// wait calls fetch, with m.mu held, until it returns messages or an error,
+// block has passed or ctx is done.
+func (m *Memory) wait(ctx context.Context, block time.Duration, fetch func() ([]Message, error)) ([]Message, error) {
+	var timeout <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		messages, err := fetch()
+		published := m.published
+		m.mu.Unlock()
+		if err != nil || len(messages) > 0 || block <= 0 {
+			return messages, err
+		}
+
+		select {
+		case <-published:
+		case <-timeout:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// stream returns stream, creating it if needed. The caller must hold m.mu.
+func (m *Memory) stream(name string) *memStream {
+	s, ok := m.streams[name]
+	if !ok {
+		s = &memStream{groups: make(map[string]*memGroup)}
+		m.streams[name] = s
+	}
+	return s
+}
+
+// group returns group of stream. The caller must hold m.mu.
+func (m *Memory) group(stream, group string) (*memGroup, error) {
+	if s, ok := m.streams[stream]; ok {
+		if g, ok := s.groups[group]; ok {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s on %s", ErrNoGroup, group, stream)
+}
+
+// after returns copies of up to count messages following id; a count of
+// zero returns them all.
+func (s *memStream) after(id streamID, count int64) []Message {
+	i := sort.Search(len(s.messages), func(i int) bool {
+		return id.less(parseStreamID(s.messages[i].ID))
+	})
+	var messages []Message
+	for ; i < len(s.messages); i++ {
+		if count > 0 && int64(len(messages)) == count {
+			break
+		}
+		messages = append(messages, s.messages[i].copy())
+	}
+	return messages
+}
+
+func (s *memStream) get(id string) (Message, bool) {
+	want := parseStreamID(id)
+	i := sort.Search(len(s.messages), func(i int) bool {
+		return !parseStreamID(s.messages[i].ID).less(want)
+	})
+	if i < len(s.messages) && s.messages[i].ID == id {
+		return s.messages[i].copy(), true
+	}
+	return Message{}, false
+}
+
+// trim drops the messages before minID. Their pending entries stay, as in
+// Redis, until claimed.
+func (s *memStream) trim(minID streamID) {
+	i := sort.Search(len(s.messages), func(i int) bool {
+		return !parseStreamID(s.messages[i].ID).less(minID)
+	})
+	s.messages = append([]Message(nil), s.messages[i:]...)
+}
+
+func (msg Message) copy() Message {
+	values := make(map[string]interface{}, len(msg.Values))
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	msg.Values = values
+	return msg
+}
+
+// memValue formats v the way go-redis sends it, so values read back are
+// the strings Redis would return.
+func memValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case encoding.BinaryMarshaler:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// streamID is a "<ms>-<seq>" message ID.
+type streamID struct {
+	ms, seq uint64
+}
+
+// parseStreamID reads id; an empty or invalid ID is the lowest one.
+func parseStreamID(id string) streamID {
+	ms, seq, _ := strings.Cut(id, "-")
+	m, _ := strconv.ParseUint(ms, 10, 64)
+	s, _ := strconv.ParseUint(seq, 10, 64)
+	return streamID{ms: m, seq: s}
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
@@ -0,0 +1,165 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type redisBus struct {
+	rdb *redis.Client
+}
+
+// NewRedis creates a bus keeping its streams in Redis Streams. The caller
+// owns rdb and closes it.
+func NewRedis(rdb *redis.Client) IBus {
+	return &redisBus{rdb: rdb}
+}
+
+func (b *redisBus) Publish(ctx context.Context, stream string, values map[string]interface{}, retention time.Duration) (string, error) {
+	return b.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MinID:  MinID(retention),
+		Approx: true,
+		Values: values,
+	}).Result()
+}
+
+func (b *redisBus) Read(ctx context.Context, args ReadArgs) ([]Message, error) {
+	names := make([]string, 0, len(args.Streams))
+	for stream := range args.Streams {
+		names = append(names, stream)
+	}
+	sort.Strings(names)
+	streams := append(make([]string, 0, 2*len(names)), names...)
+	for _, stream := range names {
+		streams = append(streams, args.Streams[stream])
+	}
+
+	res, err := b.rdb.XRead(ctx, &redis.XReadArgs{
+		Streams: streams,
+		Count:   args.Count,
+		Block:   redisBlock(args.Block),
+	}).Result()
+	if err != nil {
+		return nil, readError(err)
+	}
+	var messages []Message
+	for _, s := range res {
+		messages = appendMessages(messages, s.Stream, s.Messages)
+	}
+	return messages, nil
+}
+
+func (b *redisBus) CreateGroup(ctx context.Context, stream, group string) error {
+	err := b.rdb.XGroupCreateMkStream(ctx, stream, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+func (b *redisBus) Groups(ctx context.Context, stream string) ([]GroupInfo, error) {
+	groups, err := b.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		// Streams are only created by their first entry or group.
+		if strings.Contains(err.Error(), "no such key") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	infos := make([]GroupInfo, len(groups))
+	for i, g := range groups {
+		infos[i] = GroupInfo{Name: g.Name, Pending: g.Pending}
+	}
+	return infos, nil
+}
+
+func (b *redisBus) ReadGroup(ctx context.Context, args ReadGroupArgs) ([]Message, error) {
+	res, err := b.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    args.Group,
+		Consumer: args.Consumer,
+		Streams:  []string{args.Stream, ">"},
+		Count:    args.Count,
+		Block:    redisBlock(args.Block),
+	}).Result()
+	if err != nil {
+		return nil, readError(err)
+	}
+	var messages []Message
+	for _, s := range res {
+		messages = appendMessages(messages, s.Stream, s.Messages)
+	}
+	return messages, nil
+}
+
+func (b *redisBus) Ack(ctx context.Context, stream, group string, ids ...string) error {
+	return b.rdb.XAck(ctx, stream, group, ids...).Err()
+}
+
+// Claim follows the cursor of XAUTOCLAIM through the whole pending list,
+// since a single call only scans part of it.
+func (b *redisBus) Claim(ctx context.Context, args ClaimArgs) ([]Message, error) {
+	count := args.Count
+	if count <= 0 {
+		count = defaultClaimCount
+	}
+	var messages []Message
+	start := "0-0"
+	for {
+		res, next, err := b.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   args.Stream,
+			Group:    args.Group,
+			Consumer: args.Consumer,
+			MinIdle:  args.MinIdle,
+			Start:    start,
+			Count:    count - int64(len(messages)),
+		}).Result()
+		if err != nil {
+			return nil, readError(err)
+		}
+		messages = appendMessages(messages, args.Stream, res)
+		if next == "0-0" || int64(len(messages)) >= count {
+			return messages, nil
+		}
+		start = next
+	}
+}
+
+// redisBlock converts a Block of the bus, where zero does not wait, into
+// the one of go-redis, where zero waits forever.
+func redisBlock(block time.Duration) time.Duration {
+	if block <= 0 {
+		return -1
+	}
+	return block
+}
+
+// readError hides the nil reply of a read that timed out and tells missing
+// groups apart.
+func readError(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if strings.HasPrefix(err.Error(), "NOGROUP") {
+		return fmt.Errorf("%w: %s", ErrNoGroup, err)
+	}
+	return err
+}
+
+// appendMessages appends the messages of stream; Redis 6 reports claimed
+// messages that were trimmed meanwhile without values, and they are skipped.
+func appendMessages(messages []Message, stream string, xms []redis.XMessage) []Message {
+	for _, m := range xms {
+		if m.Values == nil {
+			continue
+		}
+		messages = append(messages, Message{Stream: stream, ID: m.ID, Values: m.Values})
+	}
+	return messages
+}
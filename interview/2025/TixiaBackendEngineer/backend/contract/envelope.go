@@ -0,0 +1,199 @@
+// Package contract defines the messages main-service and provider-service
+// exchange over Redis Streams and how they are encoded as stream values.
+//
+// SchemaV2 messages carry an envelope of stream fields (schema_version,
+// type, produced_at and producer) and their content as JSON in payload.
+// SchemaV1 messages predate the envelope and have no schema_version field:
+// requests and cancellations are flat fields and results are JSON in data.
+// SchemaV3 keeps the SchemaV2 envelope and lets search legs list the
+// airports of city codes, which older consumers would ignore. Consumers
+// read every supported version, so a producer keeps publishing the lowest
+// version all of its consumers understand.
+package contract
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Schema versions of the stream messages.
+const (
+	SchemaV1      = 1
+	SchemaV2      = 2
+	SchemaV3      = 3
+	CurrentSchema = SchemaV3
+)
+
+// Message types, set in the envelope from SchemaV2 on.
+const (
+	TypeSearchRequested = "flight.search.requested"
+	TypeSearchResult    = "flight.search.result"
+	TypeSearchCancelled = "flight.search.cancelled"
+)
+
+const (
+	fieldSchemaVersion = "schema_version"
+	fieldType          = "type"
+	fieldProducedAt    = "produced_at"
+	fieldProducer      = "producer"
+	fieldPayload       = "payload"
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+	ErrInvalidMessage     = errors.New("invalid message")
+)
+
+// Meta describes a decoded message. ProducedAt and Producer are only known
+// from SchemaV2 on.
+type Meta struct {
+	SchemaVersion int
+	Type          string
+	ProducedAt    time.Time
+	Producer      string
+}
+
+type message interface {
+	Validate() error
+}
+
+// versioned is implemented by messages whose content older versions cannot
+// carry.
+type versioned interface {
+	minVersion() int
+}
+
+// Encoder turns messages into stream values of one schema version.
+type Encoder struct {
+	// Version defaults to CurrentSchema.
+	Version int
+	// Producer names the publishing service instance.
+	Producer string
+}
+
+func (e Encoder) version() int {
+	if e.Version == 0 {
+		return CurrentSchema
+	}
+	return e.Version
+}
+
+func (e Encoder) SearchRequested(m SearchRequested) (map[string]interface{}, error) {
+	return encode(e, TypeSearchRequested, m, encodeSearchRequestedV1)
+}
+
+func (e Encoder) SearchResult(m SearchResult) (map[string]interface{}, error) {
+	return encode(e, TypeSearchResult, m, encodeSearchResultV1)
+}
+
+func (e Encoder) SearchCancelled(m SearchCancelled) (map[string]interface{}, error) {
+	return encode(e, TypeSearchCancelled, m, encodeSearchCancelledV1)
+}
+
+// DecodeSearchRequested reads a search request of any supported version.
+// On an invalid message the fields that could be read are still returned.
+func DecodeSearchRequested(values map[string]interface{}) (SearchRequested, Meta, error) {
+	return decode(values, TypeSearchRequested, decodeSearchRequestedV1)
+}
+
+// DecodeSearchResult reads a search result of any supported version.
+func DecodeSearchResult(values map[string]interface{}) (SearchResult, Meta, error) {
+	return decode(values, TypeSearchResult, decodeSearchResultV1)
+}
+
+// DecodeSearchCancelled reads a cancellation of any supported version.
+func DecodeSearchCancelled(values map[string]interface{}) (SearchCancelled, Meta, error) {
+	return decode(values, TypeSearchCancelled, decodeSearchCancelledV1)
+}
+
+func encode[M message](e Encoder, typ string, m M, v1 func(M) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidMessage, typ, err)
+	}
+	if v, ok := any(m).(versioned); ok && e.version() < v.minVersion() {
+		return nil, fmt.Errorf("%w: %s needs version %d, encoder publishes %d", ErrUnsupportedVersion, typ, v.minVersion(), e.version())
+	}
+
+	switch e.version() {
+	case SchemaV1:
+		return v1(m)
+	case SchemaV2, SchemaV3:
+		payload, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", typ, err)
+		}
+		return map[string]interface{}{
+			fieldSchemaVersion: e.version(),
+			fieldType:          typ,
+			fieldProducedAt:    time.Now().UTC().Format(time.RFC3339Nano),
+			fieldProducer:      e.Producer,
+			fieldPayload:       string(payload),
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, e.version())
+}
+
+func decode[M message](values map[string]interface{}, typ string, v1 func(map[string]interface{}) (M, error)) (M, Meta, error) {
+	var m M
+	meta, err := readMeta(values, typ)
+	if err != nil {
+		return m, meta, err
+	}
+
+	switch meta.SchemaVersion {
+	case SchemaV1:
+		m, err = v1(values)
+	case SchemaV2, SchemaV3:
+		err = json.Unmarshal([]byte(stringValue(values[fieldPayload])), &m)
+	default:
+		return m, meta, fmt.Errorf("%w: %d", ErrUnsupportedVersion, meta.SchemaVersion)
+	}
+	if err == nil {
+		err = m.Validate()
+	}
+	if err != nil {
+		return m, meta, fmt.Errorf("%w: %s: %w", ErrInvalidMessage, typ, err)
+	}
+	return m, meta, nil
+}
+
+// readMeta reads the envelope fields; values without schema_version are
+// SchemaV1 messages of the type the stream carries.
+func readMeta(values map[string]interface{}, typ string) (Meta, error) {
+	meta := Meta{SchemaVersion: SchemaV1, Type: typ}
+	raw, ok := values[fieldSchemaVersion]
+	if !ok {
+		return meta, nil
+	}
+
+	version, err := strconv.Atoi(stringValue(raw))
+	if err != nil {
+		return meta, fmt.Errorf("%w: schema_version %q", ErrInvalidMessage, stringValue(raw))
+	}
+	meta.SchemaVersion = version
+	meta.Type = stringValue(values[fieldType])
+	meta.Producer = stringValue(values[fieldProducer])
+	if at, err := time.Parse(time.RFC3339Nano, stringValue(values[fieldProducedAt])); err == nil {
+		meta.ProducedAt = at
+	}
+	if meta.Type != typ {
+		return meta, fmt.Errorf("%w: type %q, want %q", ErrInvalidMessage, meta.Type, typ)
+	}
+	return meta, nil
+}
+
+// stringValue returns a stream value as text. Values read from Redis are
+// strings; values built in-process may not be.
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
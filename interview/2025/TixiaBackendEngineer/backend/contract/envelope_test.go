@@ -0,0 +1,155 @@
+package contract
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fromRedis turns encoded values into what XREAD returns: strings only.
+func fromRedis(values map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		out[k] = fmt.Sprint(v)
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	req := SearchRequested{
+		SearchID: "s1",
+		TripType: TripRoundTrip,
+		Legs: []SearchLeg{
+			{From: "CGK", To: "DPS", Date: "2025-08-15"},
+			{From: "DPS", To: "CGK", Date: "2025-08-20"},
+		},
+		Passengers: 2,
+		CabinClass: CabinBusiness,
+	}
+	res := SearchResult{
+		SearchID:   "s1",
+		ProviderID: "garuda",
+		Status:     StatusCompleted,
+		TripType:   TripOneWay,
+		Results:    []Flight{{ID: "GA-1", From: "CGK", To: "DPS", Price: 1000, Seats: SeatInventory{Economy: 3}}},
+	}
+	cancelled := SearchCancelled{SearchID: "s1"}
+
+	for _, version := range []int{SchemaV1, SchemaV2, SchemaV3} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			enc := Encoder{Version: version, Producer: "test"}
+
+			values, err := enc.SearchRequested(req)
+			require.NoError(t, err)
+			gotReq, meta, err := DecodeSearchRequested(fromRedis(values))
+			require.NoError(t, err)
+			assert.Equal(t, req, gotReq)
+			assert.Equal(t, version, meta.SchemaVersion)
+			assert.Equal(t, TypeSearchRequested, meta.Type)
+
+			values, err = enc.SearchResult(res)
+			require.NoError(t, err)
+			gotRes, _, err := DecodeSearchResult(fromRedis(values))
+			require.NoError(t, err)
+			assert.Equal(t, res, gotRes)
+
+			values, err = enc.SearchCancelled(cancelled)
+			require.NoError(t, err)
+			gotCancelled, meta, err := DecodeSearchCancelled(fromRedis(values))
+			require.NoError(t, err)
+			assert.Equal(t, cancelled, gotCancelled)
+
+			if version >= SchemaV2 {
+				assert.Equal(t, "test", meta.Producer)
+				assert.WithinDuration(t, time.Now(), meta.ProducedAt, time.Minute)
+			}
+		})
+	}
+}
+
+func TestCityAirportsNeedSchemaV3(t *testing.T) {
+	req := SearchRequested{
+		SearchID: "s1",
+		TripType: TripRoundTrip,
+		Legs: []SearchLeg{
+			{From: "JKT", To: "DPS", Date: "2025-08-15", FromAirports: []string{"CGK", "HLP"}},
+			{From: "DPS", To: "JKT", Date: "2025-08-20", ToAirports: []string{"CGK", "HLP"}},
+		},
+		Passengers: 1,
+		CabinClass: CabinEconomy,
+	}
+
+	for _, version := range []int{SchemaV1, SchemaV2} {
+		_, err := Encoder{Version: version}.SearchRequested(req)
+		assert.ErrorIs(t, err, ErrUnsupportedVersion, "v%d", version)
+	}
+
+	values, err := Encoder{Version: SchemaV3}.SearchRequested(req)
+	require.NoError(t, err)
+	got, meta, err := DecodeSearchRequested(fromRedis(values))
+	require.NoError(t, err)
+	assert.Equal(t, req, got)
+	assert.Equal(t, SchemaV3, meta.SchemaVersion)
+}
+
+func TestDecodeSearchRequestedV1Defaults(t *testing.T) {
+	req, meta, err := DecodeSearchRequested(map[string]interface{}{
+		"search_id": "s1",
+		"from":      "CGK",
+		"to":        "DPS",
+		"date":      "2025-08-15",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, SchemaV1, meta.SchemaVersion)
+	assert.Equal(t, SearchRequested{
+		SearchID:   "s1",
+		TripType:   TripOneWay,
+		Legs:       []SearchLeg{{From: "CGK", To: "DPS", Date: "2025-08-15"}},
+		Passengers: 1,
+		CabinClass: CabinEconomy,
+	}, req)
+}
+
+func TestDecodeRejectsInvalidMessages(t *testing.T) {
+	envelope := func(version, typ, payload string) map[string]interface{} {
+		return map[string]interface{}{
+			"schema_version": version,
+			"type":           typ,
+			"produced_at":    time.Now().Format(time.RFC3339Nano),
+			"producer":       "test",
+			"payload":        payload,
+		}
+	}
+
+	t.Run("newer version", func(t *testing.T) {
+		_, _, err := DecodeSearchResult(envelope("4", TypeSearchResult, `{}`))
+		assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	})
+	t.Run("wrong type", func(t *testing.T) {
+		_, _, err := DecodeSearchResult(envelope("2", TypeSearchCancelled, `{"search_id":"s1"}`))
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+	})
+	t.Run("malformed payload", func(t *testing.T) {
+		_, _, err := DecodeSearchCancelled(envelope("2", TypeSearchCancelled, `{`))
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+	})
+	t.Run("invalid content keeps what was read", func(t *testing.T) {
+		req, _, err := DecodeSearchRequested(map[string]interface{}{
+			"search_id":   "s1",
+			"from":        "CGK",
+			"to":          "DPS",
+			"date":        "2025-08-15",
+			"cabin_class": "premium",
+		})
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+		assert.ErrorContains(t, err, `invalid cabin_class "premium"`)
+		assert.Equal(t, "s1", req.SearchID)
+	})
+	t.Run("encoder validates", func(t *testing.T) {
+		_, err := Encoder{}.SearchResult(SearchResult{SearchID: "s1", Status: "done"})
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+	})
+}
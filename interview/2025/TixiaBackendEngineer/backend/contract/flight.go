@@ -0,0 +1,210 @@
+package contract
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Default stream names.
+const (
+	StreamSearchRequested = "flight.search.requested"
+	StreamSearchResults   = "flight.search.results"
+	StreamSearchCancelled = "flight.search.cancelled"
+)
+
+const (
+	CabinEconomy  = "economy"
+	CabinBusiness = "business"
+	CabinFirst    = "first"
+)
+
+const (
+	TripOneWay    = "one_way"
+	TripRoundTrip = "round_trip"
+	TripMultiCity = "multi_city"
+
+	MaxSearchLegs = 5
+)
+
+// Statuses of a provider's search result.
+const (
+	StatusCompleted = "completed"
+	StatusNotFound  = "not_found"
+	StatusFailed    = "failed"
+)
+
+// DefaultProviderID is assumed for results that carry no provider ID.
+const DefaultProviderID = "default"
+
+// SeatInventory holds the number of seats left per cabin class.
+type SeatInventory struct {
+	Economy  int `json:"economy"`
+	Business int `json:"business"`
+	First    int `json:"first"`
+}
+
+// Available returns the seats left in cabin, or 0 for an unknown cabin.
+func (s SeatInventory) Available(cabin string) int {
+	switch cabin {
+	case CabinEconomy:
+		return s.Economy
+	case CabinBusiness:
+		return s.Business
+	case CabinFirst:
+		return s.First
+	}
+	return 0
+}
+
+type Flight struct {
+	ID            string        `json:"id"`
+	Airline       string        `json:"airline"`
+	FlightNumber  string        `json:"flight_number"`
+	From          string        `json:"from"`
+	To            string        `json:"to"`
+	DepartureTime string        `json:"departure_time"`
+	ArrivalTime   string        `json:"arrival_time"`
+	Price         float64       `json:"price"`
+	Currency      string        `json:"currency"`
+	Available     bool          `json:"available"`
+	Seats         SeatInventory `json:"seats"`
+	// Set by the provider on search results: Price is the total for all
+	// passengers.
+	CabinClass        string  `json:"cabin_class,omitempty"`
+	Passengers        int     `json:"passengers,omitempty"`
+	PricePerPassenger float64 `json:"price_per_passenger,omitempty"`
+}
+
+// SearchLeg is one origin/destination/date segment of a trip.
+type SearchLeg struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Date string `json:"date"`
+	// FromAirports and ToAirports list the airports of From and To when
+	// they are city codes, such as CGK and HLP for JKT. They need SchemaV3.
+	FromAirports []string `json:"from_airports,omitempty"`
+	ToAirports   []string `json:"to_airports,omitempty"`
+}
+
+// Origins returns the codes a flight of the leg may depart from: From and
+// the airports it stands for.
+func (l SearchLeg) Origins() []string {
+	return append([]string{l.From}, l.FromAirports...)
+}
+
+// Destinations returns the codes a flight of the leg may arrive at: To and
+// the airports it stands for.
+func (l SearchLeg) Destinations() []string {
+	return append([]string{l.To}, l.ToAirports...)
+}
+
+// LegResult groups the flights matching one leg of the request.
+type LegResult struct {
+	Leg     int      `json:"leg"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Date    string   `json:"date"`
+	Flights []Flight `json:"flights"`
+}
+
+// Itinerary is one flight per leg with the combined price for all
+// passengers.
+type Itinerary struct {
+	FlightIDs  []string `json:"flight_ids"`
+	TotalPrice float64  `json:"total_price"`
+	Currency   string   `json:"currency"`
+}
+
+// SearchRequested asks the providers for the flights of every leg.
+type SearchRequested struct {
+	SearchID   string      `json:"search_id"`
+	TripType   string      `json:"trip_type"`
+	Legs       []SearchLeg `json:"legs"`
+	Passengers int         `json:"passengers"`
+	CabinClass string      `json:"cabin_class"`
+}
+
+// Validate checks the request a provider is asked to answer.
+func (m SearchRequested) Validate() error {
+	var errs []error
+	if m.SearchID == "" {
+		errs = append(errs, errors.New("missing search_id"))
+	}
+	switch m.TripType {
+	case TripOneWay, TripRoundTrip, TripMultiCity:
+	default:
+		errs = append(errs, fmt.Errorf("invalid trip_type %q", m.TripType))
+	}
+	if len(m.Legs) == 0 || len(m.Legs) > MaxSearchLegs {
+		errs = append(errs, fmt.Errorf("invalid number of legs: %d", len(m.Legs)))
+	}
+	for i, leg := range m.Legs {
+		if leg.From == "" || leg.To == "" || leg.Date == "" {
+			errs = append(errs, fmt.Errorf("incomplete leg %d", i))
+		}
+	}
+	if m.Passengers < 1 {
+		errs = append(errs, fmt.Errorf("invalid passengers %d", m.Passengers))
+	}
+	switch m.CabinClass {
+	case CabinEconomy, CabinBusiness, CabinFirst:
+	default:
+		errs = append(errs, fmt.Errorf("invalid cabin_class %q", m.CabinClass))
+	}
+	return errors.Join(errs...)
+}
+
+// minVersion is SchemaV3 when a leg lists the airports of a city code;
+// consumers of earlier versions would only match the city code itself.
+func (m SearchRequested) minVersion() int {
+	for _, leg := range m.Legs {
+		if len(leg.FromAirports) > 0 || len(leg.ToAirports) > 0 {
+			return SchemaV3
+		}
+	}
+	return SchemaV1
+}
+
+// SearchResult is one provider's answer to a search. Results holds the
+// flights of every leg; Legs groups them per leg and Itineraries combines
+// them for round-trip and multi-city searches.
+type SearchResult struct {
+	SearchID    string      `json:"search_id"`
+	ProviderID  string      `json:"provider_id"`
+	Status      string      `json:"status"`
+	TripType    string      `json:"trip_type,omitempty"`
+	Results     []Flight    `json:"results"`
+	Legs        []LegResult `json:"legs,omitempty"`
+	Itineraries []Itinerary `json:"itineraries,omitempty"`
+}
+
+// Validate checks the result main-service is about to record.
+func (m SearchResult) Validate() error {
+	var errs []error
+	if m.SearchID == "" {
+		errs = append(errs, errors.New("missing search_id"))
+	}
+	if m.ProviderID == "" {
+		errs = append(errs, errors.New("missing provider_id"))
+	}
+	switch m.Status {
+	case StatusCompleted, StatusNotFound, StatusFailed:
+	default:
+		errs = append(errs, fmt.Errorf("invalid status %q", m.Status))
+	}
+	return errors.Join(errs...)
+}
+
+// SearchCancelled tells the providers and every main-service process that a
+// search was cancelled.
+type SearchCancelled struct {
+	SearchID string `json:"search_id"`
+}
+
+// Validate checks the cancellation names a search.
+func (m SearchCancelled) Validate() error {
+	if m.SearchID == "" {
+		return errors.New("missing search_id")
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package contract
+
+import (
+	"container/heap"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxItineraries caps the combinations returned per search.
+	maxItineraries = 20
+	// maxItineraryExpansions bounds the work spent looking for valid
+	// combinations when many of the cheapest ones do not connect.
+	maxItineraryExpansions = 2000
+)
+
+var flightTimeLayouts = []string{"2006-01-02 15:04", "2006-01-02T15:04", time.RFC3339}
+
+// BuildItineraries returns the cheapest combinations of one flight per leg
+// in which every flight departs after the previous one arrives and all are
+// priced in the same currency, cheapest first. It explores combinations
+// best-first so that only the few needed are ever built.
+func BuildItineraries(legs [][]Flight) []Itinerary {
+	if len(legs) == 0 {
+		return nil
+	}
+
+	sorted := make([][]Flight, len(legs))
+	for i, flights := range legs {
+		if len(flights) == 0 {
+			return nil
+		}
+		sorted[i] = append([]Flight(nil), flights...)
+		sort.SliceStable(sorted[i], func(a, b int) bool {
+			return sorted[i][a].Price < sorted[i][b].Price
+		})
+	}
+
+	cost := func(idx []int) float64 {
+		var total float64
+		for leg, i := range idx {
+			total += sorted[leg][i].Price
+		}
+		return total
+	}
+
+	start := make([]int, len(sorted))
+	queue := &combinationQueue{{idx: start, cost: cost(start)}}
+	seen := map[string]bool{combinationKey(start): true}
+
+	var itineraries []Itinerary
+	for expansions := 0; queue.Len() > 0 && len(itineraries) < maxItineraries && expansions < maxItineraryExpansions; expansions++ {
+		c := heap.Pop(queue).(combination)
+
+		if connects(sorted, c.idx) {
+			itinerary := Itinerary{
+				TotalPrice: c.cost,
+				Currency:   sorted[0][c.idx[0]].Currency,
+			}
+			for leg, i := range c.idx {
+				itinerary.FlightIDs = append(itinerary.FlightIDs, sorted[leg][i].ID)
+			}
+			itineraries = append(itineraries, itinerary)
+		}
+
+		for leg := range c.idx {
+			if c.idx[leg]+1 >= len(sorted[leg]) {
+				continue
+			}
+			next := append([]int(nil), c.idx...)
+			next[leg]++
+			key := combinationKey(next)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			heap.Push(queue, combination{idx: next, cost: cost(next)})
+		}
+	}
+
+	return itineraries
+}
+
+// connects reports whether each flight of the combination departs after the
+// previous one arrives, in the currency of the first one. Times that cannot
+// be parsed are not checked.
+func connects(legs [][]Flight, idx []int) bool {
+	for leg := 1; leg < len(idx); leg++ {
+		if legs[leg][idx[leg]].Currency != legs[0][idx[0]].Currency {
+			return false
+		}
+		arrival, ok := ParseFlightTime(legs[leg-1][idx[leg-1]].ArrivalTime)
+		if !ok {
+			continue
+		}
+		departure, ok := ParseFlightTime(legs[leg][idx[leg]].DepartureTime)
+		if !ok {
+			continue
+		}
+		if !departure.After(arrival) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseFlightTime parses the departure or arrival time of a flight in any
+// of the layouts providers use.
+func ParseFlightTime(v string) (time.Time, bool) {
+	for _, layout := range flightTimeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func combinationKey(idx []int) string {
+	parts := make([]string, len(idx))
+	for i, v := range idx {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+type combination struct {
+	idx  []int
+	cost float64
+}
+
+type combinationQueue []combination
+
+func (q combinationQueue) Len() int            { return len(q) }
+func (q combinationQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q combinationQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *combinationQueue) Push(x interface{}) { *q = append(*q, x.(combination)) }
+func (q *combinationQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
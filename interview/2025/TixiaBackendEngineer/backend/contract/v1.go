@@ -0,0 +1,116 @@
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// SchemaV1 requests mirror their first leg in from, to and date for
+// consumers that only understand one-way trips, and leave out the fields
+// older producers did not know, which then get their defaults.
+
+func encodeSearchRequestedV1(m SearchRequested) (map[string]interface{}, error) {
+	legs, err := json.Marshal(m.Legs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal search legs: %w", err)
+	}
+	first := m.Legs[0]
+	return map[string]interface{}{
+		"search_id":   m.SearchID,
+		"trip_type":   m.TripType,
+		"from":        first.From,
+		"to":          first.To,
+		"date":        first.Date,
+		"legs":        string(legs),
+		"passengers":  m.Passengers,
+		"cabin_class": m.CabinClass,
+	}, nil
+}
+
+func decodeSearchRequestedV1(values map[string]interface{}) (SearchRequested, error) {
+	m := SearchRequested{
+		SearchID:   stringValue(values["search_id"]),
+		TripType:   stringValue(values["trip_type"]),
+		Passengers: 1,
+		CabinClass: CabinEconomy,
+	}
+	if m.TripType == "" {
+		m.TripType = TripOneWay
+	}
+
+	if v := jsonValue(values["legs"]); v != "" && v != "null" {
+		if err := json.Unmarshal([]byte(v), &m.Legs); err != nil {
+			return m, fmt.Errorf("invalid legs: %w", err)
+		}
+	}
+	if len(m.Legs) == 0 {
+		m.Legs = []SearchLeg{{
+			From: stringValue(values["from"]),
+			To:   stringValue(values["to"]),
+			Date: stringValue(values["date"]),
+		}}
+	}
+
+	if v := stringValue(values["passengers"]); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return m, fmt.Errorf("invalid passengers %q", v)
+		}
+		m.Passengers = n
+	}
+	if v := stringValue(values["cabin_class"]); v != "" {
+		m.CabinClass = v
+	}
+	return m, nil
+}
+
+func encodeSearchResultV1(m SearchResult) (map[string]interface{}, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal search result: %w", err)
+	}
+	return map[string]interface{}{"data": string(data)}, nil
+}
+
+// decodeSearchResultV1 assumes DefaultProviderID for results of providers
+// that predate multiple providers.
+func decodeSearchResultV1(values map[string]interface{}) (SearchResult, error) {
+	var m SearchResult
+	raw, ok := values["data"].(string)
+	if !ok {
+		return m, fmt.Errorf("missing data")
+	}
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return m, err
+	}
+	if m.ProviderID == "" {
+		m.ProviderID = DefaultProviderID
+	}
+	return m, nil
+}
+
+func encodeSearchCancelledV1(m SearchCancelled) (map[string]interface{}, error) {
+	return map[string]interface{}{"search_id": m.SearchID}, nil
+}
+
+func decodeSearchCancelledV1(values map[string]interface{}) (SearchCancelled, error) {
+	return SearchCancelled{SearchID: stringValue(values["search_id"])}, nil
+}
+
+// jsonValue returns v as JSON text. Values read from Redis already are
+// strings; values built in-process are encoded.
+func jsonValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+}
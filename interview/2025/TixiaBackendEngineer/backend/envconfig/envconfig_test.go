@@ -0,0 +1,44 @@
+package envconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	type redis struct {
+		Addr string `env:"REDIS_ADDR"`
+	}
+	var cfg struct {
+		Redis     redis
+		Timeout   time.Duration `env:"TIMEOUT"`
+		Prefork   bool          `env:"PREFORK"`
+		Retries   int           `env:"RETRIES"`
+		Ratio     float64       `env:"RATIO"`
+		Providers []string      `env:"PROVIDERS"`
+		Untagged  string
+	}
+	cfg.Untagged = "kept"
+
+	t.Setenv("TEST_REDIS_ADDR", "redis:6379")
+	t.Setenv("TEST_TIMEOUT", "2s")
+	t.Setenv("TEST_PREFORK", "true")
+	t.Setenv("TEST_RETRIES", "3")
+	t.Setenv("TEST_RATIO", "0.5")
+	t.Setenv("TEST_PROVIDERS", "garuda, lion,")
+	require.NoError(t, Apply(&cfg, "TEST_"))
+
+	assert.Equal(t, "redis:6379", cfg.Redis.Addr)
+	assert.Equal(t, 2*time.Second, cfg.Timeout)
+	assert.True(t, cfg.Prefork)
+	assert.Equal(t, 3, cfg.Retries)
+	assert.Equal(t, 0.5, cfg.Ratio)
+	assert.Equal(t, []string{"garuda", "lion"}, cfg.Providers)
+	assert.Equal(t, "kept", cfg.Untagged)
+
+	t.Setenv("TEST_RETRIES", "many")
+	assert.EqualError(t, Apply(&cfg, "TEST_"), `invalid TEST_RETRIES: strconv.Atoi: parsing "many": invalid syntax`)
+}
@@ -1,29 +1,31 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"example.com/main-service/internal/handler"
-	"example.com/main-service/internal/repository"
-	"example.com/main-service/internal/usecase"
+	"example.com/bus"
+	"example.com/main-service/internal/config"
+	"example.com/main-service/internal/metrics"
+	"example.com/main-service/internal/prefork"
+	"example.com/main-service/service"
+	"example.com/telemetry"
 	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
-var (
-	serviceName  = "main-service"
-	serviceLevel string
-	servicePort  string
-)
+// preforkDrainMargin is the time the prefork master grants its children on
+// top of the shutdown timeout to stop their workers and flush their traces.
+const preforkDrainMargin = 5 * time.Second
 
 func main() {
-	flag.StringVar(&serviceLevel, "serviceLevel", "development", "Service level: development or production")
-	flag.StringVar(&servicePort, "servicePort", "8080", "Port to run the service on")
+	configFile := flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG_FILE"), "Path of the YAML config file; settings are overridden by "+config.EnvPrefix+"* environment variables")
 	flag.Parse()
 
 	baseLogger, err := zap.NewProduction()
@@ -32,49 +34,92 @@ func main() {
 	}
 	defer baseLogger.Sync()
 
-	logger := baseLogger.With(zap.String("service", serviceName))
+	logger := baseLogger.With(zap.String("service", service.Name))
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		logger.Fatal("Failed to load config", zap.String("file", *configFile), zap.Error(err))
+	}
+	if !fiber.IsChild() {
+		logger.Info("Loaded config", zap.String("file", *configFile), zap.Any("config", cfg.Redacted()))
+	}
 
-	redisAddr := "localhost:6379"
-	if serviceLevel == "production" {
-		redisAddr = "redis:6379"
+	shutdownTracing, err := telemetry.Setup(context.Background(), telemetry.Config{
+		ServiceName:  service.Name,
+		Exporter:     cfg.Telemetry.TraceExporter,
+		FilePath:     cfg.Telemetry.TraceFile,
+		OTLPEndpoint: cfg.Telemetry.OTLPEndpoint,
+		SampleRatio:  cfg.Telemetry.TraceSampleRatio,
+	})
+	if err != nil {
+		logger.Fatal("Failed to set up tracing", zap.Error(err))
 	}
 
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: "",
-		DB:       0,
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	})
 	defer rdb.Close()
 
-	app := fiber.New(fiber.Config{
-		Prefork:       true,
-		CaseSensitive: true,
-		StrictRouting: true,
-		ServerHeader:  "Fiber",
-		AppName:       serviceName,
-	})
+	srv := service.New(cfg, rdb, bus.NewRedis(rdb), logger)
 
-	flightRepo := repository.NewFlightRepository(rdb, logger)
-	flightUc := usecase.NewFlightUseCase(flightRepo, logger)
-	flightHandler := handler.NewFlightHandler(flightUc, logger)
+	// The prefork master serves no connections; on shutdown it hands the
+	// signal over to the children it forked.
+	var master *prefork.Master
+	if cfg.Service.Prefork && !fiber.IsChild() {
+		master = prefork.NewMaster(logger)
+		srv.App.Hooks().OnFork(master.OnFork)
+	}
 
-	apiV1 := app.Group("api/v1")
-	apiV1.Post("/flights/search", flightHandler.SearchFlights)
-	apiV1.Get("/flights/search/:search_id/stream", flightHandler.StreamFlightResults)
+	srv.Start()
+	// The pending counts are the same from every process; with prefork
+	// only the master reports them.
+	if !fiber.IsChild() {
+		prometheus.MustRegister(metrics.NewStreamPendingCollector(rdb, cfg.StreamNames().All(), logger))
+	}
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		addr := ":" + servicePort
-		logger.Info("Starting server", zap.String("port", servicePort))
-		if err := app.Listen(addr); err != nil {
+		addr := ":" + cfg.Service.Port
+		logger.Info("Starting server", zap.String("port", cfg.Service.Port))
+		if err := srv.App.Listen(addr); err != nil {
 			logger.Error("Fiber server stopped", zap.Error(err))
 		}
 	}()
 
 	sig := <-sigCh
 	logger.Info("Received shutdown signal", zap.String("signal", sig.String()))
-	time.Sleep(2 * time.Second)
+
+	if master != nil {
+		masterCtx, stop := context.WithTimeout(context.Background(), cfg.Service.DrainDelay+cfg.Service.ShutdownTimeout+preforkDrainMargin)
+		if err := master.Shutdown(masterCtx, syscall.SIGTERM); err != nil {
+			logger.Warn("Prefork children did not drain in time", zap.Error(err))
+		}
+		stop()
+	} else {
+		shutdownCtx, stop := context.WithTimeout(context.Background(), cfg.Service.DrainDelay+cfg.Service.ShutdownTimeout)
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("Server did not shut down cleanly", zap.Error(err))
+		}
+		stop()
+	}
+
+	srv.Stop()
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Error("Failed to flush traces", zap.Error(err))
+	}
 	logger.Info("Shutdown complete")
+
+	if fiber.IsChild() {
+		// Exiting now would make the master kill the children still
+		// draining; it exits once all of them are done, and this one with it.
+		if err := prefork.MarkDrained(); err != nil {
+			logger.Error("Failed to report drain to prefork master", zap.Error(err))
+			return
+		}
+		prefork.AwaitMaster()
+	}
 }
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"example.com/contract"
+	"example.com/envconfig"
+	"example.com/main-service/internal/domain"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables overriding the config file,
+// e.g. MAIN_REDIS_ADDR for redis.addr.
+const EnvPrefix = "MAIN_"
+
+const redacted = "[REDACTED]"
+
+// Config holds every setting of main-service. Settings come from Default,
+// overridden by the config file and then by the environment.
+type Config struct {
+	Service   ServiceConfig   `yaml:"service"`
+	Redis     RedisConfig     `yaml:"redis"`
+	Streams   StreamsConfig   `yaml:"streams"`
+	Search    SearchConfig    `yaml:"search"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Telemetry TelemetryConfig `yaml:"telemetry"`
+}
+
+type ServiceConfig struct {
+	Port string `yaml:"port" env:"PORT" validate:"required,numeric"`
+	// Prefork runs one process per CPU. Each keeps its own metrics, and
+	// /metrics serves those of all of them, labelled with their pid.
+	Prefork bool `yaml:"prefork" env:"PREFORK"`
+	// SSEHeartbeat is the interval of SSE heartbeat comments and WebSocket
+	// pings on idle connections.
+	SSEHeartbeat time.Duration `yaml:"sse_heartbeat" env:"SSE_HEARTBEAT" validate:"gt=0"`
+	// ProgressTimeout is how long the result hub may go without completing
+	// a read before /readyz fails.
+	ProgressTimeout time.Duration `yaml:"progress_timeout" env:"PROGRESS_TIMEOUT" validate:"gt=0"`
+	// DrainDelay is how long /readyz fails before the streams are drained,
+	// so the load balancer stops sending new clients first.
+	DrainDelay time.Duration `yaml:"drain_delay" env:"DRAIN_DELAY" validate:"gte=0"`
+	// ShutdownTimeout bounds the wait for open streams and requests once
+	// they are drained.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" validate:"gt=0"`
+	// ReconnectDelay is the retry hint sent to streaming clients on
+	// shutdown.
+	ReconnectDelay time.Duration `yaml:"reconnect_delay" env:"RECONNECT_DELAY" validate:"gt=0"`
+	// TrustedProxies are the addresses and CIDR ranges of the load
+	// balancers in front of the service. Requests through them are rate
+	// limited by the client address they add to ProxyHeader.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" validate:"dive,ip|cidr"`
+	ProxyHeader    string   `yaml:"proxy_header" env:"PROXY_HEADER" validate:"required"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr" env:"REDIS_ADDR" validate:"required,hostname_port"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env:"REDIS_DB" validate:"gte=0"`
+}
+
+// StreamsConfig names the streams and sets how long their entries are kept.
+// Entries are kept for at least Retention (trimming is approximate, so a
+// little longer) and are trimmed on every XADD and by the janitor. Requests
+// a provider has not acknowledged within IdleTimeout are dropped. Both must
+// exceed the search deadline, after which a search is expired anyway; zero
+// keeps everything. SchemaVersion is the version of the published messages;
+// every supported version is read. It defaults to the current envelope
+// version; lower it only while providers that cannot read it are still
+// running during a rolling upgrade. City codes such as JKT are only
+// searched from SchemaV3 on and are rejected before.
+type StreamsConfig struct {
+	Requested       string        `yaml:"requested" env:"STREAM_REQUESTED" validate:"required"`
+	Results         string        `yaml:"results" env:"STREAM_RESULTS" validate:"required"`
+	Cancelled       string        `yaml:"cancelled" env:"STREAM_CANCELLED" validate:"required"`
+	Retention       time.Duration `yaml:"retention" env:"STREAM_RETENTION" validate:"gte=0"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"STREAM_IDLE_TIMEOUT" validate:"gte=0"`
+	JanitorInterval time.Duration `yaml:"janitor_interval" env:"STREAM_JANITOR_INTERVAL" validate:"gte=0"`
+	SchemaVersion   int           `yaml:"schema_version" env:"STREAM_SCHEMA_VERSION" validate:"oneof=1 2 3"`
+}
+
+type SearchConfig struct {
+	Deadline         time.Duration `yaml:"deadline" env:"SEARCH_DEADLINE" validate:"gt=0"`
+	ProviderDeadline time.Duration `yaml:"provider_deadline" env:"PROVIDER_DEADLINE" validate:"gt=0"`
+	Providers        []string      `yaml:"providers" env:"PROVIDERS" validate:"required,min=1,unique,dive,required"`
+	AbandonGrace     time.Duration `yaml:"abandon_grace" env:"ABANDON_GRACE" validate:"gte=0"`
+	CacheTTL         time.Duration `yaml:"cache_ttl" env:"CACHE_TTL" validate:"gte=0"`
+	IdempotencyTTL   time.Duration `yaml:"idempotency_ttl" env:"IDEMPOTENCY_TTL" validate:"gt=0"`
+}
+
+type AuthConfig struct {
+	RequireAPIKey   bool          `yaml:"require_api_key" env:"REQUIRE_API_KEY"`
+	RateLimitWindow time.Duration `yaml:"rate_limit_window" env:"RATE_LIMIT_WINDOW" validate:"gt=0"`
+	IPRateLimit     int           `yaml:"ip_rate_limit" env:"IP_RATE_LIMIT" validate:"gte=0"`
+}
+
+type TelemetryConfig struct {
+	TraceExporter    string  `yaml:"trace_exporter" env:"TRACE_EXPORTER" validate:"oneof=none stdout file otlp"`
+	TraceFile        string  `yaml:"trace_file" env:"TRACE_FILE" validate:"required_if=TraceExporter file"`
+	OTLPEndpoint     string  `yaml:"otlp_endpoint" env:"OTLP_ENDPOINT" validate:"required_if=TraceExporter otlp"`
+	TraceSampleRatio float64 `yaml:"trace_sample_ratio" env:"TRACE_SAMPLE_RATIO" validate:"gte=0,lte=1"`
+}
+
+// Default returns the settings used for everything the config file and the
+// environment leave out.
+func Default() Config {
+	return Config{
+		Service: ServiceConfig{
+			Port:            "8080",
+			Prefork:         true,
+			SSEHeartbeat:    15 * time.Second,
+			ProgressTimeout: 30 * time.Second,
+			DrainDelay:      5 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+			ReconnectDelay:  time.Second,
+			ProxyHeader:     fiber.HeaderXForwardedFor,
+		},
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		Streams: StreamsConfig{
+			Requested:       domain.StreamFlightSearchRequested,
+			Results:         domain.StreamFlightSearchResults,
+			Cancelled:       domain.StreamFlightSearchCancelled,
+			Retention:       time.Hour,
+			IdleTimeout:     10 * time.Minute,
+			JanitorInterval: time.Minute,
+			SchemaVersion:   contract.CurrentSchema,
+		},
+		Search: SearchConfig{
+			Deadline:         30 * time.Second,
+			ProviderDeadline: 10 * time.Second,
+			Providers:        []string{domain.DefaultProviderID},
+			AbandonGrace:     10 * time.Second,
+			CacheTTL:         time.Minute,
+			IdempotencyTTL:   30 * time.Minute,
+		},
+		Auth: AuthConfig{
+			RequireAPIKey:   true,
+			RateLimitWindow: time.Minute,
+			IPRateLimit:     300,
+		},
+		Telemetry: TelemetryConfig{
+			TraceExporter:    "none",
+			TraceFile:        "traces.json",
+			OTLPEndpoint:     "localhost:4318",
+			TraceSampleRatio: 1,
+		},
+	}
+}
+
+// Load reads the config file at path, when path is not empty, applies the
+// environment overrides and validates the result.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := envconfig.Apply(&cfg, EnvPrefix); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks every setting and the constraints between them.
+func (c *Config) Validate() error {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.Split(f.Tag.Get("yaml"), ",")[0]
+	})
+	if err := v.Struct(c); err != nil {
+		var verrs validator.ValidationErrors
+		if !errors.As(err, &verrs) {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		msgs := make([]string, len(verrs))
+		for i, fe := range verrs {
+			field := strings.TrimPrefix(fe.Namespace(), "Config.")
+			msgs[i] = fmt.Sprintf("%s fails %s", field, fe.Tag())
+		}
+		return fmt.Errorf("invalid config: %s", strings.Join(msgs, "; "))
+	}
+
+	var errs []string
+	if c.Search.ProviderDeadline > c.Search.Deadline {
+		errs = append(errs, "search.provider_deadline must not exceed search.deadline")
+	}
+	if c.Streams.Retention > 0 && c.Streams.Retention <= c.Search.Deadline {
+		errs = append(errs, "streams.retention must exceed search.deadline")
+	}
+	if c.Streams.IdleTimeout > 0 && c.Streams.IdleTimeout <= c.Search.Deadline {
+		errs = append(errs, "streams.idle_timeout must exceed search.deadline")
+	}
+	// A retry replays the search its key started, which must still be
+	// stored.
+	if c.Search.IdempotencyTTL > domain.SearchStateTTL {
+		errs = append(errs, fmt.Sprintf("search.idempotency_ttl must not exceed %s, how long searches are kept", domain.SearchStateTTL))
+	}
+	streams := c.StreamNames()
+	if streams.Requested == streams.Results || streams.Requested == streams.Cancelled || streams.Results == streams.Cancelled {
+		errs = append(errs, "streams must have distinct names")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// StreamNames returns the configured stream names.
+func (c *Config) StreamNames() domain.Streams {
+	return domain.Streams{
+		Requested: c.Streams.Requested,
+		Results:   c.Streams.Results,
+		Cancelled: c.Streams.Cancelled,
+	}
+}
+
+// Redacted returns the settings as a map fit for logging, with secrets
+// masked.
+func (c *Config) Redacted() map[string]interface{} {
+	cp := *c
+	if cp.Redis.Password != "" {
+		cp.Redis.Password = redacted
+	}
+
+	// A YAML round trip keeps the file's field names and prints durations
+	// as "30s" rather than nanoseconds.
+	var out map[string]interface{}
+	data, err := yaml.Marshal(cp)
+	if err == nil {
+		err = yaml.Unmarshal(data, &out)
+	}
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/contract"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+redis:
+  addr: redis:6379
+  password: secret
+search:
+  deadline: 45s
+  providers: [garuda, lion]
+`)
+	t.Setenv("MAIN_REDIS_DB", "2")
+	t.Setenv("MAIN_PROVIDERS", "garuda, citilink")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "redis:6379", cfg.Redis.Addr)
+	assert.Equal(t, 2, cfg.Redis.DB)
+	assert.Equal(t, 45*time.Second, cfg.Search.Deadline)
+	// The environment wins over the file, which wins over the defaults.
+	assert.Equal(t, []string{"garuda", "citilink"}, cfg.Search.Providers)
+	assert.Equal(t, "8080", cfg.Service.Port)
+
+	logged := cfg.Redacted()
+	assert.Equal(t, redacted, logged["redis"].(map[string]interface{})["password"])
+	assert.Equal(t, "45s", logged["search"].(map[string]interface{})["deadline"])
+	assert.Equal(t, "secret", cfg.Redis.Password)
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "unknown key",
+			content: "redis:\n  adress: redis:6379\n",
+			wantErr: "field adress not found",
+		},
+		{
+			name:    "bad env value",
+			env:     map[string]string{"MAIN_SEARCH_DEADLINE": "soon"},
+			wantErr: "invalid MAIN_SEARCH_DEADLINE",
+		},
+		{
+			name:    "field rule",
+			content: "telemetry:\n  trace_exporter: jaeger\n",
+			wantErr: "telemetry.trace_exporter fails oneof",
+		},
+		{
+			name:    "cross-field rule",
+			content: "search:\n  deadline: 5s\n",
+			wantErr: "search.provider_deadline must not exceed search.deadline",
+		},
+		{
+			name:    "idempotency outliving searches",
+			env:     map[string]string{"MAIN_IDEMPOTENCY_TTL": "1h"},
+			wantErr: "search.idempotency_ttl must not exceed 30m0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load(writeConfig(t, tt.content))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestDefaultPublishesEnvelope(t *testing.T) {
+	shipped, err := Load("../../config.yaml")
+	require.NoError(t, err)
+
+	for name, cfg := range map[string]Config{"default": Default(), "config.yaml": *shipped} {
+		values, err := contract.Encoder{Version: cfg.Streams.SchemaVersion}.SearchCancelled(contract.SearchCancelled{SearchID: "s1"})
+		require.NoError(t, err, name)
+		assert.Equal(t, contract.CurrentSchema, values["schema_version"], name)
+		assert.Equal(t, contract.TypeSearchCancelled, values["type"], name)
+	}
+}
@@ -0,0 +1,73 @@
+package domain
+
+import "time"
+
+// ActiveSearch is a search still waiting for provider results, as listed
+// by the admin API.
+type ActiveSearch struct {
+	SearchID  string          `json:"search_id"`
+	Status    string          `json:"status"`
+	Legs      []SearchLeg     `json:"legs"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	AgeMs     int64           `json:"age_ms"`
+	Providers []ProviderState `json:"providers"`
+	// Watchers is the number of clients following the search, by transport.
+	Watchers map[string]int64 `json:"watchers"`
+}
+
+// SearchSubscriptions counts the clients following a search, across all
+// processes.
+type SearchSubscriptions struct {
+	SearchID string `json:"search_id"`
+	Total    int64  `json:"total"`
+	// ByTransport splits Total by transport: sse or websocket.
+	ByTransport map[string]int64 `json:"by_transport"`
+}
+
+// StreamHealth summarises a stream and its consumer groups from XINFO
+// STREAM, XINFO GROUPS and XPENDING.
+type StreamHealth struct {
+	Stream string `json:"stream"`
+	// Exists is false until the first entry or group creates the stream.
+	Exists          bool   `json:"exists"`
+	Length          int64  `json:"length"`
+	EntriesAdded    int64  `json:"entries_added"`
+	LastGeneratedID string `json:"last_generated_id"`
+	FirstEntryID    string `json:"first_entry_id"`
+	LastEntryID     string `json:"last_entry_id"`
+	// LastEntryAgeMs is how long ago the last entry was added.
+	LastEntryAgeMs int64               `json:"last_entry_age_ms"`
+	Groups         []StreamGroupHealth `json:"groups"`
+}
+
+// StreamGroupHealth is the progress of one consumer group on a stream.
+type StreamGroupHealth struct {
+	Name            string `json:"name"`
+	Consumers       int64  `json:"consumers"`
+	LastDeliveredID string `json:"last_delivered_id"`
+	EntriesRead     int64  `json:"entries_read"`
+	// Lag is the number of entries not delivered to the group yet; nil when
+	// Redis cannot tell, as before Redis 7 or after entries were deleted.
+	Lag     *int64         `json:"lag"`
+	Pending PendingSummary `json:"pending"`
+}
+
+// PendingSummary describes the entries delivered to a group and not
+// acknowledged yet.
+type PendingSummary struct {
+	Count      int64            `json:"count"`
+	LowestID   string           `json:"lowest_id,omitempty"`
+	HighestID  string           `json:"highest_id,omitempty"`
+	ByConsumer map[string]int64 `json:"by_consumer"`
+	// Oldest are the first pending entries, the likeliest to be stuck.
+	Oldest []PendingEntry `json:"oldest"`
+}
+
+// PendingEntry is an entry delivered to a consumer and not acknowledged.
+type PendingEntry struct {
+	ID         string `json:"id"`
+	Consumer   string `json:"consumer"`
+	IdleMs     int64  `json:"idle_ms"`
+	Deliveries int64  `json:"deliveries"`
+}
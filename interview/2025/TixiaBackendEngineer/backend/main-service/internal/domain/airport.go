@@ -0,0 +1,43 @@
+package domain
+
+// Kinds of places offered by the airport autocomplete.
+const (
+	PlaceAirport = "airport"
+	PlaceCity    = "city"
+)
+
+// Airport is an airport of the reference data.
+type Airport struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	City string `json:"city"`
+	// CityCode is the code of the metropolitan area the airport belongs
+	// to, when it has one, such as JKT for CGK.
+	CityCode string `json:"city_code,omitempty"`
+	Country  string `json:"country"`
+	Timezone string `json:"timezone"`
+}
+
+// City is a metropolitan area with a code of its own that stands for all
+// of its airports.
+type City struct {
+	Code     string   `json:"code"`
+	Name     string   `json:"name"`
+	Country  string   `json:"country"`
+	Timezone string   `json:"timezone"`
+	Airports []string `json:"airports"`
+}
+
+// Place is an airport or a city a search may depart from or arrive at.
+type Place struct {
+	Type     string `json:"type"`
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	City     string `json:"city"`
+	Country  string `json:"country"`
+	Timezone string `json:"timezone"`
+	// CityCode is the city of an airport that belongs to one.
+	CityCode string `json:"city_code,omitempty"`
+	// Airports lists the airports of a city.
+	Airports []string `json:"airports,omitempty"`
+}
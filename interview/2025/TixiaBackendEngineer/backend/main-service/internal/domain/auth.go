@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// Plans an API key can be on. Each plan has its own request rate.
+const (
+	PlanFree     = "free"
+	PlanStandard = "standard"
+	PlanPremium  = "premium"
+)
+
+// DefaultPlanLimits is the number of requests per rate limit window allowed
+// for each plan.
+var DefaultPlanLimits = map[string]int{
+	PlanFree:     30,
+	PlanStandard: 120,
+	PlanPremium:  600,
+}
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a client allowed to call the API.
+type APIKey struct {
+	Name string `json:"name"`
+	Plan string `json:"plan"`
+	// Disabled keys are kept for reference but rejected.
+	Disabled bool `json:"disabled"`
+	// Admin keys may also call the admin API.
+	Admin bool `json:"admin"`
+}
+
+// RateLimitResult is the outcome of counting one request against a limit.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until a request is allowed again; zero when
+	// Allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the oldest request counted leaves the
+	// window and frees a slot.
+	ResetAfter time.Duration
+}
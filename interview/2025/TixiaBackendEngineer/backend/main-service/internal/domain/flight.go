@@ -1,39 +1,322 @@
 package domain
 
+import (
+	"errors"
+	"time"
+
+	"example.com/contract"
+)
+
 const (
-	StreamFlightSearchRequested = "flight.search.requested"
-	StreamFlightSearchResults   = "flight.search.results"
+	StreamFlightSearchRequested = contract.StreamSearchRequested
+	StreamFlightSearchResults   = contract.StreamSearchResults
+	StreamFlightSearchCancelled = contract.StreamSearchCancelled
 )
 
-type Flight struct {
-	ID            string  `json:"id"`
-	Airline       string  `json:"airline"`
-	FlightNumber  string  `json:"flight_number"`
-	From          string  `json:"from"`
-	To            string  `json:"to"`
-	DepartureTime string  `json:"departure_time"`
-	ArrivalTime   string  `json:"arrival_time"`
-	Price         float64 `json:"price"`
-	Currency      string  `json:"currency"`
-	Available     bool    `json:"available"`
-}
+const (
+	SearchStatusProcessing = "processing"
+	SearchStatusPartial    = "partial"
+	SearchStatusCompleted  = contract.StatusCompleted
+	SearchStatusNotFound   = contract.StatusNotFound
+	SearchStatusFailed     = contract.StatusFailed
+	SearchStatusExpired    = "expired"
+	SearchStatusCancelled  = "cancelled"
+
+	// ProviderStatusPending and ProviderStatusTimeout describe providers
+	// that have not answered, before and after the provider deadline.
+	ProviderStatusPending = "pending"
+	ProviderStatusTimeout = "timeout"
+
+	// DefaultProviderID is assumed for results that carry no provider ID.
+	DefaultProviderID = contract.DefaultProviderID
+)
+
+const (
+	CabinEconomy  = contract.CabinEconomy
+	CabinBusiness = contract.CabinBusiness
+	CabinFirst    = contract.CabinFirst
+)
+
+const (
+	TripOneWay    = contract.TripOneWay
+	TripRoundTrip = contract.TripRoundTrip
+	TripMultiCity = contract.TripMultiCity
+
+	MaxSearchLegs = contract.MaxSearchLegs
+
+	// SchemaCityAirports is the first schema version whose search legs can
+	// list the airports of a city code.
+	SchemaCityAirports = contract.SchemaV3
 
+	// SearchStateTTL bounds how long a search can be polled after its last
+	// update.
+	SearchStateTTL = 30 * time.Minute
+)
+
+var (
+	ErrSearchNotFound = errors.New("search not found")
+	ErrInvalidSearch  = errors.New("invalid search")
+	ErrSearchFinished = errors.New("search already finished")
+	ErrCacheMiss      = errors.New("cache miss")
+	// ErrIdempotencyConflict is returned when an idempotency key is reused
+	// with a different request.
+	ErrIdempotencyConflict = errors.New("idempotency key reused with a different request")
+)
+
+// The flights exchanged with the providers are defined by the shared
+// contract.
+type (
+	Flight        = contract.Flight
+	SeatInventory = contract.SeatInventory
+	SearchLeg     = contract.SearchLeg
+	LegResult     = contract.LegResult
+	Itinerary     = contract.Itinerary
+)
+
+// FlightSearchRequest is a search as main-service stores it. Message
+// converts it to what is published to the providers; From, To and Date
+// mirror the first leg.
 type FlightSearchRequest struct {
-	SearchID string `json:"search_id"`
-	From     string `json:"from"`
-	To       string `json:"to"`
-	Date     string `json:"date"`
+	SearchID   string      `json:"search_id"`
+	TripType   string      `json:"trip_type"`
+	From       string      `json:"from"`
+	To         string      `json:"to"`
+	Date       string      `json:"date"`
+	Legs       []SearchLeg `json:"legs"`
+	Passengers int         `json:"passengers"`
+	CabinClass string      `json:"cabin_class"`
+	// Filters and sort options are applied by main-service and are not
+	// published to the provider.
+	Filters   *SearchFilters `json:"filters,omitempty"`
+	SortBy    string         `json:"sort_by,omitempty"`
+	SortOrder string         `json:"sort_order,omitempty"`
+}
+
+// Message returns the request as published to the providers.
+func (r FlightSearchRequest) Message() contract.SearchRequested {
+	return contract.SearchRequested{
+		SearchID:   r.SearchID,
+		TripType:   r.TripType,
+		Legs:       r.Legs,
+		Passengers: r.Passengers,
+		CabinClass: r.CabinClass,
+	}
+}
+
+const (
+	SortByPrice         = "price"
+	SortByDepartureTime = "departure_time"
+	SortByDuration      = "duration"
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// TimeWindow is a time-of-day range in HH:MM. A window whose From is later
+// than its To wraps around midnight.
+type TimeWindow struct {
+	From string `json:"from" validate:"required,datetime=15:04"`
+	To   string `json:"to" validate:"required,datetime=15:04"`
 }
 
+// SearchFilters narrows the flights streamed to the client. MaxPrice bounds
+// the price per passenger.
+type SearchFilters struct {
+	MaxPrice        float64     `json:"max_price,omitempty" validate:"omitempty,gt=0"`
+	Airlines        []string    `json:"airlines,omitempty" validate:"omitempty,dive,required"`
+	DepartureWindow *TimeWindow `json:"departure_window,omitempty"`
+	ArrivalWindow   *TimeWindow `json:"arrival_window,omitempty"`
+}
+
+// FlightSearchResult is a search result as delivered to clients, starting
+// from a provider's contract.SearchResult. Results holds the flights of
+// every leg; Legs groups them per leg and Itineraries combines them for
+// round-trip and multi-city searches.
+//
+// main-service re-emits a provider's result with Status "partial" and the
+// provider's own status in ProviderStatus, then a final result aggregating
+// all providers with the ones that failed or timed out in FailedProviders.
 type FlightSearchResult struct {
-	SearchID string   `json:"search_id"`
-	Status   string   `json:"status"`
-	Results  []Flight `json:"results"`
+	SearchID        string      `json:"search_id"`
+	Status          string      `json:"status"`
+	ProviderID      string      `json:"provider_id,omitempty"`
+	ProviderStatus  string      `json:"provider_status,omitempty"`
+	FailedProviders []string    `json:"failed_providers,omitempty"`
+	TripType        string      `json:"trip_type,omitempty"`
+	Results         []Flight    `json:"results"`
+	Legs            []LegResult `json:"legs,omitempty"`
+	Itineraries     []Itinerary `json:"itineraries,omitempty"`
+	// EventID is the results stream entry ID the result was read from.
+	EventID string `json:"-"`
+	// TraceParent is the W3C trace context the result was received under,
+	// for the spans delivering it to link to.
+	TraceParent string `json:"-"`
+}
+
+// NewFlightSearchResult returns the result a provider published. Providers
+// number their flights independently, so flight IDs are prefixed with the
+// provider ID to keep them apart, as in garuda:ga-1.
+func NewFlightSearchResult(m contract.SearchResult) FlightSearchResult {
+	res := FlightSearchResult{
+		SearchID:   m.SearchID,
+		Status:     m.Status,
+		ProviderID: m.ProviderID,
+		TripType:   m.TripType,
+		Results:    providerFlights(m.ProviderID, m.Results),
+	}
+	for _, leg := range m.Legs {
+		leg.Flights = providerFlights(m.ProviderID, leg.Flights)
+		res.Legs = append(res.Legs, leg)
+	}
+	for _, it := range m.Itineraries {
+		ids := make([]string, len(it.FlightIDs))
+		for i, id := range it.FlightIDs {
+			ids[i] = ProviderFlightID(m.ProviderID, id)
+		}
+		it.FlightIDs = ids
+		res.Itineraries = append(res.Itineraries, it)
+	}
+	return res
+}
+
+// BuildItineraries returns the cheapest combinations of one flight per leg
+// that connect, cheapest first.
+func BuildItineraries(legs [][]Flight) []Itinerary {
+	return contract.BuildItineraries(legs)
+}
+
+// ParseFlightTime parses the departure or arrival time of a flight.
+func ParseFlightTime(v string) (time.Time, bool) {
+	return contract.ParseFlightTime(v)
 }
 
+// ProviderFlightID returns the ID main-service gives to the flight id of
+// provider.
+func ProviderFlightID(provider, id string) string {
+	return provider + ":" + id
+}
+
+func providerFlights(provider string, flights []Flight) []Flight {
+	if flights == nil {
+		return nil
+	}
+	out := make([]Flight, len(flights))
+	for i, f := range flights {
+		f.ID = ProviderFlightID(provider, f.ID)
+		out[i] = f
+	}
+	return out
+}
+
+// ProviderState reports how one provider answered a search.
+type ProviderState struct {
+	ProviderID   string `json:"provider_id"`
+	Status       string `json:"status"`
+	TotalResults int    `json:"total_results"`
+}
+
+// SearchState is the persisted snapshot of a search, served to clients that
+// poll instead of holding an SSE connection.
+type SearchState struct {
+	SearchID        string              `json:"search_id"`
+	Status          string              `json:"status"`
+	Request         FlightSearchRequest `json:"request"`
+	Results         []Flight            `json:"results"`
+	Legs            []LegResult         `json:"legs"`
+	Itineraries     []Itinerary         `json:"itineraries"`
+	Providers       []ProviderState     `json:"providers"`
+	FailedProviders []string            `json:"failed_providers"`
+	// LastEventID is the stream entry ID of the latest recorded result and
+	// can be sent as Last-Event-ID to resume the SSE stream after it.
+	LastEventID string    `json:"last_event_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// ExpiresAt is the search deadline; a search still processing after it
+	// is reported as expired.
+	ExpiresAt time.Time `json:"expires_at"`
+	// ProvidersDueAt is when providers that have not answered are given up
+	// on, provided at least one provider answered.
+	ProvidersDueAt time.Time `json:"providers_due_at"`
+
+	// ExpectedProviders and ProviderResults are the stored inputs the
+	// aggregated fields above are computed from.
+	ExpectedProviders []string                      `json:"-"`
+	ProviderResults   map[string]FlightSearchResult `json:"-"`
+	// Watchers is the number of clients currently following the search;
+	// TransportWatchers splits it by the transport they follow it over.
+	Watchers          int64            `json:"-"`
+	TransportWatchers map[string]int64 `json:"-"`
+	// CacheKey is set on searches sent to the providers; their results are
+	// cached under it once complete. Searches answered from the cache have
+	// none.
+	CacheKey string `json:"-"`
+}
+
+// IsTerminalStatus reports whether no further results are expected for a
+// search in the given status.
+func IsTerminalStatus(status string) bool {
+	switch status {
+	case SearchStatusCompleted, SearchStatusNotFound, SearchStatusFailed, SearchStatusExpired, SearchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+type SearchLegBody struct {
+	From string `json:"from" validate:"required,len=3,uppercase"`
+	To   string `json:"to" validate:"required,len=3,uppercase"`
+	Date string `json:"date" validate:"required,datetime=2006-01-02"`
+}
+
+// CreateSearchBody describes a search. One-way and round-trip searches use
+// From, To and Date (plus ReturnDate); multi-city searches use Legs.
 type CreateSearchBody struct {
-	From       string `json:"from" validate:"required,len=3,uppercase"`
-	To         string `json:"to" validate:"required,len=3,uppercase"`
-	Date       string `json:"date" validate:"required,datetime=2006-01-02"` // format YYYY-MM-DD
-	Passengers int    `json:"passengers" validate:"required,min=1,max=10"`
+	TripType   string          `json:"trip_type" validate:"omitempty,oneof=one_way round_trip multi_city"` // defaults to one_way
+	From       string          `json:"from" validate:"required_unless=TripType multi_city,omitempty,len=3,uppercase"`
+	To         string          `json:"to" validate:"required_unless=TripType multi_city,omitempty,len=3,uppercase"`
+	Date       string          `json:"date" validate:"required_unless=TripType multi_city,omitempty,datetime=2006-01-02"` // format YYYY-MM-DD
+	ReturnDate string          `json:"return_date" validate:"required_if=TripType round_trip,omitempty,datetime=2006-01-02"`
+	Legs       []SearchLegBody `json:"legs" validate:"required_if=TripType multi_city,omitempty,min=2,max=5,dive"`
+	Passengers int             `json:"passengers" validate:"required,min=1,max=10"`
+	CabinClass string          `json:"cabin_class" validate:"omitempty,oneof=economy business first"` // defaults to economy
+	Filters    *SearchFilters  `json:"filters"`
+	SortBy     string          `json:"sort_by" validate:"omitempty,oneof=price departure_time duration"` // defaults to provider order
+	SortOrder  string          `json:"sort_order" validate:"omitempty,oneof=asc desc"`                   // defaults to asc
+
+	// BypassCache sends the search to the providers even when cached
+	// results exist. Set from the X-Cache-Bypass header.
+	BypassCache bool `json:"-"`
+	// IdempotencyKey makes retries of the same search return the original
+	// search instead of starting a new one. Set from the Idempotency-Key
+	// header.
+	IdempotencyKey string `json:"-"`
+	// Client is who sent the search, so that clients choosing the same
+	// idempotency key do not see each other's searches.
+	Client string `json:"-"`
+}
+
+// SearchSubmission is the outcome of submitting a search.
+type SearchSubmission struct {
+	SearchID string `json:"search_id"`
+	Status   string `json:"status"`
+	// Cached reports that the results were served from the result cache
+	// and are already available.
+	Cached bool `json:"cached"`
+	// Replayed reports that the idempotency key was already used and the
+	// original search is returned.
+	Replayed bool `json:"-"`
+}
+
+// IdempotencyRecord ties an idempotency key to the search it started.
+// Fingerprint identifies the request body the key was first used with.
+type IdempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	SearchID    string `json:"search_id"`
+}
+
+// CacheStats counts how searches were served by the result cache.
+type CacheStats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Bypasses int64 `json:"bypasses"`
 }
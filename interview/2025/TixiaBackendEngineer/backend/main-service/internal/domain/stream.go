@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareStreamIDs orders two Redis stream entry IDs ("<ms>-<seq>") and
+// returns -1, 0 or 1. An empty ID sorts before every other ID.
+func CompareStreamIDs(a, b string) int {
+	am, as := splitStreamID(a)
+	bm, bs := splitStreamID(b)
+	switch {
+	case am < bm:
+		return -1
+	case am > bm:
+		return 1
+	case as < bs:
+		return -1
+	case as > bs:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func splitStreamID(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	m, _ := strconv.ParseUint(ms, 10, 64)
+	s, _ := strconv.ParseUint(seq, 10, 64)
+	return m, s
+}
+
+// Streams names the Redis streams the services exchange searches over.
+type Streams struct {
+	Requested string
+	Results   string
+	Cancelled string
+}
+
+// DefaultStreams are the stream names used unless configured otherwise.
+var DefaultStreams = Streams{
+	Requested: StreamFlightSearchRequested,
+	Results:   StreamFlightSearchResults,
+	Cancelled: StreamFlightSearchCancelled,
+}
+
+// All returns the name of every stream.
+func (s Streams) All() []string {
+	return []string{s.Requested, s.Results, s.Cancelled}
+}
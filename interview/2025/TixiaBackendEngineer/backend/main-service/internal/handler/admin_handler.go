@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"example.com/main-service/internal/usecase"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAdminLimit = 100
+	maxAdminLimit     = 1000
+)
+
+type adminHandler struct {
+	uc  usecase.IAdminUseCase
+	log *zap.Logger
+}
+
+// NewAdminHandler creates the handler of the admin API, which lets on-call
+// engineers inspect searches and streams without access to Redis.
+func NewAdminHandler(uc usecase.IAdminUseCase, log *zap.Logger) *adminHandler {
+	return &adminHandler{
+		uc:  uc,
+		log: log,
+	}
+}
+
+// ActiveSearches lists the searches still waiting for providers with their
+// age, the oldest first. The limit query parameter bounds the searches
+// looked at.
+func (h *adminHandler) ActiveSearches(c *fiber.Ctx) error {
+	limit, ok := h.limit(c)
+	if !ok {
+		return nil
+	}
+	searches, err := h.uc.ActiveSearches(c.UserContext(), limit)
+	if err != nil {
+		h.log.Error("Failed to list active searches", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to list active searches",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Active searches",
+		"data":    searches,
+	})
+}
+
+// Subscriptions lists the number of clients following each search, by
+// transport. The limit query parameter bounds the searches looked at.
+func (h *adminHandler) Subscriptions(c *fiber.Ctx) error {
+	limit, ok := h.limit(c)
+	if !ok {
+		return nil
+	}
+	subs, err := h.uc.Subscriptions(c.UserContext(), limit)
+	if err != nil {
+		h.log.Error("Failed to list subscriptions", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to list subscriptions",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Search subscriptions",
+		"data":    subs,
+	})
+}
+
+// StreamHealth summarises the streams and their consumer groups: length,
+// lag and the entries pending acknowledgement.
+func (h *adminHandler) StreamHealth(c *fiber.Ctx) error {
+	health, err := h.uc.StreamHealth(c.UserContext())
+	if err != nil {
+		h.log.Error("Failed to get stream health", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to get stream health",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Stream health",
+		"data":    health,
+	})
+}
+
+// limit reads the limit query parameter. When it is invalid the request is
+// answered and ok is false.
+func (h *adminHandler) limit(c *fiber.Ctx) (limit int64, ok bool) {
+	n := c.QueryInt("limit", defaultAdminLimit)
+	if n <= 0 || n > maxAdminLimit {
+		_ = c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": fmt.Sprintf("limit must be between 1 and %d", maxAdminLimit),
+		})
+		return 0, false
+	}
+	return int64(n), true
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"example.com/main-service/internal/usecase"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAirportLimit = 10
+	maxAirportLimit     = 50
+)
+
+type airportHandler struct {
+	uc  usecase.IAirportUseCase
+	log *zap.Logger
+}
+
+// NewAirportHandler creates the handler of the airport autocomplete.
+func NewAirportHandler(uc usecase.IAirportUseCase, log *zap.Logger) *airportHandler {
+	return &airportHandler{
+		uc:  uc,
+		log: log,
+	}
+}
+
+// SearchAirports suggests the cities and airports matching the q query
+// parameter by code, city or name. The limit query parameter bounds the
+// suggestions.
+func (h *airportHandler) SearchAirports(c *fiber.Ctx) error {
+	query := c.Query("q")
+	if query == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "q is required",
+		})
+	}
+	limit := c.QueryInt("limit", defaultAirportLimit)
+	if limit <= 0 || limit > maxAirportLimit {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": fmt.Sprintf("limit must be between 1 and %d", maxAirportLimit),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Airports",
+		"data":    h.uc.SearchPlaces(query, limit),
+	})
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// StopReady makes Ready fail, so the load balancer stops sending new
+// clients, while the handler keeps serving until Drain.
+func (h *flightHandler) StopReady() {
+	if h.unready.CompareAndSwap(false, true) {
+		h.log.Info("Failing readiness before draining")
+	}
+}
+
+// Drain starts the shutdown of the handler: new searches are refused and
+// every open stream ends with a reconnect event, after which clients should
+// reconnect with the retry delay it carries and resume from the last event
+// ID they received. It returns at once; Wait tells when the WebSocket
+// sessions are gone.
+func (h *flightHandler) Drain() {
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+	if h.isDraining() {
+		return
+	}
+	h.log.Info("Draining streams", zap.Duration("reconnect_delay", h.reconnectDelay))
+	close(h.draining)
+}
+
+// Wait blocks until every WebSocket session has ended or ctx is done. SSE
+// streams are regular requests and are waited for by the server shutdown.
+func (h *flightHandler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.sessions.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RejectWhileDraining answers 503 once the handler drains, so clients retry
+// the request on another instance.
+func (h *flightHandler) RejectWhileDraining(c *fiber.Ctx) error {
+	if !h.isDraining() {
+		return c.Next()
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(h.reconnectDelay.Seconds()))))
+	return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+		"success": false,
+		"message": "Server is shutting down",
+	})
+}
+
+func (h *flightHandler) isDraining() bool {
+	select {
+	case <-h.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// startSession registers a WebSocket session with Wait, unless the handler
+// already drains.
+func (h *flightHandler) startSession() bool {
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+	if h.isDraining() {
+		return false
+	}
+	h.sessions.Add(1)
+	return true
+}
+
+// reconnectEvent tells the client to resume the stream of searchID from
+// the last event ID it received, after the retry delay.
+func (h *flightHandler) reconnectEvent(searchID, message string) searchEvent {
+	return searchEvent{
+		Event: eventReconnect,
+		Retry: h.reconnectDelay,
+		Payload: fiber.Map{
+			"search_id": searchID,
+			"retry_ms":  h.reconnectDelay.Milliseconds(),
+			"message":   message,
+		},
+	}
+}
+
+// Ready fails once StopReady is called or the handler drains, which takes
+// the instance out of load balancing.
+func (h *flightHandler) Ready(context.Context) error {
+	if h.unready.Load() || h.isDraining() {
+		return errors.New("shutting down")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/usecase"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// silentSearches is a use case whose searches never produce a result. The
+// other methods are not expected to be called.
+type silentSearches struct {
+	usecase.IFlightUseCase
+}
+
+func (silentSearches) WatchSearch(ctx context.Context, searchID, transport string) func() {
+	return func() {}
+}
+
+func (silentSearches) StreamResults(ctx context.Context, searchID, lastEventID string) <-chan domain.FlightSearchResult {
+	ch := make(chan domain.FlightSearchResult)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch
+}
+
+func TestDrain_SendsReconnect(t *testing.T) {
+	h := NewFlightHandler(silentSearches{}, time.Minute, 1500*time.Millisecond, time.Minute, zap.NewNop())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := make(chan searchEvent, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.streamSearch(ctx, "sse", &domain.SearchState{
+			SearchID:  "s1",
+			Status:    domain.SearchStatusProcessing,
+			ExpiresAt: time.Now().Add(time.Minute),
+		}, "", func(e searchEvent) error {
+			events <- e
+			return nil
+		}, nil)
+	}()
+
+	h.Drain()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("stream did not end on drain")
+	}
+
+	require.Len(t, events, 1)
+	e := <-events
+	assert.Equal(t, eventReconnect, e.Event)
+	assert.Equal(t, 1500*time.Millisecond, e.Retry)
+	assert.Equal(t, fiber.Map{
+		"search_id": "s1",
+		"retry_ms":  int64(1500),
+		"message":   "server shutting down",
+	}, e.Payload)
+}
+
+func TestRejectWhileDraining(t *testing.T) {
+	h := NewFlightHandler(silentSearches{}, time.Minute, 1500*time.Millisecond, time.Minute, zap.NewNop())
+	app := fiber.New()
+	app.Post("/search", h.RejectWhileDraining, func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusAccepted)
+	})
+	search := func() *http.Response {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/search", nil))
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusAccepted, search().StatusCode)
+
+	// Failing readiness alone still serves new searches; the load balancer
+	// takes a while to notice.
+	h.StopReady()
+	assert.Error(t, h.Ready(context.Background()))
+	assert.Equal(t, http.StatusAccepted, search().StatusCode)
+
+	h.Drain()
+	resp := search()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get(fiber.HeaderRetryAfter))
+	assert.False(t, h.startSession(), "no WebSocket session starts while draining")
+	assert.NoError(t, h.Wait(context.Background()))
+}
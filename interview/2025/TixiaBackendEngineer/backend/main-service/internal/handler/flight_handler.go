@@ -2,28 +2,78 @@ package handler
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/metrics"
+	"example.com/main-service/internal/middleware"
 	"example.com/main-service/internal/usecase"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+const (
+	// headerCacheBypass, set to a true boolean such as 1 or true, makes a
+	// search skip the result cache; meant for debugging.
+	headerCacheBypass = "X-Cache-Bypass"
+	// headerCache tells whether a search was answered from the cache.
+	headerCache = "X-Cache"
+	// headerIdempotencyKey lets clients retry a search without starting it
+	// twice; headerIdempotentReplayed marks the answers to such retries.
+	headerIdempotencyKey     = "Idempotency-Key"
+	headerIdempotentReplayed = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+
+	// defaultHeartbeat and defaultSearchDeadline stand in for intervals left
+	// unset, which would make tickers panic and deadlines fire at once.
+	defaultHeartbeat      = 15 * time.Second
+	defaultSearchDeadline = 30 * time.Second
+)
+
 type flightHandler struct {
-	uc        usecase.IFlightUseCase
-	log       *zap.Logger
-	validator *validator.Validate
+	uc             usecase.IFlightUseCase
+	heartbeat      time.Duration
+	reconnectDelay time.Duration
+	searchDeadline time.Duration
+	log            *zap.Logger
+	validator      *validator.Validate
+
+	unready  atomic.Bool
+	drainMu  sync.Mutex
+	draining chan struct{}
+	sessions sync.WaitGroup
 }
 
-func NewFlightHandler(uc usecase.IFlightUseCase, log *zap.Logger) *flightHandler {
+// NewFlightHandler creates the flight handler. heartbeat is the interval of
+// the SSE comments and WebSocket pings that keep idle connections open
+// through proxies; reconnectDelay is the retry hint sent to clients when the
+// server drains; searchDeadline bounds streams of searches without a known
+// expiry.
+func NewFlightHandler(uc usecase.IFlightUseCase, heartbeat, reconnectDelay, searchDeadline time.Duration, log *zap.Logger) *flightHandler {
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+	if searchDeadline <= 0 {
+		searchDeadline = defaultSearchDeadline
+	}
 	return &flightHandler{
-		uc:        uc,
-		log:       log,
-		validator: validator.New(),
+		uc:             uc,
+		heartbeat:      heartbeat,
+		reconnectDelay: reconnectDelay,
+		searchDeadline: searchDeadline,
+		log:            log,
+		validator:      validator.New(),
+		draining:       make(chan struct{}),
 	}
 }
 
@@ -46,7 +96,40 @@ func (h *flightHandler) SearchFlights(c *fiber.Ctx) error {
 		})
 	}
 
-	searchID, err := h.uc.SearchFlights(c.Context(), body)
+	if bypass := c.Get(headerCacheBypass); bypass != "" {
+		var err error
+		if body.BypassCache, err = strconv.ParseBool(bypass); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "X-Cache-Bypass must be a boolean",
+			})
+		}
+	}
+	body.IdempotencyKey = c.Get(headerIdempotencyKey)
+	body.Client = middleware.ClientID(c)
+	if len(body.IdempotencyKey) > maxIdempotencyKeyLength {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Idempotency-Key is too long",
+		})
+	}
+
+	sub, err := h.uc.SearchFlights(c.UserContext(), body)
+	if errors.Is(err, domain.ErrInvalidSearch) {
+		h.log.Warn("invalid search", zap.Error(err))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Validation error",
+			"errors":  err.Error(),
+		})
+	}
+	if errors.Is(err, domain.ErrIdempotencyConflict) {
+		h.log.Warn("idempotency key conflict", zap.Error(err))
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Idempotency-Key was already used with a different request",
+		})
+	}
 	if err != nil {
 		h.log.Error("Failed to search flights", zap.Error(err))
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
@@ -55,18 +138,132 @@ func (h *flightHandler) SearchFlights(c *fiber.Ctx) error {
 		})
 	}
 
+	cacheStatus := "MISS"
+	if sub.Cached {
+		cacheStatus = "HIT"
+	}
+	c.Set(headerCache, cacheStatus)
+	if sub.Replayed {
+		c.Set(headerIdempotentReplayed, "true")
+	}
+
 	return c.Status(http.StatusOK).JSON(fiber.Map{
 		"success": true,
 		"message": "Search request submitted",
+		"data":    sub,
+	})
+}
+
+// CacheStats reports how often searches were answered from the result
+// cache, across all processes.
+func (h *flightHandler) CacheStats(c *fiber.Ctx) error {
+	stats, err := h.uc.CacheStats(c.UserContext())
+	if err != nil {
+		h.log.Error("Failed to get cache stats", zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to get cache stats",
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Cache stats retrieved",
+		"data":    stats,
+	})
+}
+
+func (h *flightHandler) GetSearch(c *fiber.Ctx) error {
+	searchID := c.Params("search_id")
+	if searchID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "missing search_id param",
+		})
+	}
+
+	state, err := h.uc.GetSearch(c.UserContext(), searchID)
+	if errors.Is(err, domain.ErrSearchNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Search not found or expired",
+		})
+	}
+	if err != nil {
+		h.log.Error("Failed to get search", zap.String("search_id", searchID), zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to get search",
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Search status retrieved",
+		"data": fiber.Map{
+			"search_id":        state.SearchID,
+			"status":           state.Status,
+			"request":          state.Request,
+			"results":          state.Results,
+			"legs":             state.Legs,
+			"itineraries":      state.Itineraries,
+			"providers":        state.Providers,
+			"failed_providers": state.FailedProviders,
+			"last_event_id":    state.LastEventID,
+			"total_results":    len(state.Results),
+			"created_at":       state.CreatedAt,
+			"updated_at":       state.UpdatedAt,
+			"expires_at":       state.ExpiresAt,
+		},
+	})
+}
+
+// CancelSearch stops a running search. Clients following it receive a
+// cancelled event and the providers drop the request.
+func (h *flightHandler) CancelSearch(c *fiber.Ctx) error {
+	searchID := c.Params("search_id")
+	if searchID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "missing search_id param",
+		})
+	}
+
+	err := h.uc.CancelSearch(c.UserContext(), searchID)
+	if errors.Is(err, domain.ErrSearchNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Search not found or expired",
+		})
+	}
+	if errors.Is(err, domain.ErrSearchFinished) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Search already finished",
+		})
+	}
+	if err != nil {
+		h.log.Error("Failed to cancel search", zap.String("search_id", searchID), zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to cancel search",
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Search cancelled",
 		"data": fiber.Map{
 			"search_id": searchID,
-			"status":    "processing",
+			"status":    domain.SearchStatusCancelled,
 		},
 	})
 }
 
 func (h *flightHandler) StreamFlightResults(c *fiber.Ctx) error {
-	searchID := c.Params("search_id")
+	// The body is streamed after the handler returns, when Fiber reuses the
+	// buffers behind c, so the values read from the request are copied.
+	searchID := utils.CopyString(c.Params("search_id"))
 	if searchID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
@@ -74,62 +271,87 @@ func (h *flightHandler) StreamFlightResults(c *fiber.Ctx) error {
 		})
 	}
 
+	state, err := h.uc.GetSearch(c.UserContext(), searchID)
+	if errors.Is(err, domain.ErrSearchNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Search not found or expired",
+		})
+	}
+	if err != nil {
+		h.log.Error("Failed to get search", zap.String("search_id", searchID), zap.Error(err))
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to get search",
+		})
+	}
+
+	lastEventID := utils.CopyString(c.Get("Last-Event-ID"))
+	if lastEventID != "" && streamFinished(state, lastEventID) {
+		// 204 tells EventSource to stop reconnecting.
+		h.log.Info("SSE resume after completion", zap.String("search_id", searchID))
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
 	c.Set("Content-Type", "text/event-stream")
 	c.Set("Cache-Control", "no-cache")
 	c.Set("Connection", "keep-alive")
 	c.Set("Transfer-Encoding", "chunked")
 
-	resultsChan := h.uc.StreamResults(c.Context(), searchID)
 	fctx := c.Context() // simpan fasthttp.RequestCtx
+	// fasthttp clears the channel behind fctx.Done once the server has shut
+	// down, so it is read while the request is still being served.
+	shutdown := fctx.Done()
+	// The request span ends before the body is streamed; the stream's spans
+	// still belong to its trace.
+	spanCtx := trace.SpanContextFromContext(c.UserContext())
 
 	fctx.SetBodyStreamWriter(func(w *bufio.Writer) {
-		for {
+		connections := metrics.StreamConnections.WithLabelValues(metrics.TransportSSE)
+		connections.Inc()
+		defer connections.Dec()
+
+		fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+		if err := w.Flush(); err != nil {
+			h.log.Info("SSE disconnected", zap.String("search_id", searchID))
+			return
+		}
+
+		// fctx is never cancelled when the client goes away, so the
+		// subscription gets its own context released when the writer returns
+		// or the server shuts down.
+		ctx, cancel := context.WithCancel(trace.ContextWithSpanContext(context.Background(), spanCtx))
+		defer cancel()
+		go func() {
 			select {
-			case <-fctx.Done():
-				h.log.Info("SSE disconnected",
-					zap.String("search_id", searchID),
-				)
-				return
-			case res, ok := <-resultsChan:
-				if !ok {
-					h.log.Info("SSE stream ended",
-						zap.String("search_id", searchID),
-					)
-					return
-				}
-				h.log.Info("SSE send",
-					zap.String("search_id", res.SearchID),
-					zap.String("status", res.Status),
-					zap.Int("total_results", len(res.Results)),
-				)
-				data, err := json.Marshal(res)
-				if err != nil {
-					h.log.Error("failed to marshal result", zap.Error(err))
-					continue
-				}
-				fmt.Fprintf(w, "data: %s\n", data)
-				w.Flush()
-				if res.Status == "completed" {
-					summary := struct {
-						SearchID     string `json:"search_id"`
-						Status       string `json:"status"`
-						TotalResults int    `json:"total_results"`
-					}{
-						SearchID:     res.SearchID,
-						Status:       res.Status,
-						TotalResults: len(res.Results),
-					}
-
-					data, _ := json.Marshal(summary)
-					fmt.Fprintf(w, "data: %s\n\n", data)
-					w.Flush()
-
-					h.log.Info("SSE completed", zap.String("search_id", searchID))
-					return
-				}
+			case <-shutdown:
+				cancel()
+			case <-ctx.Done():
 			}
+		}()
+
+		emit := func(ev searchEvent) error {
+			if ev.Retry > 0 {
+				fmt.Fprintf(w, "retry: %d\n", ev.Retry.Milliseconds())
+			}
+			return writeSSEEvent(w, ev.ID, ev.Event, ev.Payload)
+		}
+		heartbeat := func() error {
+			fmt.Fprint(w, ":heartbeat\n\n")
+			return w.Flush()
 		}
+		h.streamSearch(ctx, metrics.TransportSSE, state, lastEventID, emit, heartbeat)
 	})
 
 	return nil
 }
+
+// streamFinished reports whether a client resuming after lastEventID has
+// already received the final event of the search.
+func streamFinished(state *domain.SearchState, lastEventID string) bool {
+	if state.Status == domain.SearchStatusExpired {
+		return true
+	}
+	return domain.IsTerminalStatus(state.Status) &&
+		domain.CompareStreamIDs(lastEventID, state.LastEventID) >= 0
+}
@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/metrics"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Message types of the WebSocket protocol. Clients send search, subscribe,
+// unsubscribe and cancel; the server answers with accepted, cancelled, done
+// and error, and relays the events of every subscribed search (result,
+// summary, error, timeout) tagged with their search ID. A subscription that falls behind ends with a
+// reconnect event, after which the client subscribes again from the last
+// event ID it received. On shutdown every subscription ends with a
+// reconnect event, and a last untagged reconnect precedes the close frame.
+const (
+	wsMessageSearch      = "search"
+	wsMessageSubscribe   = "subscribe"
+	wsMessageUnsubscribe = "unsubscribe"
+	wsMessageCancel      = "cancel"
+	wsMessageAccepted    = "accepted"
+	wsMessageDone        = "done"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+
+	localsSpanContext = "span_context"
+)
+
+type wsClientMessage struct {
+	Type        string                   `json:"type"`
+	RequestID   string                   `json:"request_id,omitempty"`
+	SearchID    string                   `json:"search_id,omitempty"`
+	LastEventID string                   `json:"last_event_id,omitempty"`
+	Search      *domain.CreateSearchBody `json:"search,omitempty"`
+}
+
+type wsServerMessage struct {
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id,omitempty"`
+	SearchID  string      `json:"search_id,omitempty"`
+	EventID   string      `json:"event_id,omitempty"`
+	Message   string      `json:"message,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// wsSession multiplexes the searches of one WebSocket connection.
+type wsSession struct {
+	conn *websocket.Conn
+	ctx  context.Context
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	subs     map[string]context.CancelFunc
+	wg       sync.WaitGroup
+	draining bool
+}
+
+func (s *wsSession) send(msg wsServerMessage) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return s.conn.WriteJSON(msg)
+}
+
+func (s *wsSession) ping() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+}
+
+func (s *wsSession) close(code int, text string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteTimeout))
+}
+
+// UpgradeWebSocket rejects requests to the WebSocket endpoint that are not
+// upgrade requests.
+func (h *flightHandler) UpgradeWebSocket(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"success": false,
+			"message": "WebSocket upgrade required",
+		})
+	}
+	c.Locals(localsSpanContext, trace.SpanContextFromContext(c.UserContext()))
+	return c.Next()
+}
+
+// FlightsWebSocket lets one connection start, follow and cancel several
+// searches. It goes through the same use case calls as the HTTP endpoints.
+func (h *flightHandler) FlightsWebSocket(conn *websocket.Conn) {
+	// Searches started over the connection join the trace of the upgrade
+	// request.
+	spanCtx, _ := conn.Locals(localsSpanContext).(trace.SpanContext)
+	ctx, cancel := context.WithCancel(trace.ContextWithSpanContext(context.Background(), spanCtx))
+	s := &wsSession{
+		conn: conn,
+		ctx:  ctx,
+		subs: make(map[string]context.CancelFunc),
+	}
+	defer func() {
+		cancel()
+		s.wg.Wait()
+	}()
+
+	if !h.startSession() {
+		h.wsReconnect(s)
+		return
+	}
+	defer h.sessions.Done()
+
+	connections := metrics.StreamConnections.WithLabelValues(metrics.TransportWebSocket)
+	connections.Inc()
+	defer connections.Dec()
+
+	h.log.Info("WebSocket connected", zap.String("remote_addr", conn.RemoteAddr().String()))
+
+	go func() {
+		ticker := time.NewTicker(h.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.draining:
+				h.wsDrain(s)
+				return
+			case <-ticker.C:
+				if err := s.ping(); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var msg wsClientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				h.log.Warn("WebSocket read failed", zap.Error(err))
+			}
+			h.log.Info("WebSocket disconnected")
+			return
+		}
+
+		switch msg.Type {
+		case wsMessageSearch:
+			h.wsSearch(s, msg)
+		case wsMessageSubscribe:
+			h.wsSubscribe(s, msg.RequestID, msg.SearchID, msg.LastEventID)
+		case wsMessageUnsubscribe:
+			h.wsUnsubscribe(s, msg)
+		case wsMessageCancel:
+			h.wsCancel(s, msg)
+		default:
+			h.wsError(s, msg.RequestID, msg.SearchID, "unknown message type")
+		}
+	}
+}
+
+func (h *flightHandler) wsSearch(s *wsSession, msg wsClientMessage) {
+	if h.isDraining() {
+		h.wsError(s, msg.RequestID, "", "server shutting down")
+		return
+	}
+	if msg.Search == nil {
+		h.wsError(s, msg.RequestID, "", "missing search")
+		return
+	}
+	if err := h.validator.Struct(msg.Search); err != nil {
+		h.log.Warn("validation failed", zap.Error(err))
+		h.wsError(s, msg.RequestID, "", err.Error())
+		return
+	}
+
+	sub, err := h.uc.SearchFlights(s.ctx, *msg.Search)
+	if errors.Is(err, domain.ErrInvalidSearch) {
+		h.wsError(s, msg.RequestID, "", err.Error())
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to search flights", zap.Error(err))
+		h.wsError(s, msg.RequestID, "", "failed to initiate search")
+		return
+	}
+
+	_ = s.send(wsServerMessage{
+		Type:      wsMessageAccepted,
+		RequestID: msg.RequestID,
+		SearchID:  sub.SearchID,
+		Data:      sub,
+	})
+	h.wsSubscribe(s, msg.RequestID, sub.SearchID, "")
+}
+
+func (h *flightHandler) wsSubscribe(s *wsSession, requestID, searchID, lastEventID string) {
+	if searchID == "" {
+		h.wsError(s, requestID, "", "missing search_id")
+		return
+	}
+
+	state, err := h.uc.GetSearch(s.ctx, searchID)
+	if errors.Is(err, domain.ErrSearchNotFound) {
+		h.wsError(s, requestID, searchID, "search not found or expired")
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to get search", zap.String("search_id", searchID), zap.Error(err))
+		h.wsError(s, requestID, searchID, "failed to get search")
+		return
+	}
+
+	if lastEventID != "" && streamFinished(state, lastEventID) {
+		_ = s.send(wsServerMessage{Type: wsMessageDone, RequestID: requestID, SearchID: searchID})
+		return
+	}
+
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		h.wsError(s, requestID, searchID, "server shutting down")
+		return
+	}
+	if _, ok := s.subs[searchID]; ok {
+		s.mu.Unlock()
+		h.wsError(s, requestID, searchID, "already subscribed")
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.subs[searchID] = cancel
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.subs, searchID)
+			s.mu.Unlock()
+			cancel()
+		}()
+
+		emit := func(ev searchEvent) error {
+			return s.send(wsServerMessage{
+				Type:     ev.Event,
+				SearchID: searchID,
+				EventID:  ev.ID,
+				Data:     ev.Payload,
+			})
+		}
+		h.streamSearch(ctx, metrics.TransportWebSocket, state, lastEventID, emit, nil)
+
+		if s.ctx.Err() == nil && !h.isDraining() {
+			_ = s.send(wsServerMessage{Type: wsMessageDone, SearchID: searchID})
+		}
+	}()
+}
+
+// wsCancel cancels the search itself and acknowledges it with a cancelled
+// message carrying the request ID; subscriptions to it end with the
+// cancelled event.
+func (h *flightHandler) wsCancel(s *wsSession, msg wsClientMessage) {
+	err := h.uc.CancelSearch(s.ctx, msg.SearchID)
+	switch {
+	case err == nil:
+		_ = s.send(wsServerMessage{
+			Type:      eventCancelled,
+			RequestID: msg.RequestID,
+			SearchID:  msg.SearchID,
+			Message:   "search cancelled",
+			Data:      fiber.Map{"search_id": msg.SearchID, "status": domain.SearchStatusCancelled},
+		})
+	case errors.Is(err, domain.ErrSearchNotFound):
+		h.wsError(s, msg.RequestID, msg.SearchID, "search not found or expired")
+	case errors.Is(err, domain.ErrSearchFinished):
+		h.wsError(s, msg.RequestID, msg.SearchID, "search already finished")
+	case err != nil:
+		h.log.Error("Failed to cancel search", zap.String("search_id", msg.SearchID), zap.Error(err))
+		h.wsError(s, msg.RequestID, msg.SearchID, "failed to cancel search")
+	}
+}
+
+func (h *flightHandler) wsUnsubscribe(s *wsSession, msg wsClientMessage) {
+	s.mu.Lock()
+	cancel, ok := s.subs[msg.SearchID]
+	s.mu.Unlock()
+	if !ok {
+		h.wsError(s, msg.RequestID, msg.SearchID, "not subscribed")
+		return
+	}
+	cancel()
+}
+
+// wsDrain ends the session on shutdown, once its subscriptions have sent
+// their reconnect events.
+func (h *flightHandler) wsDrain(s *wsSession) {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	h.wsReconnect(s)
+}
+
+// wsReconnect tells the client to reconnect and closes the connection. The
+// read loop ends with the client's close frame or the read deadline.
+func (h *flightHandler) wsReconnect(s *wsSession) {
+	_ = s.send(wsServerMessage{
+		Type:    eventReconnect,
+		Message: "server shutting down",
+		Data:    fiber.Map{"retry_ms": h.reconnectDelay.Milliseconds()},
+	})
+	_ = s.close(websocket.CloseGoingAway, "server shutting down")
+	_ = s.conn.SetReadDeadline(time.Now().Add(wsWriteTimeout))
+}
+
+func (h *flightHandler) wsError(s *wsSession, requestID, searchID, message string) {
+	_ = s.send(wsServerMessage{
+		Type:      eventError,
+		RequestID: requestID,
+		SearchID:  searchID,
+		Message:   message,
+	})
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// cancellableSearches cancels s1 and reports every other search finished.
+type cancellableSearches struct {
+	silentSearches
+}
+
+func (cancellableSearches) CancelSearch(ctx context.Context, searchID string) error {
+	if searchID == "s1" {
+		return nil
+	}
+	return domain.ErrSearchFinished
+}
+
+// dialWebSocket serves h's WebSocket endpoint and connects to it.
+func dialWebSocket(t *testing.T, h *flightHandler) *fastws.Conn {
+	t.Helper()
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws", h.UpgradeWebSocket, websocket.New(h.FlightsWebSocket))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	conn, _, err := fastws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	return conn
+}
+
+func TestFlightsWebSocket_AcknowledgesCancel(t *testing.T) {
+	conn := dialWebSocket(t, NewFlightHandler(cancellableSearches{}, time.Minute, time.Second, time.Minute, zap.NewNop()))
+
+	var got wsServerMessage
+	require.NoError(t, conn.WriteJSON(wsClientMessage{Type: wsMessageCancel, RequestID: "r1", SearchID: "s1"}))
+	require.NoError(t, conn.ReadJSON(&got))
+	assert.Equal(t, wsServerMessage{
+		Type:      eventCancelled,
+		RequestID: "r1",
+		SearchID:  "s1",
+		Message:   "search cancelled",
+		Data:      map[string]interface{}{"search_id": "s1", "status": domain.SearchStatusCancelled},
+	}, got)
+
+	got = wsServerMessage{}
+	require.NoError(t, conn.WriteJSON(wsClientMessage{Type: wsMessageCancel, RequestID: "r2", SearchID: "s2"}))
+	require.NoError(t, conn.ReadJSON(&got))
+	assert.Equal(t, wsServerMessage{
+		Type:      eventError,
+		RequestID: "r2",
+		SearchID:  "s2",
+		Message:   "search already finished",
+	}, got)
+}
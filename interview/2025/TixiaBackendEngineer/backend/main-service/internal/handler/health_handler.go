@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// readinessCheckTimeout bounds each readiness check, so a hung dependency
+// fails the probe instead of stalling it.
+const readinessCheckTimeout = 2 * time.Second
+
+// ReadinessCheck reports why a dependency is not ready, or nil when it is.
+type ReadinessCheck func(ctx context.Context) error
+
+type healthHandler struct {
+	checks map[string]ReadinessCheck
+	log    *zap.Logger
+}
+
+// NewHealthHandler creates the probe handler. checks are run by name on
+// every readiness probe.
+func NewHealthHandler(checks map[string]ReadinessCheck, log *zap.Logger) *healthHandler {
+	return &healthHandler{
+		checks: checks,
+		log:    log,
+	}
+}
+
+// Liveness answers 200 as long as the process serves HTTP.
+func (h *healthHandler) Liveness(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ok",
+	})
+}
+
+// Readiness runs every check and answers 503 if any of them fails, with
+// the outcome of each check by name.
+func (h *healthHandler) Readiness(c *fiber.Ctx) error {
+	status := http.StatusOK
+	results := make(map[string]string, len(h.checks))
+	for name, check := range h.checks {
+		ctx, cancel := context.WithTimeout(c.UserContext(), readinessCheckTimeout)
+		err := check(ctx)
+		cancel()
+		if err != nil {
+			h.log.Warn("Readiness check failed", zap.String("check", name), zap.Error(err))
+			status = http.StatusServiceUnavailable
+			results[name] = err.Error()
+			continue
+		}
+		results[name] = "ok"
+	}
+
+	message := "ready"
+	if status != http.StatusOK {
+		message = "not ready"
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success": status == http.StatusOK,
+		"message": message,
+		"data":    results,
+	})
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type probeResponse struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Data    map[string]string `json:"data"`
+}
+
+// probe requests path from app and decodes the answer.
+func probe(t *testing.T, app *fiber.App, path string) (int, probeResponse) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var body probeResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+func TestHealthHandler(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	var hubErr error
+	h := NewHealthHandler(map[string]ReadinessCheck{
+		"redis": func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		},
+		"result_hub": func(context.Context) error {
+			return hubErr
+		},
+	}, zap.NewNop())
+	app := fiber.New()
+	app.Get("/healthz", h.Liveness)
+	app.Get("/readyz", h.Readiness)
+
+	status, body := probe(t, app, "/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, probeResponse{
+		Success: true,
+		Message: "ready",
+		Data:    map[string]string{"redis": "ok", "result_hub": "ok"},
+	}, body)
+
+	hubErr = errors.New("no progress for 1m0s")
+	status, body = probe(t, app, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, probeResponse{
+		Message: "not ready",
+		Data:    map[string]string{"redis": "ok", "result_hub": "no progress for 1m0s"},
+	}, body)
+
+	hubErr = nil
+	mr.Close()
+	status, body = probe(t, app, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.False(t, body.Success)
+	assert.Equal(t, "ok", body.Data["result_hub"])
+	assert.Contains(t, body.Data["redis"], "connection refused")
+
+	// Liveness does not depend on any check.
+	status, body = probe(t, app, "/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, probeResponse{Success: true, Message: "ok"}, body)
+}
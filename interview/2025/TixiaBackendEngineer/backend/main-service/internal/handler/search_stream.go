@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"example.com/telemetry"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("example.com/main-service/internal/handler")
+
+// Event types of a search's result stream.
+const (
+	eventResult    = "result"
+	eventSummary   = "summary"
+	eventError     = "error"
+	eventTimeout   = "timeout"
+	eventCancelled = "cancelled"
+	eventReconnect = "reconnect"
+)
+
+// searchEvent is one event of a search's result stream, independent of the
+// transport delivering it.
+type searchEvent struct {
+	ID      string
+	Event   string
+	Payload interface{}
+	// Retry, when set, overrides the client's reconnection delay.
+	Retry time.Duration
+}
+
+// streamSearch delivers the events of a search over transport until it
+// reaches a terminal status, its deadline passes, the handler drains, ctx is
+// done or emit fails. heartbeat, when not nil, is called whenever the stream
+// has been idle for h.heartbeat.
+func (h *flightHandler) streamSearch(ctx context.Context, transport string, state *domain.SearchState, lastEventID string, emit func(searchEvent) error, heartbeat func() error) {
+	searchID := state.SearchID
+
+	ctx, span := tracer.Start(ctx, "StreamSearch", trace.WithAttributes(
+		attribute.String("search_id", searchID),
+		attribute.String("last_event_id", lastEventID),
+	))
+	defer span.End()
+
+	switch {
+	case state.Status == domain.SearchStatusExpired:
+		h.emitTimeout(emit, searchID)
+		return
+	case domain.IsTerminalStatus(state.Status):
+		// The search finished before the client connected; answer from the
+		// snapshot instead of waiting on the stream.
+		_, _ = h.emitResult(ctx, emit, domain.FlightSearchResult{
+			SearchID:        state.SearchID,
+			Status:          state.Status,
+			FailedProviders: state.FailedProviders,
+			TripType:        state.Request.TripType,
+			Results:         state.Results,
+			Legs:            state.Legs,
+			Itineraries:     state.Itineraries,
+			EventID:         state.LastEventID,
+		})
+		h.log.Info("Search stream completed from snapshot", zap.String("search_id", searchID))
+		return
+	}
+
+	// A search nobody follows any more gets cancelled once the watch is
+	// released, unless the client reconnects in time.
+	release := h.uc.WatchSearch(ctx, searchID, transport)
+	defer release()
+
+	resultsChan := h.uc.StreamResults(ctx, searchID, lastEventID)
+
+	expiresAt := state.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(h.searchDeadline)
+	}
+	deadline := time.NewTimer(time.Until(expiresAt))
+	defer deadline.Stop()
+
+	var ticks <-chan time.Time
+	if heartbeat != nil {
+		ticker := time.NewTicker(h.heartbeat)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.log.Info("Search stream disconnected", zap.String("search_id", searchID))
+			return
+		case <-h.draining:
+			h.log.Info("Search stream drained", zap.String("search_id", searchID))
+			_ = emit(h.reconnectEvent(searchID, "server shutting down"))
+			return
+		case <-deadline.C:
+			h.emitTimeout(emit, searchID)
+			return
+		case <-ticks:
+			if err := heartbeat(); err != nil {
+				h.log.Info("Search stream disconnected", zap.String("search_id", searchID))
+				return
+			}
+		case res, ok := <-resultsChan:
+			if !ok {
+				if ctx.Err() != nil {
+					h.log.Info("Search stream disconnected", zap.String("search_id", searchID))
+					return
+				}
+				// The subscription ended before the search did, such as when
+				// the ResultHub drops a client that fell behind. The search
+				// goes on, so the client resumes from its last event ID.
+				h.log.Info("Search stream interrupted", zap.String("search_id", searchID))
+				_ = emit(h.reconnectEvent(searchID, "result stream interrupted"))
+				return
+			}
+			done, err := h.emitResult(ctx, emit, res)
+			if err != nil {
+				h.log.Info("Search stream disconnected", zap.String("search_id", searchID), zap.Error(err))
+				return
+			}
+			if done {
+				h.log.Info("Search stream completed", zap.String("search_id", searchID))
+				return
+			}
+		}
+	}
+}
+
+// emitResult sends res as a result (or error, or cancelled) event, followed
+// by a summary once the search has completed. It reports whether the
+// stream is done.
+func (h *flightHandler) emitResult(ctx context.Context, emit func(searchEvent) error, res domain.FlightSearchResult) (bool, error) {
+	// Delivery happens in the client's trace; the link leads to the trace of
+	// the search, where the result was produced.
+	opts := []trace.SpanStartOption{trace.WithAttributes(
+		attribute.String("search_id", res.SearchID),
+		attribute.String("event_id", res.EventID),
+		attribute.String("status", res.Status),
+	)}
+	if res.TraceParent != "" {
+		sc := telemetry.SpanContextFromStream(map[string]interface{}{"traceparent": res.TraceParent})
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: sc}))
+	}
+	_, span := tracer.Start(ctx, "DeliverResult", opts...)
+	defer span.End()
+
+	h.log.Info("Search stream send",
+		zap.String("search_id", res.SearchID),
+		zap.String("event_id", res.EventID),
+		zap.String("status", res.Status),
+		zap.String("provider_id", res.ProviderID),
+		zap.Int("total_results", len(res.Results)),
+	)
+
+	event := eventResult
+	switch res.Status {
+	case domain.SearchStatusFailed:
+		event = eventError
+	case domain.SearchStatusCancelled:
+		event = eventCancelled
+	}
+	if err := emit(searchEvent{ID: res.EventID, Event: event, Payload: res}); err != nil {
+		return false, err
+	}
+
+	if !domain.IsTerminalStatus(res.Status) {
+		return false, nil
+	}
+	if event == eventResult {
+		summary := struct {
+			SearchID        string   `json:"search_id"`
+			Status          string   `json:"status"`
+			TotalResults    int      `json:"total_results"`
+			FailedProviders []string `json:"failed_providers"`
+		}{
+			SearchID:        res.SearchID,
+			Status:          res.Status,
+			TotalResults:    len(res.Results),
+			FailedProviders: res.FailedProviders,
+		}
+		if err := emit(searchEvent{ID: res.EventID, Event: eventSummary, Payload: summary}); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+func (h *flightHandler) emitTimeout(emit func(searchEvent) error, searchID string) {
+	h.log.Info("Search stream timed out", zap.String("search_id", searchID))
+	_ = emit(searchEvent{Event: eventTimeout, Payload: fiber.Map{
+		"search_id": searchID,
+		"status":    domain.SearchStatusExpired,
+		"message":   "search deadline exceeded",
+	}})
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestStreamSearch_UnsetIntervals(t *testing.T) {
+	// Neither a search without an expiry nor an unset heartbeat ends the
+	// stream early.
+	h := NewFlightHandler(silentSearches{}, 0, time.Second, 0, zap.NewNop())
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var events []searchEvent
+	h.streamSearch(ctx, "sse", &domain.SearchState{
+		SearchID: "s1",
+		Status:   domain.SearchStatusProcessing,
+	}, "", func(e searchEvent) error {
+		events = append(events, e)
+		return nil
+	}, func() error { return nil })
+
+	assert.Empty(t, events)
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+}
+
+// droppedSearches is a use case whose result subscriptions end at once, as
+// when the ResultHub drops a subscriber that fell behind.
+type droppedSearches struct {
+	silentSearches
+}
+
+func (droppedSearches) StreamResults(ctx context.Context, searchID, lastEventID string) <-chan domain.FlightSearchResult {
+	ch := make(chan domain.FlightSearchResult)
+	close(ch)
+	return ch
+}
+
+func TestStreamSearch_ResumesDroppedSubscription(t *testing.T) {
+	h := NewFlightHandler(droppedSearches{}, time.Minute, 1500*time.Millisecond, time.Minute, zap.NewNop())
+
+	var events []searchEvent
+	h.streamSearch(context.Background(), "sse", &domain.SearchState{
+		SearchID:  "s1",
+		Status:    domain.SearchStatusProcessing,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}, "", func(e searchEvent) error {
+		events = append(events, e)
+		return nil
+	}, nil)
+
+	require.Len(t, events, 1)
+	assert.Equal(t, eventReconnect, events[0].Event)
+	assert.Equal(t, 1500*time.Millisecond, events[0].Retry)
+	assert.Equal(t, fiber.Map{
+		"search_id": "s1",
+		"retry_ms":  int64(1500),
+		"message":   "result stream interrupted",
+	}, events[0].Payload)
+}
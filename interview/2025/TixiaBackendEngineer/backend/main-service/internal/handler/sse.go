@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// sseRetryMillis is the reconnection delay suggested to EventSource
+	// clients.
+	sseRetryMillis = 3000
+)
+
+// writeSSEEvent writes one complete SSE event and flushes it. An empty id
+// leaves the client's last event ID untouched.
+func writeSSEEvent(w *bufio.Writer, id, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event, err)
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return w.Flush()
+}
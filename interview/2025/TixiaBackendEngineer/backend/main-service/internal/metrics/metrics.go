@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Outcomes of a stream message.
+const (
+	OutcomeRead   = "read"
+	OutcomeAcked  = "acked"
+	OutcomeFailed = "failed"
+)
+
+// Transports of a search stream.
+const (
+	TransportSSE       = "sse"
+	TransportWebSocket = "websocket"
+)
+
+// Sources a search is answered from.
+const (
+	SourceProviders = "providers"
+	SourceCache     = "cache"
+)
+
+var (
+	// HTTPRequestDuration is observed once per request, labelled with the
+	// route template rather than the path so that IDs do not add series.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	StreamConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "flight_search_stream_connections",
+		Help: "Connections currently following searches, by transport.",
+	}, []string{"transport"})
+
+	SearchesStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flight_searches_started_total",
+		Help: "Searches started, by the source answering them.",
+	}, []string{"source"})
+
+	// SearchesCompleted counts a search once, where it finishes: in the
+	// process recording the result that completes it, or in the one that
+	// started it once its deadlines pass.
+	SearchesCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flight_searches_completed_total",
+		Help: "Searches that reached a final status, by status.",
+	}, []string{"status"})
+
+	TimeToFirstResult = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "flight_search_time_to_first_result_seconds",
+		Help:    "Time from the start of a search to the first provider result.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	})
+
+	StreamMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flight_stream_messages_total",
+		Help: "Messages handled per stream, by outcome: read, acked or failed.",
+	}, []string{"stream", "outcome"})
+)
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const pendingScrapeTimeout = 2 * time.Second
+
+var streamPendingDesc = prometheus.NewDesc(
+	"flight_stream_group_pending_messages",
+	"Messages delivered to a consumer group but not acknowledged yet, from XPENDING.",
+	[]string{"stream", "group"}, nil,
+)
+
+// StreamPendingCollector reports the pending count of every consumer group
+// of the streams when scraped, so the backlog of a provider that stopped
+// acknowledging shows up whichever process is scraped.
+type StreamPendingCollector struct {
+	rdb     *redis.Client
+	streams []string
+	log     *zap.Logger
+}
+
+func NewStreamPendingCollector(rdb *redis.Client, streams []string, log *zap.Logger) *StreamPendingCollector {
+	return &StreamPendingCollector{
+		rdb:     rdb,
+		streams: streams,
+		log:     log,
+	}
+}
+
+func (c *StreamPendingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- streamPendingDesc
+}
+
+func (c *StreamPendingCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), pendingScrapeTimeout)
+	defer cancel()
+
+	for _, stream := range c.streams {
+		groups, err := c.rdb.XInfoGroups(ctx, stream).Result()
+		if err != nil {
+			// Streams are only created by their first entry.
+			if !strings.Contains(err.Error(), "no such key") {
+				c.log.Error("Failed to list consumer groups", zap.String("stream", stream), zap.Error(err))
+			}
+			continue
+		}
+
+		for _, group := range groups {
+			pending, err := c.rdb.XPending(ctx, stream, group.Name).Result()
+			if err != nil {
+				c.log.Error("Failed to get pending entries", zap.String("stream", stream), zap.String("group", group.Name), zap.Error(err))
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(streamPendingDesc, prometheus.GaugeValue, float64(pending.Count), stream, group.Name)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const localsClientIP = "client_ip"
+
+// RealIP finds the address of the client behind the trusted proxies and
+// makes it available through ClientIP. Every proxy appends the address it
+// got the request from to header, so the header is read from the right and
+// the first address that is not a trusted proxy is the client's; the ones
+// left of it are whatever the client sent. Requests from a peer that is not
+// a trusted proxy are attributed to the peer. trusted holds addresses and
+// CIDR ranges.
+func RealIP(header string, trusted []string, log *zap.Logger) fiber.Handler {
+	var proxies []netip.Prefix
+	for _, t := range trusted {
+		p, err := parseProxy(t)
+		if err != nil {
+			log.Warn("Ignoring invalid trusted proxy", zap.String("proxy", t), zap.Error(err))
+			continue
+		}
+		proxies = append(proxies, p)
+	}
+	isTrusted := func(addr netip.Addr) bool {
+		for _, p := range proxies {
+			if p.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *fiber.Ctx) error {
+		peer, _ := netip.AddrFromSlice(c.Context().RemoteIP())
+		ip := peer.Unmap().String()
+		if header != "" && isTrusted(peer) {
+			hops := strings.Split(c.Get(header), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+				if err != nil {
+					break
+				}
+				ip = addr.Unmap().String()
+				if !isTrusted(addr) {
+					break
+				}
+			}
+		}
+		c.Locals(localsClientIP, ip)
+		return c.Next()
+	}
+}
+
+// ClientIP returns the client address found by RealIP, or the peer's
+// address when RealIP did not run.
+func ClientIP(c *fiber.Ctx) string {
+	if ip, _ := c.Locals(localsClientIP).(string); ip != "" {
+		return ip
+	}
+	return c.IP()
+}
+
+// parseProxy parses an address or a CIDR range.
+func parseProxy(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
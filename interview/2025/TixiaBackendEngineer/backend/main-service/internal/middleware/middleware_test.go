@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeAPIKeys map[string]*domain.APIKey
+
+func (f fakeAPIKeys) GetAPIKey(ctx context.Context, key string) (*domain.APIKey, error) {
+	if k, ok := f[key]; ok {
+		return k, nil
+	}
+	return nil, domain.ErrAPIKeyNotFound
+}
+
+// fakeLimiter allows limit requests per bucket, ignoring time.
+type fakeLimiter map[string]int
+
+func (f fakeLimiter) Allow(ctx context.Context, bucket string, limit int, window time.Duration) (domain.RateLimitResult, error) {
+	res := domain.RateLimitResult{Limit: limit, ResetAfter: window}
+	if f[bucket] >= limit {
+		res.RetryAfter = 1500 * time.Millisecond
+		return res, nil
+	}
+	f[bucket]++
+	res.Allowed = true
+	res.Remaining = limit - f[bucket]
+	return res, nil
+}
+
+func newTestApp() *fiber.App {
+	log := zap.NewNop()
+	keys := fakeAPIKeys{
+		"free-key":     {Name: "free", Plan: domain.PlanFree},
+		"disabled-key": {Name: "old", Plan: domain.PlanPremium, Disabled: true},
+	}
+	cfg := RateLimitConfig{
+		Window:     time.Minute,
+		IPLimit:    100,
+		PlanLimits: map[string]int{domain.PlanFree: 2, domain.PlanPremium: 10},
+	}
+	limiter := fakeLimiter{}
+
+	app := fiber.New()
+	app.Use(RateLimitIP(limiter, cfg, log), APIKeyAuth(keys, log), RateLimitAPIKey(limiter, cfg, log))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(APIKeyFrom(c).Name)
+	})
+	return app
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	app := newTestApp()
+
+	tests := []struct {
+		name   string
+		target string
+		key    string
+		want   int
+	}{
+		{name: "missing key", target: "/", want: http.StatusUnauthorized},
+		{name: "unknown key", target: "/", key: "nope", want: http.StatusUnauthorized},
+		{name: "disabled key", target: "/", key: "disabled-key", want: http.StatusUnauthorized},
+		{name: "header key", target: "/", key: "free-key", want: http.StatusOK},
+		{name: "query key", target: "/?api_key=free-key", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.key != "" {
+				req.Header.Set(HeaderAPIKey, tt.key)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	log := zap.NewNop()
+	keys := fakeAPIKeys{
+		"free-key":  {Name: "free", Plan: domain.PlanFree},
+		"admin-key": {Name: "ops", Plan: domain.PlanPremium, Admin: true},
+	}
+	app := fiber.New()
+	app.Use(APIKeyAuth(keys, log), RequireAdmin(log))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(APIKeyFrom(c).Name)
+	})
+
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "missing key", want: http.StatusUnauthorized},
+		{name: "regular key", key: "free-key", want: http.StatusForbidden},
+		{name: "admin key", key: "admin-key", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.key != "" {
+				req.Header.Set(HeaderAPIKey, tt.key)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
+
+func TestRateLimitAPIKey(t *testing.T) {
+	app := newTestApp()
+
+	do := func() *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderAPIKey, "free-key")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := do()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", resp.Header.Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "60", resp.Header.Get(HeaderRateLimitReset))
+
+	assert.Equal(t, http.StatusOK, do().StatusCode)
+
+	resp = do()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get(fiber.HeaderRetryAfter))
+	assert.Equal(t, "0", resp.Header.Get(HeaderRateLimitRemaining))
+}
+
+func TestRealIP(t *testing.T) {
+	// app.Test connects from 0.0.0.0, which stands in for the load balancer.
+	tests := []struct {
+		name    string
+		trusted []string
+		header  string
+		want    string
+	}{
+		{name: "untrusted peer", header: "203.0.113.7", want: "0.0.0.0"},
+		{name: "no header", trusted: []string{"0.0.0.0"}, want: "0.0.0.0"},
+		{name: "client behind proxies", trusted: []string{"0.0.0.0", "10.0.0.0/8"}, header: "6.6.6.6, 203.0.113.7, 10.0.0.2", want: "203.0.113.7"},
+		{name: "only proxies", trusted: []string{"0.0.0.0", "10.0.0.0/8"}, header: "10.0.0.3, 10.0.0.2", want: "10.0.0.3"},
+		{name: "invalid proxy ignored", trusted: []string{"lb", "0.0.0.0"}, header: "203.0.113.7", want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(RealIP(fiber.HeaderXForwardedFor, tt.trusted, zap.NewNop()))
+			app.Get("/", func(c *fiber.Ctx) error {
+				return c.SendString(ClientIP(c))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(fiber.HeaderXForwardedFor, tt.header)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(body))
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	app := fiber.New()
+	app.Use(Metrics())
+	app.Get("/flights/search/:search_id", func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNotFound)
+	})
+
+	route := "/flights/search/:search_id"
+	before := testutil.CollectAndCount(metrics.HTTPRequestDuration)
+
+	for _, id := range []string{"a", "b"} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/flights/search/"+id, nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+
+	// Both requests land in one series labelled with the route template.
+	assert.Equal(t, before+1, testutil.CollectAndCount(metrics.HTTPRequestDuration))
+	var m dto.Metric
+	require.NoError(t, metrics.HTTPRequestDuration.WithLabelValues(http.MethodGet, route, "404").(prometheus.Metric).Write(&m))
+	assert.Equal(t, uint64(2), m.GetHistogram().GetSampleCount())
+}
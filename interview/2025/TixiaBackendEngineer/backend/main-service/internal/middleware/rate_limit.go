@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/repository"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRateLimitReset     = "X-RateLimit-Reset"
+
+	localsAPIKeyHash = "api_key_hash"
+)
+
+// RateLimitConfig sets the sliding window limits.
+type RateLimitConfig struct {
+	Window time.Duration
+	// IPLimit is the number of requests per window allowed from one IP.
+	IPLimit int
+	// PlanLimits is the number of requests per window allowed for an API
+	// key, by plan. Keys on an unknown plan get the lowest limit.
+	PlanLimits map[string]int
+}
+
+// RateLimitIP limits requests per client IP, before authentication so that
+// unauthenticated floods are throttled too.
+func RateLimitIP(repo repository.IRateLimitRepository, cfg RateLimitConfig, log *zap.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return limit(c, repo, "ip:"+ClientIP(c), cfg.IPLimit, cfg.Window, log)
+	}
+}
+
+// RateLimitAPIKey limits requests per API key according to its plan. It
+// must run after APIKeyAuth.
+func RateLimitAPIKey(repo repository.IRateLimitRepository, cfg RateLimitConfig, log *zap.Logger) fiber.Handler {
+	lowest := math.MaxInt
+	for _, l := range cfg.PlanLimits {
+		lowest = min(lowest, l)
+	}
+
+	return func(c *fiber.Ctx) error {
+		apiKey := APIKeyFrom(c)
+		hash, _ := c.Locals(localsAPIKeyHash).(string)
+		if apiKey == nil || hash == "" {
+			return c.Next()
+		}
+
+		l, ok := cfg.PlanLimits[apiKey.Plan]
+		if !ok {
+			l = lowest
+		}
+		return limit(c, repo, "key:"+hash, l, cfg.Window, log)
+	}
+}
+
+// limit counts the request in bucket and answers 429 once the limit is
+// reached. The rate limit headers are set either way; a later limiter
+// overrides the ones of an earlier one. When Redis is unavailable requests
+// are let through rather than taking the API down with it.
+func limit(c *fiber.Ctx, repo repository.IRateLimitRepository, bucket string, l int, window time.Duration, log *zap.Logger) error {
+	if l <= 0 {
+		return c.Next()
+	}
+
+	res, err := repo.Allow(c.UserContext(), bucket, l, window)
+	if err != nil {
+		log.Error("Failed to apply rate limit", zap.String("bucket", bucket), zap.Error(err))
+		return c.Next()
+	}
+
+	setRateLimitHeaders(c, res)
+	if !res.Allowed {
+		log.Warn("rate limit exceeded", zap.String("bucket", bucket), zap.Int("limit", l))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
+			"success": false,
+			"message": "Rate limit exceeded",
+		})
+	}
+	return c.Next()
+}
+
+func setRateLimitHeaders(c *fiber.Ctx, res domain.RateLimitResult) {
+	c.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+	c.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+	c.Set(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(res.ResetAfter)))
+}
+
+// ceilSeconds rounds d up to whole seconds, with a minimum of one, as
+// clients must not retry before the limit actually frees up.
+func ceilSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
@@ -0,0 +1,220 @@
+package prefork
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// siblingTimeout bounds the time spent gathering the metrics of one
+// sibling process.
+const siblingTimeout = 2 * time.Second
+
+// pidLabel tells the metrics of the prefork processes apart.
+const pidLabel = "pid"
+
+// Metrics makes every prefork process serve the metrics of all of them.
+// Each process keeps its own registry and serves it on a unix socket shared
+// with its siblings; whichever child a scrape lands on gathers them all and
+// labels each process's metrics with its pid.
+type Metrics struct {
+	local prometheus.Gatherer
+	dir   string
+	pid   int
+	log   *zap.Logger
+
+	ln     net.Listener
+	srv    *http.Server
+	client *http.Client
+}
+
+// NewMetrics gathers local, the registry of this process, along with the
+// registries of its prefork siblings.
+func NewMetrics(local prometheus.Gatherer, log *zap.Logger) *Metrics {
+	return newMetrics(local, metricsDir(), os.Getpid(), log)
+}
+
+func newMetrics(local prometheus.Gatherer, dir string, pid int, log *zap.Logger) *Metrics {
+	return &Metrics{
+		local: local,
+		dir:   dir,
+		pid:   pid,
+		log:   log,
+		client: &http.Client{
+			Timeout: siblingTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+					// The host of the request names the socket of the sibling.
+					host, _, err := net.SplitHostPort(addr)
+					if err != nil {
+						return nil, err
+					}
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", filepath.Join(dir, host+".sock"))
+				},
+			},
+		},
+	}
+}
+
+// Serve makes the metrics of this process available to its siblings until
+// Close is called.
+func (m *Metrics) Serve() error {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create metrics socket directory: %w", err)
+	}
+	path := m.socketPath(m.pid)
+	// A socket left by an earlier process with the same pid would make the
+	// listen fail.
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to clear metrics socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on metrics socket: %w", err)
+	}
+
+	m.ln = ln
+	m.srv = &http.Server{
+		Handler:           promhttp.HandlerFor(m.local, promhttp.HandlerOpts{}),
+		ReadHeaderTimeout: siblingTimeout,
+	}
+	go func() {
+		if err := m.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			m.log.Error("Prefork metrics socket stopped", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Close stops serving the metrics of this process and removes its socket.
+// The master, the last process to stop, removes the directory as well.
+func (m *Metrics) Close() error {
+	if m.srv == nil {
+		return nil
+	}
+	// Closing the listener removes the socket, even if Serve has not
+	// picked it up yet.
+	err := errors.Join(m.srv.Close(), ignoreClosed(m.ln.Close()))
+	if !fiber.IsChild() {
+		err = errors.Join(err, os.RemoveAll(m.dir))
+	}
+	return err
+}
+
+func ignoreClosed(err error) error {
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Gather implements prometheus.Gatherer. Siblings that cannot be reached
+// are left out, so a process that just exited does not fail the scrape.
+func (m *Metrics) Gather() ([]*dto.MetricFamily, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list metrics sockets: %w", err)
+	}
+
+	gatherers := prometheus.Gatherers{withPID(m.local, m.pid)}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".sock"))
+		if err != nil || pid == m.pid {
+			continue
+		}
+		families, err := m.gatherSibling(pid)
+		if err != nil {
+			m.log.Debug("Skipping metrics of prefork sibling", zap.Int("pid", pid), zap.Error(err))
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				// Nobody listens any more: the sibling is gone.
+				_ = os.Remove(m.socketPath(pid))
+			}
+			continue
+		}
+		gatherers = append(gatherers, withPID(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return families, nil
+		}), pid))
+	}
+	return gatherers.Gather()
+}
+
+// gatherSibling fetches the metrics served on the socket of pid.
+func (m *Metrics) gatherSibling(pid int) ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+strconv.Itoa(pid)+"/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeProtoDelim)))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var families []*dto.MetricFamily
+	dec := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+	for {
+		mf := &dto.MetricFamily{}
+		if err := dec.Decode(mf); err != nil {
+			if errors.Is(err, io.EOF) {
+				return families, nil
+			}
+			return nil, fmt.Errorf("failed to decode metrics: %w", err)
+		}
+		families = append(families, mf)
+	}
+}
+
+func (m *Metrics) socketPath(pid int) string {
+	return filepath.Join(m.dir, strconv.Itoa(pid)+".sock")
+}
+
+// withPID adds the pid label to every metric gathered by g.
+func withPID(g prometheus.Gatherer, pid int) prometheus.Gatherer {
+	value := strconv.Itoa(pid)
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		for _, mf := range families {
+			for _, metric := range mf.Metric {
+				metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(pidLabel), Value: proto.String(value)})
+				sort.Slice(metric.Label, func(i, j int) bool {
+					return metric.Label[i].GetName() < metric.Label[j].GetName()
+				})
+			}
+		}
+		return families, err
+	})
+}
+
+// metricsDir is the directory holding the metrics sockets of the processes
+// forked by the same master.
+func metricsDir() string {
+	master := os.Getpid()
+	if fiber.IsChild() {
+		master = os.Getppid()
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("fiber-prefork-%d-metrics", master))
+}
@@ -0,0 +1,55 @@
+package prefork
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMetricsGathersSiblings(t *testing.T) {
+	// Unix socket paths are short; t.TempDir may be too long for them.
+	dir, err := os.MkdirTemp("", "prefork")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	process := func(pid int, searches float64) *Metrics {
+		reg := prometheus.NewRegistry()
+		c := prometheus.NewCounter(prometheus.CounterOpts{Name: "searches_total", Help: "Searches."})
+		c.Add(searches)
+		reg.MustRegister(c)
+
+		m := newMetrics(reg, dir, pid, zap.NewNop())
+		require.NoError(t, m.Serve())
+		return m
+	}
+	child := process(101, 1)
+	defer child.Close()
+	sibling := process(102, 2)
+	defer sibling.Close()
+
+	// A socket left by a process that is gone is skipped and removed.
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(dir, "103.sock"), Net: "unix"})
+	require.NoError(t, err)
+	ln.SetUnlinkOnClose(false)
+	require.NoError(t, ln.Close())
+
+	expected := `
+# HELP searches_total Searches.
+# TYPE searches_total counter
+searches_total{pid="101"} 1
+searches_total{pid="102"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(child, strings.NewReader(expected), "searches_total"))
+	assert.NoError(t, testutil.GatherAndCompare(sibling, strings.NewReader(expected), "searches_total"))
+
+	_, err = os.Stat(filepath.Join(dir, "103.sock"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
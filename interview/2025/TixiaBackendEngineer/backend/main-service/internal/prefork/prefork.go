@@ -0,0 +1,110 @@
+// Package prefork coordinates the graceful shutdown of Fiber's prefork
+// processes.
+//
+// Fiber's master kills every child as soon as one of them exits, and the
+// children exit once the master is gone. A child that has drained therefore
+// reports it with a marker file and keeps running; the master exits when
+// every child has reported, or at the deadline, and the children follow.
+package prefork
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pollInterval is how often the master looks for drained children and a
+// drained child looks for its master.
+const pollInterval = 100 * time.Millisecond
+
+// Master tracks the children forked by the prefork master.
+type Master struct {
+	mu   sync.Mutex
+	pids []int
+	log  *zap.Logger
+}
+
+// NewMaster creates the tracker; register OnFork as a Fiber fork hook.
+func NewMaster(log *zap.Logger) *Master {
+	return &Master{log: log}
+}
+
+// OnFork records a forked child and clears any marker left by an earlier
+// process with the same pid.
+func (m *Master) OnFork(pid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pids = append(m.pids, pid)
+	if err := os.Remove(markerPath(pid)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to clear drain marker: %w", err)
+	}
+	return nil
+}
+
+// Shutdown sends sig to every child, then waits until all of them have
+// drained or ctx is done.
+func (m *Master) Shutdown(ctx context.Context, sig syscall.Signal) error {
+	m.mu.Lock()
+	pending := make(map[int]bool, len(m.pids))
+	for _, pid := range m.pids {
+		pending[pid] = true
+	}
+	m.mu.Unlock()
+
+	for pid := range pending {
+		if err := syscall.Kill(pid, sig); err != nil {
+			// The child is gone already; nothing to wait for.
+			m.log.Warn("Failed to signal prefork child", zap.Int("pid", pid), zap.Error(err))
+			delete(pending, pid)
+		}
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for len(pending) > 0 {
+		for pid := range pending {
+			if _, err := os.Stat(markerPath(pid)); err == nil {
+				_ = os.Remove(markerPath(pid))
+				m.log.Info("Prefork child drained", zap.Int("pid", pid))
+				delete(pending, pid)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d prefork children did not drain: %w", len(pending), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// MarkDrained reports to the master that this child has drained.
+func MarkDrained() error {
+	f, err := os.Create(markerPath(os.Getpid()))
+	if err != nil {
+		return fmt.Errorf("failed to write drain marker: %w", err)
+	}
+	return f.Close()
+}
+
+// AwaitMaster blocks until the master, the parent of this child, exits.
+func AwaitMaster() {
+	master := os.Getppid()
+	for os.Getppid() == master {
+		time.Sleep(pollInterval)
+	}
+}
+
+func markerPath(pid int) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("fiber-prefork-%d.drained", pid))
+}
@@ -0,0 +1,44 @@
+package prefork
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestShutdown(t *testing.T) {
+	// The test process plays the only child; signal 0 only checks it exists.
+	pid := os.Getpid()
+
+	t.Run("waits for the drain marker", func(t *testing.T) {
+		m := NewMaster(zap.NewNop())
+		require.NoError(t, m.OnFork(pid))
+
+		go func() {
+			time.Sleep(2 * pollInterval)
+			_ = MarkDrained()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, m.Shutdown(ctx, syscall.Signal(0)))
+
+		_, err := os.Stat(markerPath(pid))
+		assert.ErrorIs(t, err, os.ErrNotExist, "marker is removed once seen")
+	})
+
+	t.Run("gives up at the deadline", func(t *testing.T) {
+		m := NewMaster(zap.NewNop())
+		require.NoError(t, m.OnFork(pid))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*pollInterval)
+		defer cancel()
+		assert.ErrorIs(t, m.Shutdown(ctx, syscall.Signal(0)), context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+//go:generate mockery --name=IAdminRepository
+type IAdminRepository interface {
+	// ActiveSearches returns up to limit of the searches that have not
+	// finished and whose deadline has not passed, the soonest due first.
+	ActiveSearches(ctx context.Context, limit int64) ([]*domain.SearchState, error)
+	// StreamHealth summarises stream and its consumer groups, listing up to
+	// oldestPending of the oldest pending entries of each group.
+	StreamHealth(ctx context.Context, stream string, oldestPending int64) (domain.StreamHealth, error)
+}
+
+type adminRepository struct {
+	rdb *redis.Client
+}
+
+// NewAdminRepository creates the repository behind the admin API. It reads
+// the streams from Redis directly, whatever bus the services exchange
+// messages over.
+func NewAdminRepository(rdb *redis.Client) IAdminRepository {
+	return &adminRepository{rdb: rdb}
+}
+
+func (r *adminRepository) ActiveSearches(ctx context.Context, limit int64) ([]*domain.SearchState, error) {
+	ids, err := r.rdb.ZRangeByScore(ctx, activeSearchesKey, &redis.ZRangeBy{
+		Min:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max:   "+inf",
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active searches: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	pipe := r.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, searchStateKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get active searches: %w", err)
+	}
+
+	states := make([]*domain.SearchState, 0, len(ids))
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		state, err := parseSearchState(ids[i], fields)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func (r *adminRepository) StreamHealth(ctx context.Context, stream string, oldestPending int64) (domain.StreamHealth, error) {
+	health := domain.StreamHealth{Stream: stream, Groups: []domain.StreamGroupHealth{}}
+
+	info, err := r.rdb.XInfoStream(ctx, stream).Result()
+	if err != nil {
+		// Streams are only created by their first entry or group.
+		if strings.Contains(err.Error(), "no such key") {
+			return health, nil
+		}
+		return health, fmt.Errorf("failed to get info of stream %s: %w", stream, err)
+	}
+	health.Exists = true
+	health.Length = info.Length
+	health.EntriesAdded = info.EntriesAdded
+	health.LastGeneratedID = info.LastGeneratedID
+	health.FirstEntryID = info.FirstEntry.ID
+	health.LastEntryID = info.LastEntry.ID
+	if info.LastEntry.ID != "" {
+		ms, _, _ := strings.Cut(info.LastEntry.ID, "-")
+		if at, err := strconv.ParseInt(ms, 10, 64); err == nil {
+			health.LastEntryAgeMs = time.Since(time.UnixMilli(at)).Milliseconds()
+		}
+	}
+
+	groups, err := r.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return health, fmt.Errorf("failed to list consumer groups of stream %s: %w", stream, err)
+	}
+	for _, g := range groups {
+		group := domain.StreamGroupHealth{
+			Name:            g.Name,
+			Consumers:       g.Consumers,
+			LastDeliveredID: g.LastDeliveredID,
+			EntriesRead:     g.EntriesRead,
+			Pending:         domain.PendingSummary{ByConsumer: map[string]int64{}, Oldest: []domain.PendingEntry{}},
+		}
+		if g.Lag >= 0 {
+			lag := g.Lag
+			group.Lag = &lag
+		}
+
+		pending, err := r.rdb.XPending(ctx, stream, g.Name).Result()
+		if err != nil {
+			return health, fmt.Errorf("failed to get pending entries of group %s on %s: %w", g.Name, stream, err)
+		}
+		group.Pending.Count = pending.Count
+		group.Pending.LowestID = pending.Lower
+		group.Pending.HighestID = pending.Higher
+		for consumer, n := range pending.Consumers {
+			group.Pending.ByConsumer[consumer] = n
+		}
+
+		if pending.Count > 0 && oldestPending > 0 {
+			entries, err := r.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream: stream,
+				Group:  g.Name,
+				Start:  "-",
+				End:    "+",
+				Count:  oldestPending,
+			}).Result()
+			if err != nil {
+				return health, fmt.Errorf("failed to list pending entries of group %s on %s: %w", g.Name, stream, err)
+			}
+			for _, e := range entries {
+				group.Pending.Oldest = append(group.Pending.Oldest, domain.PendingEntry{
+					ID:         e.ID,
+					Consumer:   e.Consumer,
+					IdleMs:     e.Idle.Milliseconds(),
+					Deliveries: e.RetryCount,
+				})
+			}
+		}
+		health.Groups = append(health.Groups, group)
+	}
+	return health, nil
+}
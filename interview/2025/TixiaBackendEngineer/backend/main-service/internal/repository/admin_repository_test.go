@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/contract"
+	"example.com/main-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestActiveSearches_LeaveOnceFinished(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newTestRedis(t)
+	flights := NewFlightRepository(rdb, nil, nil, domain.DefaultStreams, contract.Encoder{}, 0, zap.NewNop())
+	admin := NewAdminRepository(rdb)
+
+	// The finished and cancelled searches are due first; they must not
+	// take the places of the running one.
+	now := time.Now()
+	for i, id := range []string{"finished", "cancelled", "running"} {
+		require.NoError(t, flights.SaveSearchState(ctx, domain.SearchState{
+			SearchID:  id,
+			Status:    domain.SearchStatusProcessing,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Duration(i+1) * time.Minute),
+		}))
+	}
+	_, err := flights.MarkSearchFinished(ctx, "finished")
+	require.NoError(t, err)
+	require.NoError(t, cancelSearchState(ctx, rdb, "cancelled"))
+
+	states, err := admin.ActiveSearches(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, "running", states[0].SearchID)
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"example.com/main-service/internal/domain"
+)
+
+// bundledAirports is the airport and city reference data shipped with the
+// service.
+//
+//go:embed airports.json
+var bundledAirports []byte
+
+//go:generate mockery --name=IAirportRepository
+type IAirportRepository interface {
+	// GetAirport returns the airport with code.
+	GetAirport(code string) (domain.Airport, bool)
+	// GetCity returns the city with code and its airports.
+	GetCity(code string) (domain.City, bool)
+	// Places returns every city and airport, the cities first.
+	Places() []domain.Place
+}
+
+type airportRepository struct {
+	airports map[string]domain.Airport
+	cities   map[string]domain.City
+	places   []domain.Place
+}
+
+// NewAirportRepository loads the bundled reference data. It panics when the
+// data is invalid, which a test guards against.
+func NewAirportRepository() IAirportRepository {
+	repo, err := loadAirports(bundledAirports)
+	if err != nil {
+		panic(fmt.Sprintf("invalid bundled airport data: %v", err))
+	}
+	return repo
+}
+
+// loadAirports parses data holding the cities with a code of their own and
+// the airports, which refer to their city by city_code.
+func loadAirports(data []byte) (*airportRepository, error) {
+	var file struct {
+		Cities   []domain.City    `json:"cities"`
+		Airports []domain.Airport `json:"airports"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse airports: %w", err)
+	}
+
+	repo := &airportRepository{
+		airports: make(map[string]domain.Airport, len(file.Airports)),
+		cities:   make(map[string]domain.City, len(file.Cities)),
+	}
+	var errs []error
+	for _, c := range file.Cities {
+		if !isLocationCode(c.Code) {
+			errs = append(errs, fmt.Errorf("invalid city code %q", c.Code))
+		}
+		if _, ok := repo.cities[c.Code]; ok {
+			errs = append(errs, fmt.Errorf("duplicate city %s", c.Code))
+		}
+		c.Airports = nil
+		repo.cities[c.Code] = c
+	}
+	for _, a := range file.Airports {
+		if !isLocationCode(a.Code) {
+			errs = append(errs, fmt.Errorf("invalid airport code %q", a.Code))
+		}
+		if _, ok := repo.airports[a.Code]; ok {
+			errs = append(errs, fmt.Errorf("duplicate airport %s", a.Code))
+		}
+		if _, ok := repo.cities[a.Code]; ok {
+			errs = append(errs, fmt.Errorf("airport %s shares its code with a city", a.Code))
+		}
+		if a.Name == "" || a.City == "" || a.Country == "" || a.Timezone == "" {
+			errs = append(errs, fmt.Errorf("incomplete airport %s", a.Code))
+		}
+		if a.CityCode != "" {
+			city, ok := repo.cities[a.CityCode]
+			if !ok {
+				errs = append(errs, fmt.Errorf("airport %s belongs to unknown city %s", a.Code, a.CityCode))
+			}
+			city.Airports = append(city.Airports, a.Code)
+			repo.cities[a.CityCode] = city
+		}
+		repo.airports[a.Code] = a
+	}
+
+	for _, c := range file.Cities {
+		city := repo.cities[c.Code]
+		if len(city.Airports) == 0 {
+			errs = append(errs, fmt.Errorf("city %s has no airports", c.Code))
+		}
+		repo.places = append(repo.places, domain.Place{
+			Type:     domain.PlaceCity,
+			Code:     city.Code,
+			Name:     city.Name,
+			City:     city.Name,
+			Country:  city.Country,
+			Timezone: city.Timezone,
+			Airports: city.Airports,
+		})
+	}
+	for _, a := range file.Airports {
+		repo.places = append(repo.places, domain.Place{
+			Type:     domain.PlaceAirport,
+			Code:     a.Code,
+			Name:     a.Name,
+			City:     a.City,
+			Country:  a.Country,
+			Timezone: a.Timezone,
+			CityCode: a.CityCode,
+		})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// isLocationCode reports whether code is made of three uppercase letters.
+func isLocationCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *airportRepository) GetAirport(code string) (domain.Airport, bool) {
+	a, ok := r.airports[code]
+	return a, ok
+}
+
+func (r *airportRepository) GetCity(code string) (domain.City, bool) {
+	c, ok := r.cities[code]
+	return c, ok
+}
+
+func (r *airportRepository) Places() []domain.Place {
+	return r.places
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundledAirports(t *testing.T) {
+	repo, err := loadAirports(bundledAirports)
+	require.NoError(t, err)
+
+	for _, p := range repo.Places() {
+		_, err := time.LoadLocation(p.Timezone)
+		assert.NoError(t, err, "timezone of %s", p.Code)
+	}
+
+	jakarta, ok := repo.GetCity("JKT")
+	require.True(t, ok)
+	assert.Equal(t, []string{"CGK", "HLP"}, jakarta.Airports)
+	chicago, ok := repo.GetCity("CHI")
+	require.True(t, ok)
+	assert.Equal(t, []string{"ORD", "MDW"}, chicago.Airports)
+
+	cgk, ok := repo.GetAirport("CGK")
+	require.True(t, ok)
+	assert.Equal(t, "JKT", cgk.CityCode)
+	assert.Equal(t, "Asia/Jakarta", cgk.Timezone)
+
+	_, ok = repo.GetAirport("JKT")
+	assert.False(t, ok)
+}
+
+func TestLoadAirportsRejectsInvalidData(t *testing.T) {
+	_, err := loadAirports([]byte(`{
+		"cities": [{"code": "JKT", "name": "Jakarta", "country": "ID", "timezone": "Asia/Jakarta"}],
+		"airports": [
+			{"code": "CGK", "name": "Soekarno-Hatta", "city": "Jakarta", "city_code": "JAK", "country": "ID", "timezone": "Asia/Jakarta"},
+			{"code": "dps", "name": "Ngurah Rai", "city": "Denpasar", "country": "ID"}
+		]
+	}`))
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "airport CGK belongs to unknown city JAK")
+	assert.ErrorContains(t, err, `invalid airport code "dps"`)
+	assert.ErrorContains(t, err, "incomplete airport dps")
+	assert.ErrorContains(t, err, "city JKT has no airports")
+}
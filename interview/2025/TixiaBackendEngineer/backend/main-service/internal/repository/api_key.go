@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"example.com/main-service/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// apiKeyPrefix is followed by the SHA-256 of the key, so the keys
+// themselves are never stored.
+const apiKeyPrefix = "flight.apikey:"
+
+//go:generate mockery --name=IAPIKeyRepository
+type IAPIKeyRepository interface {
+	GetAPIKey(ctx context.Context, key string) (*domain.APIKey, error)
+}
+
+type apiKeyRepository struct {
+	rdb *redis.Client
+}
+
+func NewAPIKeyRepository(rdb *redis.Client) IAPIKeyRepository {
+	return &apiKeyRepository{rdb: rdb}
+}
+
+// APIKeyHash returns the hash API keys are stored under.
+func APIKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *apiKeyRepository) GetAPIKey(ctx context.Context, key string) (*domain.APIKey, error) {
+	fields, err := r.rdb.HGetAll(ctx, apiKeyPrefix+APIKeyHash(key)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, domain.ErrAPIKeyNotFound
+	}
+
+	return &domain.APIKey{
+		Name:     fields["name"],
+		Plan:     fields["plan"],
+		Disabled: parseFlag(fields["disabled"]),
+		Admin:    parseFlag(fields["admin"]),
+	}, nil
+}
+
+// parseFlag reads a boolean field of an API key, set with 1 or true.
+func parseFlag(v string) bool {
+	return v == "1" || v == "true"
+}
@@ -2,92 +2,135 @@ package repository
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"time"
 
+	"example.com/bus"
+	"example.com/contract"
 	"example.com/main-service/internal/domain"
+	"example.com/telemetry"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 //go:generate mockery --name=IFlightRepository
 type IFlightRepository interface {
 	PublishSearchRequest(ctx context.Context, req domain.FlightSearchRequest) error
-	ConsumeSearchResults(ctx context.Context, searchID string) <-chan domain.FlightSearchResult
+	ConsumeSearchResults(ctx context.Context, searchID, lastEventID string) <-chan domain.FlightSearchResult
+	SaveSearchState(ctx context.Context, state domain.SearchState) error
+	GetSearchState(ctx context.Context, searchID string) (*domain.SearchState, error)
+	CancelSearch(ctx context.Context, searchID string) error
+	AddSearchWatchers(ctx context.Context, searchID, transport string, delta int64) (int64, error)
+	MarkSearchFinished(ctx context.Context, searchID string) (bool, error)
+	GetCachedResults(ctx context.Context, key string) (map[string]domain.FlightSearchResult, error)
+	CacheResults(ctx context.Context, key string, results map[string]domain.FlightSearchResult, ttl time.Duration) error
+	IncrCacheStat(ctx context.Context, stat string) error
+	GetCacheStats(ctx context.Context) (domain.CacheStats, error)
+	ReserveIdempotencyKey(ctx context.Context, key string, rec domain.IdempotencyRecord, ttl time.Duration) (domain.IdempotencyRecord, bool, error)
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
 }
 
 type flightRepository struct {
-	rdb *redis.Client
-	log *zap.Logger
+	rdb       *redis.Client
+	bus       bus.IPublisher
+	hub       *ResultHub
+	streams   domain.Streams
+	encoder   contract.Encoder
+	retention time.Duration
+	log       *zap.Logger
 }
 
-func NewFlightRepository(rdb *redis.Client, log *zap.Logger) IFlightRepository {
+// NewFlightRepository creates the repository. Search state lives in rdb;
+// messages are published through b in the schema version of encoder to
+// streams, which are trimmed to the entries of the last retention on every
+// publish; zero keeps them all.
+func NewFlightRepository(rdb *redis.Client, b bus.IPublisher, hub *ResultHub, streams domain.Streams, encoder contract.Encoder, retention time.Duration, log *zap.Logger) IFlightRepository {
 	return &flightRepository{
-		rdb: rdb,
-		log: log,
+		rdb:       rdb,
+		bus:       b,
+		hub:       hub,
+		streams:   streams,
+		encoder:   encoder,
+		retention: retention,
+		log:       log,
 	}
 }
 
 func (r *flightRepository) PublishSearchRequest(ctx context.Context, req domain.FlightSearchRequest) error {
-	err := r.rdb.XAdd(ctx, &redis.XAddArgs{
-		Stream: domain.StreamFlightSearchRequested,
-		Values: map[string]interface{}{
-			"search_id": req.SearchID,
-			"from":      req.From,
-			"to":        req.To,
-			"date":      req.Date,
-		},
-	}).Err()
+	values, err := r.encoder.SearchRequested(req.Message())
+	if err != nil {
+		return fmt.Errorf("failed to encode search request: %w", err)
+	}
+
+	ctx, span := startPublishSpan(ctx, r.streams.Requested, req.SearchID)
+	defer span.End()
+	telemetry.InjectStream(ctx, values)
+
+	_, err = r.bus.Publish(ctx, r.streams.Requested, values, r.retention)
 
 	if err != nil {
 		r.log.Error("Failed to publish search request", zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
 	r.log.Info("Published search request to Redis stream",
-		zap.String("stream", domain.StreamFlightSearchRequested),
+		zap.String("stream", r.streams.Requested),
 		zap.String("search_id", req.SearchID),
 	)
 	return nil
 }
 
-func (r *flightRepository) ConsumeSearchResults(ctx context.Context, searchID string) <-chan domain.FlightSearchResult {
-	results := make(chan domain.FlightSearchResult)
-
-	go func() {
-		defer close(results)
-
-		lastID := "0"
-
-		for {
-			streams, err := r.rdb.XRead(ctx, &redis.XReadArgs{
-				Streams: []string{domain.StreamFlightSearchResults, lastID},
-				Block:   0,
-			}).Result()
-			if err != nil {
-				if err == redis.Nil {
-					continue
-				}
-				r.log.Error("Error reading from Redis stream", zap.Error(err))
-				return
-			}
-
-			for _, stream := range streams {
-				for _, msg := range stream.Messages {
-					var res domain.FlightSearchResult
-					if raw, ok := msg.Values["data"].(string); ok {
-						if err := json.Unmarshal([]byte(raw), &res); err != nil {
-							r.log.Error("Failed to unmarshal search result", zap.Error(err))
-							continue
-						}
-						if res.SearchID == searchID {
-							results <- res
-						}
-					}
-					lastID = msg.ID
-				}
-			}
-		}
-	}()
-
-	return results
+func (r *flightRepository) ConsumeSearchResults(ctx context.Context, searchID, lastEventID string) <-chan domain.FlightSearchResult {
+	return r.hub.Subscribe(ctx, searchID, lastEventID)
+}
+
+// CancelSearch marks the search as cancelled and finished, and publishes
+// the cancellation for the providers and every ResultHub. It returns
+// domain.ErrSearchFinished when the search already finished.
+func (r *flightRepository) CancelSearch(ctx context.Context, searchID string) error {
+	if err := cancelSearchState(ctx, r.rdb, searchID); err != nil {
+		return err
+	}
+
+	values, err := r.encoder.SearchCancelled(contract.SearchCancelled{SearchID: searchID})
+	if err != nil {
+		return fmt.Errorf("failed to encode search cancellation: %w", err)
+	}
+
+	ctx, span := startPublishSpan(ctx, r.streams.Cancelled, searchID)
+	defer span.End()
+	telemetry.InjectStream(ctx, values)
+
+	_, err = r.bus.Publish(ctx, r.streams.Cancelled, values, r.retention)
+	if err != nil {
+		r.log.Error("Failed to publish search cancellation", zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	r.log.Info("Published search cancellation to Redis stream",
+		zap.String("stream", r.streams.Cancelled),
+		zap.String("search_id", searchID),
+	)
+	return nil
+}
+
+// startPublishSpan starts the producer span of a message about to be added
+// to stream; its context is what consumers continue.
+func startPublishSpan(ctx context.Context, stream, searchID string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, stream+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			telemetry.MessagingSystem,
+			semconv.MessagingDestinationName(stream),
+			attribute.String("search_id", searchID),
+		),
+	)
 }
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const idempotencyKeyPrefix = "flight.search.idempotency:"
+
+// reserveIdempotencyScript stores a record under a free key and returns
+// nothing, or returns the record the key already holds. Checking and
+// setting in one step keeps the key from expiring in between.
+//
+// KEYS[1] the idempotency key; ARGV: record, TTL (ms).
+var reserveIdempotencyScript = redis.NewScript(`
+local existing = redis.call('GET', KEYS[1])
+if existing then
+	return existing
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return false
+`)
+
+// ReserveIdempotencyKey stores rec under key for ttl unless the key is
+// already taken. It returns the record the key holds and whether it was
+// reserved by this call.
+func (r *flightRepository) ReserveIdempotencyKey(ctx context.Context, key string, rec domain.IdempotencyRecord, ttl time.Duration) (domain.IdempotencyRecord, bool, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return domain.IdempotencyRecord{}, false, fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	raw, err := reserveIdempotencyScript.Run(ctx, r.rdb, []string{idempotencyKeyPrefix + key}, data, ttl.Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return rec, true, nil
+	}
+	if err != nil {
+		return domain.IdempotencyRecord{}, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	var existing domain.IdempotencyRecord
+	if err := json.Unmarshal([]byte(raw), &existing); err != nil {
+		return domain.IdempotencyRecord{}, false, fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+	}
+	return existing, false, nil
+}
+
+// ReleaseIdempotencyKey frees key so that a retry of a search that could not
+// be started is not answered with a search that does not exist.
+func (r *flightRepository) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	if err := r.rdb.Del(ctx, idempotencyKeyPrefix+key).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/contract"
+	"example.com/main-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestRedis(t)
+	repo := NewFlightRepository(rdb, nil, nil, domain.DefaultStreams, contract.Encoder{}, 0, zap.NewNop())
+
+	first := domain.IdempotencyRecord{Fingerprint: "fp", SearchID: "s1"}
+	rec, reserved, err := repo.ReserveIdempotencyKey(ctx, "client:key", first, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, first, rec)
+
+	// A retry gets the record of the first request.
+	rec, reserved, err = repo.ReserveIdempotencyKey(ctx, "client:key", domain.IdempotencyRecord{Fingerprint: "fp", SearchID: "s2"}, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, first, rec)
+
+	// Once expired, the key is free again.
+	mr.FastForward(time.Minute)
+	second := domain.IdempotencyRecord{Fingerprint: "fp", SearchID: "s3"}
+	rec, reserved, err = repo.ReserveIdempotencyKey(ctx, "client:key", second, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, second, rec)
+}
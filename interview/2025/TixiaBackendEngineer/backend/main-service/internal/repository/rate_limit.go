@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitPrefix = "flight.ratelimit:"
+
+// slidingWindowScript keeps one sorted set entry per request of the last
+// window. It drops the entries that left the window and, if fewer than the
+// limit remain, counts the request. It returns whether the request was
+// allowed, the number of requests in the window and the age in milliseconds
+// of the oldest one.
+//
+// KEYS[1] the window key; ARGV: now (ms), window (ms), limit, member.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', key, window)
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local age = 0
+if oldest[2] then
+	age = now - tonumber(oldest[2])
+end
+return {allowed, count, age}
+`)
+
+//go:generate mockery --name=IRateLimitRepository
+type IRateLimitRepository interface {
+	// Allow counts one request against the limit of bucket over a sliding
+	// window.
+	Allow(ctx context.Context, bucket string, limit int, window time.Duration) (domain.RateLimitResult, error)
+}
+
+// rateLimitRepository keeps the windows in Redis so that every prefork
+// child enforces the same limits.
+type rateLimitRepository struct {
+	rdb *redis.Client
+}
+
+func NewRateLimitRepository(rdb *redis.Client) IRateLimitRepository {
+	return &rateLimitRepository{rdb: rdb}
+}
+
+func (r *rateLimitRepository) Allow(ctx context.Context, bucket string, limit int, window time.Duration) (domain.RateLimitResult, error) {
+	now := time.Now().UnixMilli()
+	res, err := slidingWindowScript.Run(ctx, r.rdb,
+		[]string{rateLimitPrefix + bucket},
+		now, window.Milliseconds(), limit, fmt.Sprintf("%d-%s", now, uuid.NewString()),
+	).Int64Slice()
+	if err != nil {
+		return domain.RateLimitResult{}, fmt.Errorf("failed to apply rate limit: %w", err)
+	}
+
+	allowed, count, age := res[0] == 1, int(res[1]), time.Duration(res[2])*time.Millisecond
+	result := domain.RateLimitResult{
+		Allowed:    allowed,
+		Limit:      limit,
+		Remaining:  max(limit-count, 0),
+		ResetAfter: window - age,
+	}
+	if !allowed {
+		// A slot frees up when the oldest request leaves the window.
+		result.RetryAfter = window - age
+	}
+	return result, nil
+}
@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/bus"
+	"example.com/contract"
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/metrics"
+	"example.com/telemetry"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("example.com/main-service/internal/repository")
+
+const (
+	// resultRetention is how long results stay buffered in the hub so that a
+	// client subscribing after the provider answered still receives them.
+	resultRetention = 10 * time.Minute
+	// subscriberBuffer is the number of live results a subscriber may lag
+	// behind before the hub drops it.
+	subscriberBuffer = 16
+)
+
+// ResultHub tails the results and cancellation streams with a single reader
+// and fans every message out to the subscribers of its search ID, so the number of Redis
+// reads no longer grows with the number of connected clients.
+type ResultHub struct {
+	rdb     *redis.Client
+	bus     bus.ISubscriber
+	streams domain.Streams
+	log     *zap.Logger
+
+	// onRecorded is called with the ID of every search this process
+	// recorded a result of.
+	onRecorded func(ctx context.Context, searchID string)
+
+	// liveFrom is the stream ID at which the hub started; earlier messages
+	// are replays and stay out of the latency metrics.
+	liveFrom string
+	// lastProgress is when the read loop last completed a read, in Unix
+	// nanoseconds; zero until it starts.
+	lastProgress atomic.Int64
+
+	mu       sync.Mutex
+	searches map[string]*hubSearch
+}
+
+type hubSearch struct {
+	results   []domain.FlightSearchResult
+	subs      map[chan domain.FlightSearchResult]struct{}
+	updatedAt time.Time
+}
+
+// NewResultHub creates a hub reading the streams through b and recording
+// the results in rdb.
+func NewResultHub(rdb *redis.Client, b bus.ISubscriber, streams domain.Streams, log *zap.Logger) *ResultHub {
+	return &ResultHub{
+		rdb:      rdb,
+		bus:      b,
+		streams:  streams,
+		log:      log,
+		searches: make(map[string]*hubSearch),
+	}
+}
+
+// OnRecorded registers fn to be called whenever this process records a
+// provider result. Only one process records each result, so fn sees every
+// result once across all processes. It must be set before Start.
+func (h *ResultHub) OnRecorded(fn func(ctx context.Context, searchID string)) {
+	h.onRecorded = fn
+}
+
+// Start reads the results stream until ctx is cancelled. It begins
+// resultRetention in the past so results published shortly before the
+// process started can still be replayed.
+func (h *ResultHub) Start(ctx context.Context) error {
+	h.log.Info("Starting ResultHub...")
+	defer h.closeAll()
+
+	now := time.Now()
+	h.liveFrom = fmt.Sprintf("%d-0", now.UnixMilli())
+	startID := fmt.Sprintf("%d-0", now.Add(-resultRetention).UnixMilli())
+	lastIDs := map[string]string{
+		h.streams.Results:   startID,
+		h.streams.Cancelled: startID,
+	}
+	lastPrune := time.Now()
+	h.lastProgress.Store(now.UnixNano())
+
+	for {
+		if ctx.Err() != nil {
+			h.log.Info("ResultHub received shutdown signal, exiting loop...")
+			return nil
+		}
+
+		messages, err := h.bus.Read(ctx, bus.ReadArgs{
+			Streams: lastIDs,
+			Count:   100,
+			Block:   5 * time.Second,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			h.log.Error("Error reading from Redis stream", zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+		h.lastProgress.Store(time.Now().UnixNano())
+
+		for _, msg := range messages {
+			lastIDs[msg.Stream] = msg.ID
+			metrics.StreamMessages.WithLabelValues(msg.Stream, metrics.OutcomeRead).Inc()
+			if msg.Stream == h.streams.Cancelled {
+				h.handleCancellation(msg)
+			} else {
+				h.handleResult(ctx, msg)
+			}
+		}
+
+		if time.Since(lastPrune) > time.Minute {
+			h.prune()
+			lastPrune = time.Now()
+		}
+	}
+}
+
+// Ready reports whether the read loop completed a read within staleAfter.
+// Reads block for at most 5 seconds, so a loop that stays silent longer is
+// stuck and streamed searches would receive nothing.
+func (h *ResultHub) Ready(staleAfter time.Duration) error {
+	last := h.lastProgress.Load()
+	if last == 0 {
+		return errors.New("result hub has not started")
+	}
+	if idle := time.Since(time.Unix(0, last)); idle > staleAfter {
+		return fmt.Errorf("result hub made no progress for %s", idle.Round(time.Second))
+	}
+	return nil
+}
+
+func (h *ResultHub) handleResult(ctx context.Context, msg bus.Message) {
+	m, meta, err := contract.DecodeSearchResult(msg.Values)
+	if err != nil {
+		h.log.Error("Invalid search result",
+			zap.String("id", msg.ID),
+			zap.Int("schema_version", meta.SchemaVersion),
+			zap.String("producer", meta.Producer),
+			zap.Error(err),
+		)
+		metrics.StreamMessages.WithLabelValues(h.streams.Results, metrics.OutcomeFailed).Inc()
+		return
+	}
+	res := domain.NewFlightSearchResult(m)
+	res.EventID = msg.ID
+
+	// The receive span continues the trace of the search through the
+	// provider that published the result.
+	ctx, span := tracer.Start(telemetry.ExtractStream(ctx, msg.Values), h.streams.Results+" receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			telemetry.MessagingSystem,
+			semconv.MessagingDestinationName(h.streams.Results),
+			semconv.MessagingMessageID(msg.ID),
+			attribute.String("search_id", res.SearchID),
+			attribute.String("provider_id", res.ProviderID),
+			attribute.Int("schema_version", meta.SchemaVersion),
+		),
+	)
+	defer span.End()
+	carrier := telemetry.StreamCarrier{}
+	telemetry.InjectStream(ctx, carrier)
+	res.TraceParent = carrier.Get("traceparent")
+
+	recorded, err := recordSearchResult(ctx, h.rdb, res)
+	switch {
+	case err != nil:
+		h.log.Error("Failed to record search result", zap.String("search_id", res.SearchID), zap.Error(err))
+		metrics.StreamMessages.WithLabelValues(h.streams.Results, metrics.OutcomeFailed).Inc()
+		span.RecordError(err)
+	case recorded.CreatedAt.IsZero():
+		h.log.Debug("Result of an unknown or expired search", zap.String("search_id", res.SearchID))
+	}
+	h.dispatch(res)
+	if recorded.Written && h.onRecorded != nil {
+		h.onRecorded(ctx, res.SearchID)
+	}
+
+	// Every process sees every result; only the one that recorded the first
+	// result of the search observes its latency.
+	if recorded.First && domain.CompareStreamIDs(msg.ID, h.liveFrom) >= 0 {
+		metrics.TimeToFirstResult.Observe(time.Since(recorded.CreatedAt).Seconds())
+	}
+}
+
+// handleCancellation hands subscribers a result carrying only the cancelled
+// status; the search state was already updated by the cancelling process.
+func (h *ResultHub) handleCancellation(msg bus.Message) {
+	m, meta, err := contract.DecodeSearchCancelled(msg.Values)
+	if err != nil {
+		h.log.Error("Invalid search cancellation",
+			zap.String("id", msg.ID),
+			zap.Int("schema_version", meta.SchemaVersion),
+			zap.Error(err),
+		)
+		metrics.StreamMessages.WithLabelValues(h.streams.Cancelled, metrics.OutcomeFailed).Inc()
+		return
+	}
+	h.dispatch(domain.FlightSearchResult{
+		SearchID: m.SearchID,
+		Status:   domain.SearchStatusCancelled,
+		EventID:  msg.ID,
+	})
+}
+
+// Subscribe returns a channel receiving every result of searchID, starting
+// with the buffered ones whose event ID comes after afterID (all of them
+// when afterID is empty). The channel is closed once ctx is done.
+func (h *ResultHub) Subscribe(ctx context.Context, searchID, afterID string) <-chan domain.FlightSearchResult {
+	h.mu.Lock()
+	s := h.search(searchID)
+	ch := make(chan domain.FlightSearchResult, len(s.results)+subscriberBuffer)
+	for _, res := range s.results {
+		if domain.CompareStreamIDs(res.EventID, afterID) > 0 {
+			ch <- res
+		}
+	}
+	s.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.unsubscribe(searchID, ch)
+	}()
+
+	return ch
+}
+
+// dispatch buffers res and hands it to the subscribers of its search.
+func (h *ResultHub) dispatch(res domain.FlightSearchResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.search(res.SearchID)
+	s.results = append(s.results, res)
+	for ch := range s.subs {
+		select {
+		case ch <- res:
+		default:
+			h.log.Warn("Dropping slow subscriber", zap.String("search_id", res.SearchID))
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *ResultHub) unsubscribe(searchID string, ch chan domain.FlightSearchResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.searches[searchID]
+	if !ok {
+		return
+	}
+	if _, ok := s.subs[ch]; ok {
+		delete(s.subs, ch)
+		close(ch)
+	}
+	s.updatedAt = time.Now()
+}
+
+// search returns the entry for searchID, creating it if needed. The caller
+// must hold h.mu.
+func (h *ResultHub) search(searchID string) *hubSearch {
+	s, ok := h.searches[searchID]
+	if !ok {
+		s = &hubSearch{subs: make(map[chan domain.FlightSearchResult]struct{})}
+		h.searches[searchID] = s
+	}
+	s.updatedAt = time.Now()
+	return s
+}
+
+func (h *ResultHub) prune() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := time.Now().Add(-resultRetention)
+	for id, s := range h.searches {
+		if len(s.subs) == 0 && s.updatedAt.Before(cutoff) {
+			delete(h.searches, id)
+		}
+	}
+}
+
+func (h *ResultHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, s := range h.searches {
+		for ch := range s.subs {
+			close(ch)
+		}
+		delete(h.searches, id)
+	}
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	searchCacheKeyPrefix = "flight.search.cache:"
+	// searchCacheStatsKey is shared by all processes so the counts cover
+	// every prefork child.
+	searchCacheStatsKey = "flight.search.cache.stats"
+)
+
+// Fields of searchCacheStatsKey.
+const (
+	CacheStatHit    = "hits"
+	CacheStatMiss   = "misses"
+	CacheStatBypass = "bypasses"
+)
+
+// GetCachedResults returns the provider results cached under key, or
+// domain.ErrCacheMiss.
+func (r *flightRepository) GetCachedResults(ctx context.Context, key string) (map[string]domain.FlightSearchResult, error) {
+	raw, err := r.rdb.Get(ctx, searchCacheKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, domain.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached results: %w", err)
+	}
+
+	var stored map[string]storedResult
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached results: %w", err)
+	}
+	results := make(map[string]domain.FlightSearchResult, len(stored))
+	for providerID, s := range stored {
+		s.Result.EventID = s.EventID
+		results[providerID] = s.Result
+	}
+	return results, nil
+}
+
+// CacheResults caches the provider results of a completed search under key
+// for ttl. An existing entry is kept, so the entry expires ttl after the
+// first search that filled it no matter how often it is viewed.
+func (r *flightRepository) CacheResults(ctx context.Context, key string, results map[string]domain.FlightSearchResult, ttl time.Duration) error {
+	stored := make(map[string]storedResult, len(results))
+	for providerID, res := range results {
+		stored[providerID] = storedResult{EventID: res.EventID, Result: res}
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached results: %w", err)
+	}
+
+	if err := r.rdb.SetNX(ctx, searchCacheKeyPrefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to cache results: %w", err)
+	}
+	return nil
+}
+
+func (r *flightRepository) IncrCacheStat(ctx context.Context, stat string) error {
+	if err := r.rdb.HIncrBy(ctx, searchCacheStatsKey, stat, 1).Err(); err != nil {
+		return fmt.Errorf("failed to count cache %s: %w", stat, err)
+	}
+	return nil
+}
+
+func (r *flightRepository) GetCacheStats(ctx context.Context) (domain.CacheStats, error) {
+	fields, err := r.rdb.HGetAll(ctx, searchCacheStatsKey).Result()
+	if err != nil {
+		return domain.CacheStats{}, fmt.Errorf("failed to get cache stats: %w", err)
+	}
+
+	var stats domain.CacheStats
+	stats.Hits, _ = strconv.ParseInt(fields[CacheStatHit], 10, 64)
+	stats.Misses, _ = strconv.ParseInt(fields[CacheStatMiss], 10, 64)
+	stats.Bypasses, _ = strconv.ParseInt(fields[CacheStatBypass], 10, 64)
+	return stats, nil
+}
@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	searchStateKeyPrefix = "flight.search.state:"
+	searchStateTTL       = domain.SearchStateTTL
+	// activeSearchesKey is a sorted set of the searches started with
+	// providers to wait for, scored by their deadline. Searches leave it when
+	// they finish or get cancelled, or else once their deadline has passed.
+	activeSearchesKey = "flight.search.active"
+	// watchersFieldPrefix is followed by a transport and counts the
+	// watchers following the search over it.
+	watchersFieldPrefix = "watchers:"
+)
+
+func searchStateKey(searchID string) string {
+	return searchStateKeyPrefix + searchID
+}
+
+func (r *flightRepository) SaveSearchState(ctx context.Context, state domain.SearchState) error {
+	request, err := json.Marshal(state.Request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal search request: %w", err)
+	}
+	providers, err := marshalOrEmpty(state.ExpectedProviders)
+	if err != nil {
+		return fmt.Errorf("failed to marshal expected providers: %w", err)
+	}
+
+	key := searchStateKey(state.SearchID)
+	now := strconv.FormatInt(state.CreatedAt.UnixMilli(), 10)
+
+	values := []interface{}{
+		"search_id", state.SearchID,
+		"status", state.Status,
+		"request", request,
+		"providers", providers,
+		"created_at", now,
+		"updated_at", now,
+		"expires_at", strconv.FormatInt(state.ExpiresAt.UnixMilli(), 10),
+		"providers_due_at", strconv.FormatInt(state.ProvidersDueAt.UnixMilli(), 10),
+	}
+	if state.CacheKey != "" {
+		values = append(values, "cache_key", state.CacheKey)
+	}
+	// Results known upfront, such as cached ones, are stored the same way
+	// the ResultHub records them.
+	for providerID, res := range state.ProviderResults {
+		data, err := json.Marshal(storedResult{EventID: res.EventID, Result: res})
+		if err != nil {
+			return fmt.Errorf("failed to marshal result of provider %s: %w", providerID, err)
+		}
+		values = append(values, providerResultFieldPrefix+providerID, data)
+	}
+
+	pipe := r.rdb.TxPipeline()
+	pipe.HSet(ctx, key, values...)
+	pipe.Expire(ctx, key, searchStateTTL)
+	if !domain.IsTerminalStatus(state.Status) {
+		pipe.ZAdd(ctx, activeSearchesKey, redis.Z{Score: float64(state.ExpiresAt.UnixMilli()), Member: state.SearchID})
+		pipe.ZRemRangeByScore(ctx, activeSearchesKey, "-inf", "("+strconv.FormatInt(time.Now().UnixMilli(), 10))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save search state: %w", err)
+	}
+	return nil
+}
+
+// GetSearchState returns the stored search with its raw provider results;
+// aggregating them is left to the caller.
+func (r *flightRepository) GetSearchState(ctx context.Context, searchID string) (*domain.SearchState, error) {
+	fields, err := r.rdb.HGetAll(ctx, searchStateKey(searchID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get search state: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, domain.ErrSearchNotFound
+	}
+	return parseSearchState(searchID, fields)
+}
+
+// parseSearchState reads the fields of a stored search.
+func parseSearchState(searchID string, fields map[string]string) (*domain.SearchState, error) {
+	state := &domain.SearchState{
+		SearchID:          searchID,
+		Status:            fields["status"],
+		ProviderResults:   make(map[string]domain.FlightSearchResult),
+		TransportWatchers: make(map[string]int64),
+		CreatedAt:         parseMillis(fields["created_at"]),
+		UpdatedAt:         parseMillis(fields["updated_at"]),
+		ExpiresAt:         parseMillis(fields["expires_at"]),
+		ProvidersDueAt:    parseMillis(fields["providers_due_at"]),
+		CacheKey:          fields["cache_key"],
+	}
+	state.Watchers, _ = strconv.ParseInt(fields["watchers"], 10, 64)
+	if raw := fields["request"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &state.Request); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal search request: %w", err)
+		}
+	}
+	if raw := fields["providers"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &state.ExpectedProviders); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal expected providers: %w", err)
+		}
+	}
+
+	for field, raw := range fields {
+		if transport, ok := strings.CutPrefix(field, watchersFieldPrefix); ok {
+			state.TransportWatchers[transport], _ = strconv.ParseInt(raw, 10, 64)
+			continue
+		}
+		providerID, ok := strings.CutPrefix(field, providerResultFieldPrefix)
+		if !ok {
+			continue
+		}
+		var stored storedResult
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal result of provider %s: %w", providerID, err)
+		}
+		stored.Result.EventID = stored.EventID
+		state.ProviderResults[providerID] = stored.Result
+		if domain.CompareStreamIDs(stored.EventID, state.LastEventID) > 0 {
+			state.LastEventID = stored.EventID
+		}
+	}
+	return state, nil
+}
+
+// cancelSearchScript marks a search cancelled and finished and takes it off
+// the active searches, unless it does not exist or already finished. It
+// returns 1 once cancelled, 0 when the search already finished and -1 when
+// it is unknown.
+//
+// KEYS[1] the search state key, KEYS[2] the active searches; ARGV: now
+// (ms), TTL (ms), search ID.
+var cancelSearchScript = redis.NewScript(`
+local key = KEYS[1]
+if redis.call('EXISTS', key) == 0 then
+	return -1
+end
+if redis.call('HSETNX', key, 'finished_at', ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', key, 'status', 'cancelled', 'updated_at', ARGV[1])
+redis.call('PEXPIRE', key, ARGV[2])
+redis.call('ZREM', KEYS[2], ARGV[3])
+return 1
+`)
+
+// cancelSearchState marks the search cancelled in a single step, so that
+// only one of the processes racing to cancel or finish it wins.
+func cancelSearchState(ctx context.Context, rdb *redis.Client, searchID string) error {
+	res, err := cancelSearchScript.Run(ctx, rdb, []string{searchStateKey(searchID), activeSearchesKey},
+		time.Now().UnixMilli(),
+		searchStateTTL.Milliseconds(),
+		searchID,
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to cancel search: %w", err)
+	}
+	switch res {
+	case -1:
+		return domain.ErrSearchNotFound
+	case 0:
+		return domain.ErrSearchFinished
+	}
+	return nil
+}
+
+// AddSearchWatchers adjusts the number of clients following the search
+// over transport across all processes and returns the new count of all
+// transports.
+func (r *flightRepository) AddSearchWatchers(ctx context.Context, searchID, transport string, delta int64) (int64, error) {
+	key := searchStateKey(searchID)
+	pipe := r.rdb.TxPipeline()
+	watchers := pipe.HIncrBy(ctx, key, "watchers", delta)
+	pipe.HIncrBy(ctx, key, watchersFieldPrefix+transport, delta)
+	pipe.Expire(ctx, key, searchStateTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to update search watchers: %w", err)
+	}
+	return watchers.Val(), nil
+}
+
+// MarkSearchFinished records that the search reached a final status, takes
+// it off the active searches and reports whether this call was the first
+// to do so, across all processes.
+func (r *flightRepository) MarkSearchFinished(ctx context.Context, searchID string) (bool, error) {
+	key := searchStateKey(searchID)
+	pipe := r.rdb.TxPipeline()
+	first := pipe.HSetNX(ctx, key, "finished_at", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	pipe.Expire(ctx, key, searchStateTTL)
+	pipe.ZRem(ctx, activeSearchesKey, searchID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to mark search finished: %w", err)
+	}
+	return first.Val(), nil
+}
+
+const providerResultFieldPrefix = "result:"
+
+// storedResult keeps the stream entry ID next to the result, since the ID
+// is not part of the result's JSON.
+type storedResult struct {
+	EventID string                    `json:"event_id"`
+	Result  domain.FlightSearchResult `json:"result"`
+}
+
+// recordResultScript stores a provider result on the state of a known
+// search, once per stream entry: every process running a ResultHub reads
+// the same entry, and only the first to claim its event ID writes it. It
+// returns whether the result was written, whether it is the first result
+// of the search, and when the search was created, which is empty for
+// unknown or expired searches.
+//
+// KEYS[1] the search state key; ARGV: event field, result field, result,
+// now (ms), TTL (ms).
+var recordResultScript = redis.NewScript(`
+local key = KEYS[1]
+local created = redis.call('HGET', key, 'created_at')
+if not created then
+	return {0, 0, ''}
+end
+if redis.call('HSETNX', key, ARGV[1], ARGV[4]) == 0 then
+	return {0, 0, created}
+end
+local first = redis.call('HSETNX', key, 'first_result_at', ARGV[4])
+redis.call('HSET', key, ARGV[2], ARGV[3], 'updated_at', ARGV[4])
+redis.call('PEXPIRE', key, ARGV[5])
+return {1, first, created}
+`)
+
+// recordedEventFieldPrefix is followed by the stream entry ID of a recorded
+// result.
+const recordedEventFieldPrefix = "event:"
+
+// recordedResult tells how recordSearchResult went.
+type recordedResult struct {
+	// Written is set for the one call that stored the result.
+	Written bool
+	// First is set when the result written is the first of its search.
+	First bool
+	// CreatedAt is when the search was created; zero when it is unknown
+	// or expired and nothing was written.
+	CreatedAt time.Time
+}
+
+// recordSearchResult stores a provider result on the search state under its
+// own field.
+func recordSearchResult(ctx context.Context, rdb *redis.Client, res domain.FlightSearchResult) (recordedResult, error) {
+	providerID := res.ProviderID
+	if providerID == "" {
+		providerID = domain.DefaultProviderID
+	}
+
+	data, err := json.Marshal(storedResult{EventID: res.EventID, Result: res})
+	if err != nil {
+		return recordedResult{}, fmt.Errorf("failed to marshal search result: %w", err)
+	}
+
+	reply, err := recordResultScript.Run(ctx, rdb, []string{searchStateKey(res.SearchID)},
+		recordedEventFieldPrefix+res.EventID,
+		providerResultFieldPrefix+providerID,
+		data,
+		time.Now().UnixMilli(),
+		searchStateTTL.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return recordedResult{}, fmt.Errorf("failed to record search result: %w", err)
+	}
+	written, _ := reply[0].(int64)
+	first, _ := reply[1].(int64)
+	createdAt, _ := reply[2].(string)
+	return recordedResult{Written: written == 1, First: first == 1, CreatedAt: parseMillis(createdAt)}, nil
+}
+
+// marshalOrEmpty encodes a nil slice as [] rather than null.
+func marshalOrEmpty[T any](v []T) ([]byte, error) {
+	if v == nil {
+		v = []T{}
+	}
+	return json.Marshal(v)
+}
+
+func parseMillis(v string) time.Time {
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/contract"
+	"example.com/main-service/internal/domain"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return mr, rdb
+}
+
+func TestRecordSearchResult(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestRedis(t)
+	repo := NewFlightRepository(rdb, nil, nil, domain.DefaultStreams, contract.Encoder{}, 0, zap.NewNop())
+
+	res := domain.FlightSearchResult{SearchID: "s1", ProviderID: "garuda", Status: domain.SearchStatusCompleted, EventID: "100-0"}
+
+	// Results of searches this service does not know are not stored.
+	recorded, err := recordSearchResult(ctx, rdb, res)
+	require.NoError(t, err)
+	assert.Equal(t, recordedResult{}, recorded)
+	assert.False(t, mr.Exists(searchStateKey("s1")))
+
+	created := time.UnixMilli(time.Now().UnixMilli())
+	require.NoError(t, repo.SaveSearchState(ctx, domain.SearchState{
+		SearchID:  "s1",
+		Status:    domain.SearchStatusProcessing,
+		CreatedAt: created,
+		ExpiresAt: created.Add(time.Minute),
+	}))
+
+	// Every process reads the entry; only the first writes it.
+	recorded, err = recordSearchResult(ctx, rdb, res)
+	require.NoError(t, err)
+	assert.Equal(t, recordedResult{Written: true, First: true, CreatedAt: created}, recorded)
+
+	recorded, err = recordSearchResult(ctx, rdb, res)
+	require.NoError(t, err)
+	assert.Equal(t, recordedResult{CreatedAt: created}, recorded)
+
+	// Later results of the search are written but are not its first.
+	lion := res
+	lion.ProviderID, lion.EventID = "lion", "101-0"
+	recorded, err = recordSearchResult(ctx, rdb, lion)
+	require.NoError(t, err)
+	assert.Equal(t, recordedResult{Written: true, CreatedAt: created}, recorded)
+
+	state, err := repo.GetSearchState(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "100-0", state.ProviderResults["garuda"].EventID)
+	assert.Equal(t, "101-0", state.LastEventID)
+}
+
+func TestCancelSearchState(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newTestRedis(t)
+	repo := NewFlightRepository(rdb, nil, nil, domain.DefaultStreams, contract.Encoder{}, 0, zap.NewNop())
+
+	assert.ErrorIs(t, cancelSearchState(ctx, rdb, "unknown"), domain.ErrSearchNotFound)
+
+	now := time.Now()
+	for _, id := range []string{"running", "finished"} {
+		require.NoError(t, repo.SaveSearchState(ctx, domain.SearchState{
+			SearchID:  id,
+			Status:    domain.SearchStatusProcessing,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Minute),
+		}))
+	}
+
+	// Only the first of two racing cancellations wins.
+	require.NoError(t, cancelSearchState(ctx, rdb, "running"))
+	assert.ErrorIs(t, cancelSearchState(ctx, rdb, "running"), domain.ErrSearchFinished)
+	state, err := repo.GetSearchState(ctx, "running")
+	require.NoError(t, err)
+	assert.Equal(t, domain.SearchStatusCancelled, state.Status)
+
+	// The search counted as finished first is not cancelled, nor counted again.
+	first, err := repo.MarkSearchFinished(ctx, "finished")
+	require.NoError(t, err)
+	require.True(t, first)
+	assert.ErrorIs(t, cancelSearchState(ctx, rdb, "finished"), domain.ErrSearchFinished)
+	state, err = repo.GetSearchState(ctx, "finished")
+	require.NoError(t, err)
+	assert.Equal(t, domain.SearchStatusProcessing, state.Status)
+
+	first, err = repo.MarkSearchFinished(ctx, "running")
+	require.NoError(t, err)
+	assert.False(t, first)
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"example.com/bus"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const streamJanitorLockKey = "flight.stream.janitor.lock"
+
+// StreamJanitorConfig sets what the janitor keeps.
+type StreamJanitorConfig struct {
+	// Retention is the minimum age of the entries trimmed from the streams.
+	// Trimming is approximate, so slightly older entries may remain.
+	Retention time.Duration
+	// IdleTimeout is how long a pending entry or a consumer may stay idle in
+	// a consumer group. Idle pending entries are acknowledged without being
+	// processed and idle consumers without pending entries are deleted.
+	IdleTimeout time.Duration
+	// Interval is how often the janitor runs.
+	Interval time.Duration
+	// Streams are the streams the janitor looks after.
+	Streams []string
+}
+
+// StreamJanitor trims the search streams and cleans up their consumer
+// groups. Every process may run one; a lock makes only one of them work per
+// interval.
+type StreamJanitor struct {
+	rdb *redis.Client
+	cfg StreamJanitorConfig
+	log *zap.Logger
+}
+
+func NewStreamJanitor(rdb *redis.Client, cfg StreamJanitorConfig, log *zap.Logger) *StreamJanitor {
+	return &StreamJanitor{
+		rdb: rdb,
+		cfg: cfg,
+		log: log,
+	}
+}
+
+// Start runs the janitor until ctx is cancelled.
+func (j *StreamJanitor) Start(ctx context.Context) {
+	if j.cfg.Interval <= 0 {
+		return
+	}
+	j.log.Info("Starting StreamJanitor...")
+
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			j.log.Info("StreamJanitor received shutdown signal, exiting loop...")
+			return
+		case <-ticker.C:
+			j.run(ctx)
+		}
+	}
+}
+
+func (j *StreamJanitor) run(ctx context.Context) {
+	// The lock expires just before the next run so another process can take
+	// over if this one goes away.
+	locked, err := j.rdb.SetNX(ctx, streamJanitorLockKey, 1, j.cfg.Interval*9/10).Result()
+	if err != nil {
+		j.log.Error("Failed to take janitor lock", zap.Error(err))
+		return
+	}
+	if !locked {
+		return
+	}
+
+	for _, stream := range j.cfg.Streams {
+		j.trim(ctx, stream)
+		j.cleanGroups(ctx, stream)
+	}
+}
+
+func (j *StreamJanitor) trim(ctx context.Context, stream string) {
+	minID := bus.MinID(j.cfg.Retention)
+	if minID == "" {
+		return
+	}
+	trimmed, err := j.rdb.XTrimMinIDApprox(ctx, stream, minID, 0).Result()
+	if err != nil {
+		j.log.Error("Failed to trim stream", zap.String("stream", stream), zap.Error(err))
+		return
+	}
+	if trimmed > 0 {
+		j.log.Info("Trimmed stream", zap.String("stream", stream), zap.Int64("entries", trimmed))
+	}
+}
+
+func (j *StreamJanitor) cleanGroups(ctx context.Context, stream string) {
+	if j.cfg.IdleTimeout <= 0 {
+		return
+	}
+
+	groups, err := j.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		// Streams are only created by their first entry.
+		if !strings.Contains(err.Error(), "no such key") {
+			j.log.Error("Failed to list consumer groups", zap.String("stream", stream), zap.Error(err))
+		}
+		return
+	}
+
+	for _, group := range groups {
+		j.ackIdlePending(ctx, stream, group.Name)
+		j.deleteIdleConsumers(ctx, stream, group.Name)
+	}
+}
+
+// ackIdlePending acknowledges the entries a consumer read but never
+// acknowledged. Their searches have long expired, and leaving them would
+// grow the group's pending list forever.
+func (j *StreamJanitor) ackIdlePending(ctx context.Context, stream, group string) {
+	for {
+		pending, err := j.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  group,
+			Idle:   j.cfg.IdleTimeout,
+			Start:  "-",
+			End:    "+",
+			Count:  100,
+		}).Result()
+		if err != nil {
+			j.log.Error("Failed to list pending entries", zap.String("stream", stream), zap.String("group", group), zap.Error(err))
+			return
+		}
+		if len(pending) == 0 {
+			return
+		}
+
+		ids := make([]string, len(pending))
+		for i, p := range pending {
+			ids[i] = p.ID
+		}
+		if err := j.rdb.XAck(ctx, stream, group, ids...).Err(); err != nil {
+			j.log.Error("Failed to ack idle pending entries", zap.String("stream", stream), zap.String("group", group), zap.Error(err))
+			return
+		}
+		j.log.Warn("Dropped idle pending entries",
+			zap.String("stream", stream),
+			zap.String("group", group),
+			zap.Int("entries", len(ids)),
+		)
+		if len(pending) < 100 {
+			return
+		}
+	}
+}
+
+func (j *StreamJanitor) deleteIdleConsumers(ctx context.Context, stream, group string) {
+	consumers, err := j.rdb.XInfoConsumers(ctx, stream, group).Result()
+	if err != nil {
+		j.log.Error("Failed to list consumers", zap.String("stream", stream), zap.String("group", group), zap.Error(err))
+		return
+	}
+
+	for _, c := range consumers {
+		if c.Pending > 0 || c.Idle < j.cfg.IdleTimeout {
+			continue
+		}
+		if err := j.rdb.XGroupDelConsumer(ctx, stream, group, c.Name).Err(); err != nil {
+			j.log.Error("Failed to delete idle consumer", zap.String("stream", stream), zap.String("group", group), zap.String("consumer", c.Name), zap.Error(err))
+			continue
+		}
+		j.log.Info("Deleted idle consumer", zap.String("stream", stream), zap.String("group", group), zap.String("consumer", c.Name))
+	}
+}
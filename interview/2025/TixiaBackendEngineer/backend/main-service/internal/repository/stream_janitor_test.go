@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const janitorStream = "flight.search.requested"
+
+// addEntry adds an entry to janitorStream with the given age.
+func addEntry(t *testing.T, rdb *redis.Client, age time.Duration) {
+	t.Helper()
+	id := fmt.Sprintf("%d-*", time.Now().Add(-age).UnixMilli())
+	require.NoError(t, rdb.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: janitorStream,
+		ID:     id,
+		Values: map[string]interface{}{"search_id": "s1"},
+	}).Err())
+}
+
+func TestStreamJanitor_Trim(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newTestRedis(t)
+	janitor := NewStreamJanitor(rdb, StreamJanitorConfig{
+		Retention: time.Hour,
+		Interval:  time.Minute,
+		Streams:   []string{janitorStream, "flight.search.unused"},
+	}, zap.NewNop())
+
+	addEntry(t, rdb, 2*time.Hour)
+	addEntry(t, rdb, 90*time.Minute)
+	addEntry(t, rdb, time.Minute)
+	addEntry(t, rdb, 0)
+
+	// Streams without any entry yet are left alone.
+	janitor.run(ctx)
+	assert.Equal(t, int64(2), rdb.XLen(ctx, janitorStream).Val())
+	assert.Zero(t, rdb.Exists(ctx, "flight.search.unused").Val())
+}
+
+func TestStreamJanitor_Lock(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestRedis(t)
+	cfg := StreamJanitorConfig{
+		Retention: time.Hour,
+		Interval:  time.Minute,
+		Streams:   []string{janitorStream},
+	}
+	first := NewStreamJanitor(rdb, cfg, zap.NewNop())
+	second := NewStreamJanitor(rdb, cfg, zap.NewNop())
+
+	first.run(ctx)
+	assert.True(t, mr.Exists(streamJanitorLockKey))
+
+	// The other process skips the interval the lock is held for.
+	addEntry(t, rdb, 2*time.Hour)
+	second.run(ctx)
+	assert.Equal(t, int64(1), rdb.XLen(ctx, janitorStream).Val())
+
+	// The lock expires before the next interval, so whichever process runs
+	// first then does the work.
+	mr.FastForward(cfg.Interval)
+	second.run(ctx)
+	assert.Zero(t, rdb.XLen(ctx, janitorStream).Val())
+}
+
+func TestStreamJanitor_CleanGroups(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestRedis(t)
+	janitor := NewStreamJanitor(rdb, StreamJanitorConfig{
+		IdleTimeout: time.Minute,
+		Interval:    time.Minute,
+		Streams:     []string{janitorStream},
+	}, zap.NewNop())
+
+	start := time.Now()
+	mr.SetTime(start)
+	require.NoError(t, rdb.XGroupCreateMkStream(ctx, janitorStream, "providers", "0").Err())
+	for i := 0; i < 3; i++ {
+		addEntry(t, rdb, 0)
+	}
+
+	// readGroup delivers the next entry to consumer. Claiming it again makes
+	// miniredis, like Redis, count the consumer as seen.
+	readGroup := func(consumer string) string {
+		t.Helper()
+		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    "providers",
+			Consumer: consumer,
+			Streams:  []string{janitorStream, ">"},
+			Count:    1,
+			Block:    -1,
+		}).Result()
+		require.NoError(t, err)
+		id := streams[0].Messages[0].ID
+		require.NoError(t, rdb.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   janitorStream,
+			Group:    "providers",
+			Consumer: consumer,
+			Messages: []string{id},
+		}).Err())
+		return id
+	}
+	// gone read an entry and went away without acknowledging it; idle
+	// acknowledged its entry and read nothing since.
+	readGroup("gone")
+	require.NoError(t, rdb.XAck(ctx, janitorStream, "providers", readGroup("idle")).Err())
+
+	mr.SetTime(start.Add(2 * time.Minute))
+	active := readGroup("active")
+
+	janitor.run(ctx)
+
+	pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: janitorStream,
+		Group:  "providers",
+		Start:  "-",
+		End:    "+",
+		Count:  10,
+	}).Result()
+	require.NoError(t, err)
+	require.Len(t, pending, 1, "idle pending entries are acknowledged")
+	assert.Equal(t, active, pending[0].ID)
+
+	consumers, err := rdb.XInfoConsumers(ctx, janitorStream, "providers").Result()
+	require.NoError(t, err)
+	var names []string
+	for _, c := range consumers {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"active"}, names)
+}
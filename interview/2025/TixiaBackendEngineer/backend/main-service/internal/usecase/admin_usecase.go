@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+// oldestPendingEntries is the number of the oldest pending entries listed
+// for every consumer group.
+const oldestPendingEntries = 10
+
+//go:generate mockery --name=IAdminUseCase
+type IAdminUseCase interface {
+	// ActiveSearches returns up to limit searches still waiting for
+	// providers, the oldest first.
+	ActiveSearches(ctx context.Context, limit int64) ([]domain.ActiveSearch, error)
+	// Subscriptions returns the clients following each of up to limit
+	// searches whose deadline has not passed, leaving out the searches
+	// nobody follows.
+	Subscriptions(ctx context.Context, limit int64) ([]domain.SearchSubscriptions, error)
+	// StreamHealth summarises every stream the searches are exchanged over.
+	StreamHealth(ctx context.Context) ([]domain.StreamHealth, error)
+}
+
+type adminUseCase struct {
+	repo    repository.IAdminRepository
+	streams []string
+	log     *zap.Logger
+}
+
+func NewAdminUseCase(repo repository.IAdminRepository, streams []string, log *zap.Logger) IAdminUseCase {
+	return &adminUseCase{
+		repo:    repo,
+		streams: streams,
+		log:     log,
+	}
+}
+
+func (uc *adminUseCase) ActiveSearches(ctx context.Context, limit int64) ([]domain.ActiveSearch, error) {
+	states, err := uc.repo.ActiveSearches(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	searches := make([]domain.ActiveSearch, 0, len(states))
+	for _, state := range states {
+		if state.Status == domain.SearchStatusCancelled {
+			continue
+		}
+		agg, providers, done := aggregateResults(state, state.ProviderResults, now.After(state.ProvidersDueAt))
+		if done {
+			continue
+		}
+		searches = append(searches, domain.ActiveSearch{
+			SearchID:  state.SearchID,
+			Status:    agg.Status,
+			Legs:      state.Request.Legs,
+			CreatedAt: state.CreatedAt,
+			ExpiresAt: state.ExpiresAt,
+			AgeMs:     now.Sub(state.CreatedAt).Milliseconds(),
+			Providers: providers,
+			Watchers:  state.TransportWatchers,
+		})
+	}
+	return searches, nil
+}
+
+func (uc *adminUseCase) Subscriptions(ctx context.Context, limit int64) ([]domain.SearchSubscriptions, error) {
+	states, err := uc.repo.ActiveSearches(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	subs := make([]domain.SearchSubscriptions, 0, len(states))
+	for _, state := range states {
+		if state.Watchers <= 0 {
+			continue
+		}
+		subs = append(subs, domain.SearchSubscriptions{
+			SearchID:    state.SearchID,
+			Total:       state.Watchers,
+			ByTransport: state.TransportWatchers,
+		})
+	}
+	return subs, nil
+}
+
+func (uc *adminUseCase) StreamHealth(ctx context.Context) ([]domain.StreamHealth, error) {
+	health := make([]domain.StreamHealth, 0, len(uc.streams))
+	for _, stream := range uc.streams {
+		h, err := uc.repo.StreamHealth(ctx, stream, oldestPendingEntries)
+		if err != nil {
+			uc.log.Error("Failed to get stream health", zap.String("stream", stream), zap.Error(err))
+			return nil, err
+		}
+		health = append(health, h)
+	}
+	return health, nil
+}
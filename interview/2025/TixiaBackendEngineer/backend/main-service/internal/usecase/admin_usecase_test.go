@@ -0,0 +1,87 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeAdminRepo struct {
+	states []*domain.SearchState
+}
+
+func (f *fakeAdminRepo) ActiveSearches(ctx context.Context, limit int64) ([]*domain.SearchState, error) {
+	return f.states, nil
+}
+
+func (f *fakeAdminRepo) StreamHealth(ctx context.Context, stream string, oldestPending int64) (domain.StreamHealth, error) {
+	return domain.StreamHealth{Stream: stream}, nil
+}
+
+func TestAdminActiveSearches(t *testing.T) {
+	now := time.Now()
+	search := func(id string, answered ...string) *domain.SearchState {
+		state := &domain.SearchState{
+			SearchID:          id,
+			Status:            domain.SearchStatusProcessing,
+			CreatedAt:         now.Add(-2 * time.Second),
+			ExpiresAt:         now.Add(28 * time.Second),
+			ProvidersDueAt:    now.Add(8 * time.Second),
+			ExpectedProviders: []string{"garuda", "lion"},
+			ProviderResults:   make(map[string]domain.FlightSearchResult),
+			TransportWatchers: make(map[string]int64),
+		}
+		for _, p := range answered {
+			state.ProviderResults[p] = domain.FlightSearchResult{
+				SearchID:   id,
+				Status:     domain.SearchStatusCompleted,
+				ProviderID: p,
+				Results:    []domain.Flight{{ID: p + "-1"}},
+			}
+		}
+		return state
+	}
+
+	waiting := search("waiting", "garuda")
+	waiting.Watchers = 3
+	waiting.TransportWatchers = map[string]int64{"sse": 2, "websocket": 1}
+	cancelled := search("cancelled")
+	cancelled.Status = domain.SearchStatusCancelled
+	cancelled.Watchers = 1
+	repo := &fakeAdminRepo{states: []*domain.SearchState{
+		waiting,
+		search("unwatched"),
+		search("answered", "garuda", "lion"),
+		cancelled,
+	}}
+	uc := NewAdminUseCase(repo, []string{"requested", "results"}, zap.NewNop())
+
+	searches, err := uc.ActiveSearches(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, searches, 2)
+	assert.Equal(t, "waiting", searches[0].SearchID)
+	assert.Equal(t, domain.SearchStatusProcessing, searches[0].Status)
+	assert.GreaterOrEqual(t, searches[0].AgeMs, int64(2000))
+	assert.Equal(t, []domain.ProviderState{
+		{ProviderID: "garuda", Status: domain.SearchStatusCompleted, TotalResults: 1},
+		{ProviderID: "lion", Status: domain.ProviderStatusPending},
+	}, searches[0].Providers)
+	assert.Equal(t, map[string]int64{"sse": 2, "websocket": 1}, searches[0].Watchers)
+	assert.Equal(t, "unwatched", searches[1].SearchID)
+
+	subs, err := uc.Subscriptions(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.SearchSubscriptions{
+		{SearchID: "waiting", Total: 3, ByTransport: map[string]int64{"sse": 2, "websocket": 1}},
+		{SearchID: "cancelled", Total: 1, ByTransport: map[string]int64{}},
+	}, subs)
+
+	health, err := uc.StreamHealth(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []domain.StreamHealth{{Stream: "requested"}, {Stream: "results"}}, health)
+}
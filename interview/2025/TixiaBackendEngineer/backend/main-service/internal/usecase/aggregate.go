@@ -0,0 +1,144 @@
+package usecase
+
+import (
+	"sort"
+
+	"example.com/main-service/internal/domain"
+)
+
+// providerID returns the provider a result came from.
+func providerID(res domain.FlightSearchResult) string {
+	if res.ProviderID == "" {
+		return domain.DefaultProviderID
+	}
+	return res.ProviderID
+}
+
+// aggregateResults merges the results of the providers that answered into
+// one result and reports each provider's state. Providers only combine
+// their own flights into itineraries, so the itineraries of multi-leg
+// trips are built again from the legs of all of them. done is true once every
+// expected provider answered, or once the provider deadline passed and at
+// least one of them did; providers still missing then count as failed.
+func aggregateResults(state *domain.SearchState, answered map[string]domain.FlightSearchResult, deadlinePassed bool) (domain.FlightSearchResult, []domain.ProviderState, bool) {
+	agg := domain.FlightSearchResult{
+		SearchID:        state.SearchID,
+		Status:          domain.SearchStatusProcessing,
+		TripType:        state.Request.TripType,
+		Results:         []domain.Flight{},
+		Legs:            []domain.LegResult{},
+		Itineraries:     []domain.Itinerary{},
+		FailedProviders: []string{},
+	}
+
+	var (
+		providers  []domain.ProviderState
+		pending    int
+		anyFound   bool
+		allFailed  = true
+		seen       = make(map[string]bool)
+		legIndexes = make(map[int]int)
+	)
+
+	merge := func(id string, res domain.FlightSearchResult) {
+		providers = append(providers, domain.ProviderState{
+			ProviderID:   id,
+			Status:       res.Status,
+			TotalResults: len(res.Results),
+		})
+		if domain.CompareStreamIDs(res.EventID, agg.EventID) > 0 {
+			agg.EventID = res.EventID
+		}
+
+		switch res.Status {
+		case domain.SearchStatusFailed:
+			agg.FailedProviders = append(agg.FailedProviders, id)
+			return
+		case domain.SearchStatusCompleted:
+			anyFound = true
+		}
+		allFailed = false
+
+		agg.Results = append(agg.Results, res.Results...)
+		for _, leg := range res.Legs {
+			i, ok := legIndexes[leg.Leg]
+			if !ok {
+				legIndexes[leg.Leg] = len(agg.Legs)
+				leg.Flights = append([]domain.Flight{}, leg.Flights...)
+				agg.Legs = append(agg.Legs, leg)
+				continue
+			}
+			agg.Legs[i].Flights = append(agg.Legs[i].Flights, leg.Flights...)
+		}
+		agg.Itineraries = append(agg.Itineraries, res.Itineraries...)
+	}
+
+	for _, id := range state.ExpectedProviders {
+		seen[id] = true
+		res, ok := answered[id]
+		if ok {
+			merge(id, res)
+			continue
+		}
+		status := domain.ProviderStatusPending
+		if deadlinePassed {
+			status = domain.ProviderStatusTimeout
+			agg.FailedProviders = append(agg.FailedProviders, id)
+		} else {
+			pending++
+		}
+		providers = append(providers, domain.ProviderState{ProviderID: id, Status: status})
+	}
+
+	// Providers that answered without being expected still contribute.
+	var extra []string
+	for id := range answered {
+		if !seen[id] {
+			extra = append(extra, id)
+		}
+	}
+	sort.Strings(extra)
+	for _, id := range extra {
+		merge(id, answered[id])
+	}
+
+	sort.Slice(agg.Legs, func(i, j int) bool { return agg.Legs[i].Leg < agg.Legs[j].Leg })
+	if n := len(state.Request.Legs); n > 1 {
+		perLeg := make([][]domain.Flight, n)
+		agg.Results = []domain.Flight{}
+		for _, leg := range agg.Legs {
+			if leg.Leg >= 0 && leg.Leg < n {
+				perLeg[leg.Leg] = leg.Flights
+			}
+			agg.Results = append(agg.Results, leg.Flights...)
+		}
+		agg.Itineraries = append([]domain.Itinerary{}, domain.BuildItineraries(perLeg)...)
+		anyFound = len(agg.Itineraries) > 0
+	}
+	sort.SliceStable(agg.Itineraries, func(i, j int) bool {
+		return agg.Itineraries[i].TotalPrice < agg.Itineraries[j].TotalPrice
+	})
+
+	done := len(answered) > 0 && pending == 0
+	if done {
+		switch {
+		case anyFound:
+			agg.Status = domain.SearchStatusCompleted
+		case allFailed:
+			agg.Status = domain.SearchStatusFailed
+		default:
+			agg.Status = domain.SearchStatusNotFound
+		}
+	}
+
+	return agg, providers, done
+}
+
+// partialResult re-labels a provider result for streaming before the final
+// aggregated result.
+func partialResult(res domain.FlightSearchResult) domain.FlightSearchResult {
+	res.ProviderID = providerID(res)
+	res.ProviderStatus = res.Status
+	res.Status = domain.SearchStatusPartial
+	return res
+}
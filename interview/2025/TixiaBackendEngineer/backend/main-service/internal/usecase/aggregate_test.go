@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"testing"
+
+	"example.com/main-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregateResults(t *testing.T) {
+	state := &domain.SearchState{
+		SearchID:          "s1",
+		ExpectedProviders: []string{"garuda", "lion", "citilink"},
+	}
+	garuda := domain.FlightSearchResult{
+		SearchID:   "s1",
+		Status:     domain.SearchStatusCompleted,
+		ProviderID: "garuda",
+		Results:    []domain.Flight{{ID: "ga-1"}},
+		Legs:       []domain.LegResult{{Leg: 0, Flights: []domain.Flight{{ID: "ga-1"}}}},
+		EventID:    "100-0",
+	}
+	lion := domain.FlightSearchResult{
+		SearchID:   "s1",
+		Status:     domain.SearchStatusFailed,
+		ProviderID: "lion",
+		EventID:    "200-0",
+	}
+
+	tests := []struct {
+		name           string
+		answered       map[string]domain.FlightSearchResult
+		deadlinePassed bool
+		wantDone       bool
+		wantStatus     string
+		wantFailed     []string
+		wantResults    int
+	}{
+		{
+			name:        "waits for pending providers",
+			answered:    map[string]domain.FlightSearchResult{"garuda": garuda, "lion": lion},
+			wantStatus:  domain.SearchStatusProcessing,
+			wantFailed:  []string{"lion"},
+			wantResults: 1,
+		},
+		{
+			name:           "finalizes at the provider deadline",
+			answered:       map[string]domain.FlightSearchResult{"garuda": garuda, "lion": lion},
+			deadlinePassed: true,
+			wantDone:       true,
+			wantStatus:     domain.SearchStatusCompleted,
+			wantFailed:     []string{"lion", "citilink"},
+			wantResults:    1,
+		},
+		{
+			name:           "keeps waiting at the deadline when nobody answered",
+			answered:       map[string]domain.FlightSearchResult{},
+			deadlinePassed: true,
+			wantStatus:     domain.SearchStatusProcessing,
+			wantFailed:     []string{"garuda", "lion", "citilink"},
+		},
+		{
+			name:           "fails when every provider failed",
+			answered:       map[string]domain.FlightSearchResult{"lion": lion},
+			deadlinePassed: true,
+			wantDone:       true,
+			wantStatus:     domain.SearchStatusFailed,
+			wantFailed:     []string{"garuda", "lion", "citilink"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg, providers, done := aggregateResults(state, tt.answered, tt.deadlinePassed)
+
+			assert.Equal(t, tt.wantDone, done)
+			assert.Equal(t, tt.wantStatus, agg.Status)
+			assert.ElementsMatch(t, tt.wantFailed, agg.FailedProviders)
+			assert.Len(t, agg.Results, tt.wantResults)
+			assert.Len(t, providers, 3)
+		})
+	}
+}
+
+func TestAggregateResults_CombinesLegsAcrossProviders(t *testing.T) {
+	state := &domain.SearchState{
+		SearchID: "s1",
+		Request: domain.FlightSearchRequest{
+			TripType: domain.TripRoundTrip,
+			Legs: []domain.SearchLeg{
+				{From: "CGK", To: "DPS", Date: "2025-07-10"},
+				{From: "DPS", To: "CGK", Date: "2025-07-15"},
+			},
+		},
+		ExpectedProviders: []string{"garuda", "lion"},
+	}
+	outbound := domain.Flight{ID: "garuda:ga-1", DepartureTime: "2025-07-10 08:00", ArrivalTime: "2025-07-10 10:00", Price: 1000000, Currency: "IDR"}
+	inbound := domain.Flight{ID: "lion:jt-1", DepartureTime: "2025-07-15 08:00", ArrivalTime: "2025-07-15 10:00", Price: 700000, Currency: "IDR"}
+	// Neither provider serves both legs, so neither found an itinerary.
+	answered := map[string]domain.FlightSearchResult{
+		"garuda": {Status: domain.SearchStatusNotFound, Results: []domain.Flight{}, Legs: []domain.LegResult{{Leg: 0, Flights: []domain.Flight{outbound}}}},
+		"lion":   {Status: domain.SearchStatusNotFound, Results: []domain.Flight{}, Legs: []domain.LegResult{{Leg: 1, Flights: []domain.Flight{inbound}}}},
+	}
+
+	agg, _, done := aggregateResults(state, answered, false)
+	assert.True(t, done)
+	assert.Equal(t, domain.SearchStatusCompleted, agg.Status)
+	assert.Equal(t, []domain.Flight{outbound, inbound}, agg.Results)
+	assert.Equal(t, []domain.Itinerary{{
+		FlightIDs:  []string{"garuda:ga-1", "lion:jt-1"},
+		TotalPrice: 1700000,
+		Currency:   "IDR",
+	}}, agg.Itineraries)
+}
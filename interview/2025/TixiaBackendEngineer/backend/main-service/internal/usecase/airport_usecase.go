@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/repository"
+)
+
+//go:generate mockery --name=IAirportUseCase
+type IAirportUseCase interface {
+	// SearchPlaces returns up to limit cities and airports matching query
+	// by code, city or name, the best matches first.
+	SearchPlaces(query string, limit int) []domain.Place
+}
+
+type airportUseCase struct {
+	repo repository.IAirportRepository
+}
+
+func NewAirportUseCase(repo repository.IAirportRepository) IAirportUseCase {
+	return &airportUseCase{repo: repo}
+}
+
+// How well a place matches an autocomplete query, the best first.
+const (
+	matchCode = iota
+	matchCityCode
+	matchCodePrefix
+	matchCityPrefix
+	matchWordPrefix
+	matchSubstring
+	noMatch
+)
+
+func (uc *airportUseCase) SearchPlaces(query string, limit int) []domain.Place {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" || limit <= 0 {
+		return []domain.Place{}
+	}
+
+	type match struct {
+		place domain.Place
+		rank  int
+	}
+	var matches []match
+	for _, p := range uc.repo.Places() {
+		if rank := matchPlace(p, q); rank != noMatch {
+			matches = append(matches, match{place: p, rank: rank})
+		}
+	}
+	// Places come cities first, which the stable sort keeps within a rank.
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].rank < matches[j].rank
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	places := make([]domain.Place, len(matches))
+	for i, m := range matches {
+		places[i] = m.place
+	}
+	return places
+}
+
+// matchPlace ranks how well p matches the lowercase query q.
+func matchPlace(p domain.Place, q string) int {
+	code := strings.ToLower(p.Code)
+	city := strings.ToLower(p.City)
+	name := strings.ToLower(p.Name)
+	switch {
+	case code == q:
+		return matchCode
+	case strings.ToLower(p.CityCode) == q:
+		return matchCityCode
+	case strings.HasPrefix(code, q):
+		return matchCodePrefix
+	case strings.HasPrefix(city, q):
+		return matchCityPrefix
+	case hasWordPrefix(city, q) || hasWordPrefix(name, q):
+		return matchWordPrefix
+	case len(q) >= 3 && (strings.Contains(city, q) || strings.Contains(name, q)):
+		return matchSubstring
+	}
+	return noMatch
+}
+
+// hasWordPrefix reports whether a word of s starts with prefix.
+func hasWordPrefix(s, prefix string) bool {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package usecase
+
+import (
+	"testing"
+
+	"example.com/main-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAirportRepo struct {
+	places []domain.Place
+}
+
+func newFakeAirportRepo() *fakeAirportRepo {
+	return &fakeAirportRepo{places: []domain.Place{
+		{Type: domain.PlaceCity, Code: "JKT", Name: "Jakarta", City: "Jakarta", Country: "ID", Airports: []string{"CGK", "HLP"}},
+		{Type: domain.PlaceAirport, Code: "CGK", Name: "Soekarno-Hatta International Airport", City: "Jakarta", CityCode: "JKT", Country: "ID"},
+		{Type: domain.PlaceAirport, Code: "HLP", Name: "Halim Perdanakusuma International Airport", City: "Jakarta", CityCode: "JKT", Country: "ID"},
+		{Type: domain.PlaceAirport, Code: "DPS", Name: "I Gusti Ngurah Rai International Airport", City: "Denpasar", Country: "ID"},
+		{Type: domain.PlaceAirport, Code: "SUB", Name: "Juanda International Airport", City: "Surabaya", Country: "ID"},
+		{Type: domain.PlaceAirport, Code: "SRG", Name: "Jenderal Ahmad Yani International Airport", City: "Semarang", Country: "ID"},
+	}}
+}
+
+func (f *fakeAirportRepo) GetAirport(code string) (domain.Airport, bool) {
+	for _, p := range f.places {
+		if p.Type == domain.PlaceAirport && p.Code == code {
+			return domain.Airport{Code: p.Code, Name: p.Name, City: p.City, CityCode: p.CityCode, Country: p.Country}, true
+		}
+	}
+	return domain.Airport{}, false
+}
+
+func (f *fakeAirportRepo) GetCity(code string) (domain.City, bool) {
+	for _, p := range f.places {
+		if p.Type == domain.PlaceCity && p.Code == code {
+			return domain.City{Code: p.Code, Name: p.Name, Country: p.Country, Airports: p.Airports}, true
+		}
+	}
+	return domain.City{}, false
+}
+
+func (f *fakeAirportRepo) Places() []domain.Place {
+	return f.places
+}
+
+func TestSearchPlaces(t *testing.T) {
+	uc := NewAirportUseCase(newFakeAirportRepo())
+	codes := func(places []domain.Place) []string {
+		out := make([]string, len(places))
+		for i, p := range places {
+			out[i] = p.Code
+		}
+		return out
+	}
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		{query: "jkt", limit: 10, want: []string{"JKT", "CGK", "HLP"}},
+		{query: "CGK", limit: 10, want: []string{"CGK"}},
+		{query: "s", limit: 10, want: []string{"SUB", "SRG", "CGK"}},
+		{query: "jak", limit: 2, want: []string{"JKT", "CGK"}},
+		{query: " denpasar ", limit: 10, want: []string{"DPS"}},
+		{query: "ngurah", limit: 10, want: []string{"DPS"}},
+		{query: "perdana", limit: 10, want: []string{"HLP"}},
+		{query: "xyz", limit: 10, want: []string{}},
+		{query: "", limit: 10, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.want, codes(uc.SearchPlaces(tt.query, tt.limit)))
+		})
+	}
+}
@@ -2,57 +2,494 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
 
 	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/metrics"
 	"example.com/main-service/internal/repository"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+var tracer = otel.Tracer("example.com/main-service/internal/usecase")
+
 //go:generate mockery --name=IFlightUseCase
 type IFlightUseCase interface {
-	SearchFlights(ctx context.Context, req domain.CreateSearchBody) (string, error)
-	StreamResults(ctx context.Context, searchID string) <-chan domain.FlightSearchResult
+	SearchFlights(ctx context.Context, req domain.CreateSearchBody) (domain.SearchSubmission, error)
+	StreamResults(ctx context.Context, searchID, lastEventID string) <-chan domain.FlightSearchResult
+	GetSearch(ctx context.Context, searchID string) (*domain.SearchState, error)
+	CancelSearch(ctx context.Context, searchID string) error
+	ResultRecorded(ctx context.Context, searchID string)
+	WatchSearch(ctx context.Context, searchID, transport string) (release func())
+	CacheStats(ctx context.Context) (domain.CacheStats, error)
+}
+
+// FlightUseCaseConfig holds the search lifecycle settings.
+type FlightUseCaseConfig struct {
+	// SearchDeadline is how long a search may stay in processing before it
+	// is reported as expired.
+	SearchDeadline time.Duration
+	// ProviderDeadline is how long to wait for every provider before the
+	// results of the ones that answered are final.
+	ProviderDeadline time.Duration
+	// Providers are the provider IDs expected to answer every search.
+	Providers []string
+	// AbandonGrace is how long an unfinished search may go without any
+	// client following it before it is cancelled. Zero disables it.
+	AbandonGrace time.Duration
+	// CacheTTL is how long the results of a completed search answer
+	// identical searches. Zero disables the cache.
+	CacheTTL time.Duration
+	// IdempotencyTTL is how long an idempotency key keeps returning the
+	// search it started. Defaults to defaultIdempotencyTTL.
+	IdempotencyTTL time.Duration
+	// SchemaVersion of the published search requests. City codes are only
+	// searched from domain.SchemaCityAirports on, which can list their airports.
+	SchemaVersion int
 }
 
+const defaultIdempotencyTTL = 30 * time.Minute
+
 type flightUseCase struct {
-	repo repository.IFlightRepository
-	log  *zap.Logger
+	repo     repository.IFlightRepository
+	airports repository.IAirportRepository
+	cfg      FlightUseCaseConfig
+	log      *zap.Logger
 }
 
-func NewFlightUseCase(repo repository.IFlightRepository, log *zap.Logger) IFlightUseCase {
+func NewFlightUseCase(repo repository.IFlightRepository, airports repository.IAirportRepository, cfg FlightUseCaseConfig, log *zap.Logger) IFlightUseCase {
+	if len(cfg.Providers) == 0 {
+		cfg.Providers = []string{domain.DefaultProviderID}
+	}
+	if cfg.IdempotencyTTL <= 0 {
+		cfg.IdempotencyTTL = defaultIdempotencyTTL
+	}
 	return &flightUseCase{
-		repo: repo,
-		log:  log,
+		repo:     repo,
+		airports: airports,
+		cfg:      cfg,
+		log:      log,
 	}
 }
 
-func (uc *flightUseCase) SearchFlights(ctx context.Context, req domain.CreateSearchBody) (string, error) {
-	searchID := uuid.New().String()
+func (uc *flightUseCase) SearchFlights(ctx context.Context, req domain.CreateSearchBody) (sub domain.SearchSubmission, err error) {
+	ctx, span := tracer.Start(ctx, "SearchFlights")
+	defer func() {
+		span.SetAttributes(
+			attribute.String("search_id", sub.SearchID),
+			attribute.Bool("cached", sub.Cached),
+			attribute.Bool("replayed", sub.Replayed),
+		)
+		endSpan(span, err)
+	}()
+
+	tripType, legs, err := buildLegs(req)
+	if err != nil {
+		return domain.SearchSubmission{}, err
+	}
+	if err := resolveLegs(uc.airports, legs, uc.cfg.SchemaVersion >= domain.SchemaCityAirports); err != nil {
+		return domain.SearchSubmission{}, err
+	}
+
+	searchReq := newSearchRequest(req, uuid.New().String(), tripType, legs)
+	if req.IdempotencyKey == "" {
+		return uc.startSearch(ctx, searchReq, req.BypassCache)
+	}
 
-	searchReq := domain.FlightSearchRequest{
+	rec, reserved, err := uc.reserveIdempotencyKey(ctx, req, searchReq)
+	if err != nil {
+		return domain.SearchSubmission{}, err
+	}
+	if !reserved {
+		return uc.replaySearch(ctx, rec), nil
+	}
+
+	sub, err = uc.startSearch(ctx, searchReq, req.BypassCache)
+	if err != nil {
+		if err := uc.repo.ReleaseIdempotencyKey(context.WithoutCancel(ctx), idempotencyKey(req)); err != nil {
+			uc.log.Error("Failed to release idempotency key", zap.String("search_id", searchReq.SearchID), zap.Error(err))
+		}
+	}
+	return sub, err
+}
+
+// newSearchRequest builds the search to run from the request body, with
+// the defaults applied.
+func newSearchRequest(req domain.CreateSearchBody, searchID, tripType string, legs []domain.SearchLeg) domain.FlightSearchRequest {
+	cabinClass := req.CabinClass
+	if cabinClass == "" {
+		cabinClass = domain.CabinEconomy
+	}
+	sortOrder := req.SortOrder
+	if req.SortBy == "" {
+		sortOrder = ""
+	} else if sortOrder == "" {
+		sortOrder = domain.SortAsc
+	}
+
+	return domain.FlightSearchRequest{
 		SearchID:   searchID,
-		From:       req.From,
-		To:         req.To,
-		Date:       req.Date,
+		TripType:   tripType,
+		From:       legs[0].From,
+		To:         legs[0].To,
+		Date:       legs[0].Date,
+		Legs:       legs,
+		Passengers: req.Passengers,
+		CabinClass: cabinClass,
+		Filters:    req.Filters,
+		SortBy:     req.SortBy,
+		SortOrder:  sortOrder,
+	}
+}
+
+// startSearch answers the search from the cache or sends it to the
+// providers.
+func (uc *flightUseCase) startSearch(ctx context.Context, searchReq domain.FlightSearchRequest, bypassCache bool) (domain.SearchSubmission, error) {
+	searchID := searchReq.SearchID
+	now := time.Now()
+	state := domain.SearchState{
+		SearchID:          searchID,
+		Status:            domain.SearchStatusProcessing,
+		Request:           searchReq,
+		CreatedAt:         now,
+		ExpiresAt:         now.Add(uc.cfg.SearchDeadline),
+		ProvidersDueAt:    now.Add(uc.cfg.ProviderDeadline),
+		ExpectedProviders: uc.cfg.Providers,
+	}
+
+	cacheKey := searchCacheKey(searchReq, uc.cfg.Providers)
+	if cached := uc.cachedResults(ctx, cacheKey, bypassCache); cached != nil {
+		// The search is complete from the start: store the cached results as
+		// if the providers had answered and publish nothing.
+		for id, res := range cached {
+			res.SearchID = searchID
+			cached[id] = res
+		}
+		state.ProviderResults = cached
+		final, _, _ := aggregateResults(&state, cached, false)
+		state.Status = final.Status
+		if err := uc.repo.SaveSearchState(ctx, state); err != nil {
+			uc.log.Error("Failed to save flight search state", zap.Error(err))
+			return domain.SearchSubmission{}, err
+		}
+
+		metrics.SearchesStarted.WithLabelValues(metrics.SourceCache).Inc()
+		uc.searchFinished(ctx, searchID, state.Status)
+
+		uc.log.Info("Flight search served from cache",
+			zap.String("search_id", searchID),
+			zap.String("cache_key", cacheKey),
+			zap.String("status", state.Status),
+		)
+		return domain.SearchSubmission{SearchID: searchID, Status: state.Status, Cached: true}, nil
+	}
+	state.CacheKey = cacheKey
+
+	if err := uc.repo.SaveSearchState(ctx, state); err != nil {
+		uc.log.Error("Failed to save flight search state", zap.Error(err))
+		return domain.SearchSubmission{}, err
 	}
 
 	if err := uc.repo.PublishSearchRequest(ctx, searchReq); err != nil {
 		uc.log.Error("Failed to publish flight search request", zap.Error(err))
-		return "", err
+		return domain.SearchSubmission{}, err
 	}
+	metrics.SearchesStarted.WithLabelValues(metrics.SourceProviders).Inc()
+	uc.watchDeadlines(searchID)
 
 	uc.log.Info("Flight search request submitted",
 		zap.String("search_id", searchID),
-		zap.String("from", req.From),
-		zap.String("to", req.To),
-		zap.String("date", req.Date),
-		zap.Int("passengers", req.Passengers),
+		zap.String("trip_type", searchReq.TripType),
+		zap.String("from", searchReq.From),
+		zap.String("to", searchReq.To),
+		zap.String("date", searchReq.Date),
+		zap.Int("legs", len(searchReq.Legs)),
+		zap.Int("passengers", searchReq.Passengers),
+		zap.String("cabin_class", searchReq.CabinClass),
 	)
 
-	return searchID, nil
+	return domain.SearchSubmission{SearchID: searchID, Status: domain.SearchStatusProcessing}, nil
 }
 
-func (uc *flightUseCase) StreamResults(ctx context.Context, searchID string) <-chan domain.FlightSearchResult {
-	return uc.repo.ConsumeSearchResults(ctx, searchID)
+// StreamResults returns the results of searchID with the search's filters
+// and sort order applied: one partial result per provider as it answers,
+// followed by the aggregated final result.
+func (uc *flightUseCase) StreamResults(ctx context.Context, searchID, lastEventID string) <-chan domain.FlightSearchResult {
+	out := make(chan domain.FlightSearchResult)
+
+	// Subscribe before reading the state so no result falls in between.
+	in := uc.repo.ConsumeSearchResults(ctx, searchID, lastEventID)
+	state, err := uc.repo.GetSearchState(ctx, searchID)
+	if err != nil {
+		uc.log.Error("Failed to load search state", zap.String("search_id", searchID), zap.Error(err))
+		close(out)
+		return out
+	}
+
+	go func() {
+		defer close(out)
+
+		send := func(res domain.FlightSearchResult) bool {
+			res.Results, res.Legs, res.Itineraries = applySearchOptions(state.Request, res.Results, res.Legs, res.Itineraries)
+			res.Status = filteredStatus(state.Request, res.Status, res.Results, res.Itineraries)
+			select {
+			case out <- res:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		answered := make(map[string]domain.FlightSearchResult)
+		deadlinePassed := time.Now().After(state.ProvidersDueAt)
+
+		// finish sends the aggregated result once it is final.
+		finish := func() bool {
+			final, _, done := aggregateResults(state, answered, deadlinePassed)
+			if done {
+				uc.cacheResults(ctx, state, final, answered)
+				send(final)
+			}
+			return done
+		}
+
+		// cancel sends the results gathered so far as the final, cancelled
+		// result.
+		cancel := func(eventID string) {
+			final, _, _ := aggregateResults(state, answered, deadlinePassed)
+			final.Status = domain.SearchStatusCancelled
+			final.FailedProviders = nil
+			if eventID != "" {
+				final.EventID = eventID
+			}
+			send(final)
+		}
+
+		// Results recorded before the subscription: replay the ones the
+		// client has not seen yet.
+		recorded := make([]domain.FlightSearchResult, 0, len(state.ProviderResults))
+		for _, res := range state.ProviderResults {
+			recorded = append(recorded, res)
+		}
+		sort.Slice(recorded, func(i, j int) bool {
+			return domain.CompareStreamIDs(recorded[i].EventID, recorded[j].EventID) < 0
+		})
+		for _, res := range recorded {
+			answered[providerID(res)] = res
+			if domain.CompareStreamIDs(res.EventID, lastEventID) > 0 && !send(partialResult(res)) {
+				return
+			}
+		}
+		if state.Status == domain.SearchStatusCancelled {
+			cancel("")
+			return
+		}
+		if finish() {
+			return
+		}
+
+		deadline := time.NewTimer(time.Until(state.ProvidersDueAt))
+		defer deadline.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-deadline.C:
+				deadlinePassed = true
+				if finish() {
+					return
+				}
+			case res, ok := <-in:
+				if !ok {
+					return
+				}
+				if res.Status == domain.SearchStatusCancelled {
+					cancel(res.EventID)
+					return
+				}
+				id := providerID(res)
+				if _, seen := answered[id]; seen {
+					continue
+				}
+				answered[id] = res
+				if !send(partialResult(res)) || finish() {
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+func (uc *flightUseCase) GetSearch(ctx context.Context, searchID string) (*domain.SearchState, error) {
+	state, err := uc.repo.GetSearchState(ctx, searchID)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelled := state.Status == domain.SearchStatusCancelled
+	agg, providers, done := aggregateResults(state, state.ProviderResults, time.Now().After(state.ProvidersDueAt))
+	state.Status = agg.Status
+	state.FailedProviders = agg.FailedProviders
+	switch {
+	case cancelled:
+		state.Status = domain.SearchStatusCancelled
+		state.FailedProviders = nil
+	case !done && time.Now().After(state.ExpiresAt):
+		state.Status = domain.SearchStatusExpired
+	case done:
+		uc.cacheResults(ctx, state, agg, state.ProviderResults)
+	}
+	state.Providers = providers
+	state.Results, state.Legs, state.Itineraries = applySearchOptions(state.Request, agg.Results, agg.Legs, agg.Itineraries)
+	state.Status = filteredStatus(state.Request, state.Status, state.Results, state.Itineraries)
+	return state, nil
+}
+
+// CancelSearch stops a search that has not finished yet and tells the
+// providers to drop it.
+func (uc *flightUseCase) CancelSearch(ctx context.Context, searchID string) (err error) {
+	ctx, span := tracer.Start(ctx, "CancelSearch", trace.WithAttributes(attribute.String("search_id", searchID)))
+	defer func() { endSpan(span, err) }()
+
+	state, err := uc.GetSearch(ctx, searchID)
+	if err != nil {
+		return err
+	}
+	if domain.IsTerminalStatus(state.Status) {
+		return domain.ErrSearchFinished
+	}
+
+	// Another process may cancel or finish the search meanwhile; the
+	// repository only cancels it if nobody did.
+	if err := uc.repo.CancelSearch(ctx, searchID); err != nil {
+		if !errors.Is(err, domain.ErrSearchFinished) {
+			uc.log.Error("Failed to cancel flight search", zap.String("search_id", searchID), zap.Error(err))
+		}
+		return err
+	}
+	metrics.SearchesCompleted.WithLabelValues(domain.SearchStatusCancelled).Inc()
+	uc.log.Info("Flight search cancelled", zap.String("search_id", searchID))
+	return nil
+}
+
+// ResultRecorded counts searchID as completed if the provider result just
+// recorded for it was the last one it waited for.
+func (uc *flightUseCase) ResultRecorded(ctx context.Context, searchID string) {
+	uc.checkFinished(ctx, searchID)
+}
+
+// watchDeadlines checks whether searchID finished once its provider
+// deadline and its search deadline pass, as no result arrives to tell.
+// The timers live in the process that started the search.
+func (uc *flightUseCase) watchDeadlines(searchID string) {
+	check := func() { uc.checkFinished(context.Background(), searchID) }
+	time.AfterFunc(uc.cfg.ProviderDeadline, check)
+	if uc.cfg.SearchDeadline > uc.cfg.ProviderDeadline {
+		time.AfterFunc(uc.cfg.SearchDeadline, check)
+	}
+}
+
+// checkFinished counts searchID as completed once it has a final result or
+// passed its deadline without one. Cancelled searches were counted when
+// they were cancelled.
+func (uc *flightUseCase) checkFinished(ctx context.Context, searchID string) {
+	state, err := uc.repo.GetSearchState(ctx, searchID)
+	if err != nil {
+		if !errors.Is(err, domain.ErrSearchNotFound) {
+			uc.log.Warn("Failed to load search state", zap.String("search_id", searchID), zap.Error(err))
+		}
+		return
+	}
+	if state.Status == domain.SearchStatusCancelled {
+		return
+	}
+
+	now := time.Now()
+	agg, _, done := aggregateResults(state, state.ProviderResults, now.After(state.ProvidersDueAt))
+	switch {
+	case done:
+		uc.cacheResults(ctx, state, agg, state.ProviderResults)
+		uc.searchFinished(ctx, searchID, agg.Status)
+	case now.After(state.ExpiresAt):
+		uc.searchFinished(ctx, searchID, domain.SearchStatusExpired)
+	}
+}
+
+// searchFinished counts the search as completed with status, unless
+// another call, possibly in another process, already did.
+func (uc *flightUseCase) searchFinished(ctx context.Context, searchID, status string) {
+	first, err := uc.repo.MarkSearchFinished(ctx, searchID)
+	if err != nil {
+		uc.log.Warn("Failed to mark search finished", zap.String("search_id", searchID), zap.Error(err))
+		return
+	}
+	if first {
+		metrics.SearchesCompleted.WithLabelValues(status).Inc()
+	}
+}
+
+// WatchSearch registers a client following searchID over transport. Once
+// the last client has released it and none came back within AbandonGrace,
+// the search is cancelled if it is still running.
+func (uc *flightUseCase) WatchSearch(ctx context.Context, searchID, transport string) func() {
+	if _, err := uc.repo.AddSearchWatchers(ctx, searchID, transport, 1); err != nil {
+		uc.log.Warn("Failed to register search watcher", zap.String("search_id", searchID), zap.Error(err))
+		return func() {}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			// ctx is usually gone by now, the client having disconnected.
+			ctx := context.Background()
+			watchers, err := uc.repo.AddSearchWatchers(ctx, searchID, transport, -1)
+			if err != nil {
+				uc.log.Warn("Failed to release search watcher", zap.String("search_id", searchID), zap.Error(err))
+				return
+			}
+			if watchers > 0 || uc.cfg.AbandonGrace <= 0 {
+				return
+			}
+			time.AfterFunc(uc.cfg.AbandonGrace, func() {
+				uc.cancelAbandoned(ctx, searchID)
+			})
+		})
+	}
+}
+
+func (uc *flightUseCase) cancelAbandoned(ctx context.Context, searchID string) {
+	state, err := uc.repo.GetSearchState(ctx, searchID)
+	if err != nil {
+		return
+	}
+	if state.Watchers > 0 {
+		return
+	}
+
+	err = uc.CancelSearch(ctx, searchID)
+	switch {
+	case err == nil:
+		uc.log.Info("Cancelled abandoned flight search", zap.String("search_id", searchID))
+	case !errors.Is(err, domain.ErrSearchFinished):
+		uc.log.Error("Failed to cancel abandoned flight search", zap.String("search_id", searchID), zap.Error(err))
+	}
+}
+
+// endSpan ends span, marking it failed when err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
 }
@@ -0,0 +1,120 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/metrics"
+	"example.com/main-service/internal/repository"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeStateRepo serves one search state and records which searches were
+// marked finished. The other repository methods are not expected to be
+// called.
+type fakeStateRepo struct {
+	repository.IFlightRepository
+	state    domain.SearchState
+	finished map[string]bool
+}
+
+func (f *fakeStateRepo) GetSearchState(ctx context.Context, searchID string) (*domain.SearchState, error) {
+	if searchID != f.state.SearchID {
+		return nil, domain.ErrSearchNotFound
+	}
+	state := f.state
+	return &state, nil
+}
+
+func (f *fakeStateRepo) MarkSearchFinished(ctx context.Context, searchID string) (bool, error) {
+	first := !f.finished[searchID]
+	f.finished[searchID] = true
+	return first, nil
+}
+
+func TestCheckFinished(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	garuda := domain.FlightSearchResult{SearchID: "s1", ProviderID: "garuda", Status: domain.SearchStatusCompleted, Results: []domain.Flight{{ID: "garuda:ga-1"}}}
+
+	tests := []struct {
+		name  string
+		state domain.SearchState
+		want  string
+	}{
+		{
+			name: "waiting for providers",
+			state: domain.SearchState{
+				ExpectedProviders: []string{"garuda", "lion"},
+				ProviderResults:   map[string]domain.FlightSearchResult{"garuda": garuda},
+				ProvidersDueAt:    now.Add(time.Minute),
+				ExpiresAt:         now.Add(time.Minute),
+			},
+		},
+		{
+			name: "every provider answered",
+			state: domain.SearchState{
+				ExpectedProviders: []string{"garuda"},
+				ProviderResults:   map[string]domain.FlightSearchResult{"garuda": garuda},
+				ProvidersDueAt:    now.Add(time.Minute),
+				ExpiresAt:         now.Add(time.Minute),
+			},
+			want: domain.SearchStatusCompleted,
+		},
+		{
+			name: "provider deadline passed",
+			state: domain.SearchState{
+				ExpectedProviders: []string{"garuda", "lion"},
+				ProviderResults:   map[string]domain.FlightSearchResult{"garuda": garuda},
+				ProvidersDueAt:    now.Add(-time.Second),
+				ExpiresAt:         now.Add(time.Minute),
+			},
+			want: domain.SearchStatusCompleted,
+		},
+		{
+			name: "nobody answered in time",
+			state: domain.SearchState{
+				ExpectedProviders: []string{"garuda"},
+				ProvidersDueAt:    now.Add(-time.Minute),
+				ExpiresAt:         now.Add(-time.Second),
+			},
+			want: domain.SearchStatusExpired,
+		},
+		{
+			name: "cancelled",
+			state: domain.SearchState{
+				Status:            domain.SearchStatusCancelled,
+				ExpectedProviders: []string{"garuda"},
+				ProvidersDueAt:    now.Add(-time.Minute),
+				ExpiresAt:         now.Add(-time.Second),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.state.SearchID = "s1"
+			repo := &fakeStateRepo{state: tt.state, finished: make(map[string]bool)}
+			uc := NewFlightUseCase(repo, nil, FlightUseCaseConfig{}, zap.NewNop()).(*flightUseCase)
+
+			var before float64
+			if tt.want != "" {
+				before = testutil.ToFloat64(metrics.SearchesCompleted.WithLabelValues(tt.want))
+			}
+
+			// Checking again, as another process would, counts nothing more.
+			uc.checkFinished(ctx, "s1")
+			uc.checkFinished(ctx, "s1")
+			uc.checkFinished(ctx, "unknown")
+
+			assert.Equal(t, tt.want != "", repo.finished["s1"])
+			if tt.want != "" {
+				assert.Equal(t, before+1, testutil.ToFloat64(metrics.SearchesCompleted.WithLabelValues(tt.want)))
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"example.com/main-service/internal/domain"
+	"go.uber.org/zap"
+)
+
+// requestFingerprint identifies the search to run, with its defaults
+// applied so that spelling them out does not make a retry differ. The
+// search ID is new on every request and does not count.
+func requestFingerprint(req domain.FlightSearchRequest) (string, error) {
+	req.SearchID = ""
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal search request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// idempotencyKey scopes the request's idempotency key to its client.
+func idempotencyKey(req domain.CreateSearchBody) string {
+	return req.Client + ":" + req.IdempotencyKey
+}
+
+// reserveIdempotencyKey claims the request's idempotency key for search.
+// When the key is already taken by the same search it returns the original
+// record and false; by a different search, domain.ErrIdempotencyConflict.
+func (uc *flightUseCase) reserveIdempotencyKey(ctx context.Context, req domain.CreateSearchBody, search domain.FlightSearchRequest) (domain.IdempotencyRecord, bool, error) {
+	fingerprint, err := requestFingerprint(search)
+	if err != nil {
+		return domain.IdempotencyRecord{}, false, err
+	}
+
+	rec, reserved, err := uc.repo.ReserveIdempotencyKey(ctx, idempotencyKey(req), domain.IdempotencyRecord{
+		Fingerprint: fingerprint,
+		SearchID:    search.SearchID,
+	}, uc.cfg.IdempotencyTTL)
+	if err != nil {
+		uc.log.Error("Failed to reserve idempotency key", zap.Error(err))
+		return domain.IdempotencyRecord{}, false, err
+	}
+	if !reserved && rec.Fingerprint != fingerprint {
+		return domain.IdempotencyRecord{}, false, domain.ErrIdempotencyConflict
+	}
+	return rec, reserved, nil
+}
+
+// replaySearch answers a retry with the search the idempotency key started.
+// The search may not be saved yet when the first request is still being
+// handled, in which case it is reported as processing.
+func (uc *flightUseCase) replaySearch(ctx context.Context, rec domain.IdempotencyRecord) domain.SearchSubmission {
+	sub := domain.SearchSubmission{
+		SearchID: rec.SearchID,
+		Status:   domain.SearchStatusProcessing,
+		Replayed: true,
+	}
+	if state, err := uc.GetSearch(ctx, rec.SearchID); err == nil {
+		sub.Status = state.Status
+		// Only searches sent to the providers carry a cache key.
+		sub.Cached = state.CacheKey == ""
+	}
+
+	uc.log.Info("Flight search replayed for idempotency key", zap.String("search_id", rec.SearchID))
+	return sub
+}
@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeIdempotencyRepo keeps idempotency records in memory. The other
+// repository methods are not expected to be called.
+type fakeIdempotencyRepo struct {
+	repository.IFlightRepository
+	records map[string]domain.IdempotencyRecord
+}
+
+func (f *fakeIdempotencyRepo) ReserveIdempotencyKey(ctx context.Context, key string, rec domain.IdempotencyRecord, ttl time.Duration) (domain.IdempotencyRecord, bool, error) {
+	if existing, ok := f.records[key]; ok {
+		return existing, false, nil
+	}
+	f.records[key] = rec
+	return rec, true, nil
+}
+
+// searchRequest builds the search body describes, as SearchFlights does.
+func searchRequest(t *testing.T, body domain.CreateSearchBody, searchID string) domain.FlightSearchRequest {
+	t.Helper()
+	tripType, legs, err := buildLegs(body)
+	require.NoError(t, err)
+	return newSearchRequest(body, searchID, tripType, legs)
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	body := domain.CreateSearchBody{From: "CGK", To: "DPS", Date: "2025-07-10", Passengers: 1, SortBy: domain.SortByPrice}
+	fp, err := requestFingerprint(searchRequest(t, body, "s1"))
+	require.NoError(t, err)
+
+	// Header-driven fields, the search ID and defaults spelled out do not
+	// change the fingerprint.
+	retry := body
+	retry.IdempotencyKey = "key-1"
+	retry.BypassCache = true
+	retry.TripType = domain.TripOneWay
+	retry.CabinClass = domain.CabinEconomy
+	retry.SortOrder = domain.SortAsc
+	got, err := requestFingerprint(searchRequest(t, retry, "s2"))
+	require.NoError(t, err)
+	assert.Equal(t, fp, got)
+
+	other := body
+	other.Passengers = 2
+	got, err = requestFingerprint(searchRequest(t, other, "s1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, fp, got)
+}
+
+func TestReserveIdempotencyKey_ScopedToClient(t *testing.T) {
+	repo := &fakeIdempotencyRepo{records: make(map[string]domain.IdempotencyRecord)}
+	uc := NewFlightUseCase(repo, nil, FlightUseCaseConfig{}, zap.NewNop()).(*flightUseCase)
+	ctx := context.Background()
+
+	body := domain.CreateSearchBody{From: "CGK", To: "DPS", Date: "2025-07-10", Passengers: 1, IdempotencyKey: "retry-1"}
+	alice, bob := body, body
+	alice.Client = "key:alice"
+	bob.Client = "key:bob"
+
+	rec, reserved, err := uc.reserveIdempotencyKey(ctx, alice, searchRequest(t, alice, "search-a"))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, "search-a", rec.SearchID)
+
+	// The same key and body from another client starts a search of its own
+	// instead of returning alice's.
+	rec, reserved, err = uc.reserveIdempotencyKey(ctx, bob, searchRequest(t, bob, "search-b"))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, "search-b", rec.SearchID)
+
+	// Nor does another body conflict with alice's use of the key.
+	other := bob
+	other.Client = "key:carol"
+	other.Passengers = 2
+	_, reserved, err = uc.reserveIdempotencyKey(ctx, other, searchRequest(t, other, "search-c"))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	// alice's retry is answered with her search.
+	rec, reserved, err = uc.reserveIdempotencyKey(ctx, alice, searchRequest(t, alice, "search-d"))
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, "search-a", rec.SearchID)
+}
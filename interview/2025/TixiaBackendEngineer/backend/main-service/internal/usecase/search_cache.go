@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+// searchCacheKey identifies the searches providers answer identically.
+// Filters and sort order are applied by main-service on the raw results and
+// so are left out, as is the search ID. The providers are part of the key so
+// a change of providers does not serve incomplete results.
+func searchCacheKey(req domain.FlightSearchRequest, providers []string) string {
+	legs := make([]string, len(req.Legs))
+	for i, leg := range req.Legs {
+		legs[i] = leg.From + "-" + leg.To + "-" + leg.Date
+	}
+	sorted := append([]string(nil), providers...)
+	sort.Strings(sorted)
+
+	return fmt.Sprintf("%s:%d:%s:%s:%s",
+		req.TripType,
+		req.Passengers,
+		req.CabinClass,
+		strings.Join(legs, ","),
+		strings.Join(sorted, ","),
+	)
+}
+
+// cachedResults looks the request up in the result cache. Lookup errors are
+// logged and treated as misses.
+func (uc *flightUseCase) cachedResults(ctx context.Context, key string, bypass bool) map[string]domain.FlightSearchResult {
+	if uc.cfg.CacheTTL <= 0 {
+		return nil
+	}
+	if bypass {
+		uc.countCacheStat(ctx, repository.CacheStatBypass)
+		return nil
+	}
+
+	results, err := uc.repo.GetCachedResults(ctx, key)
+	if err != nil {
+		if !errors.Is(err, domain.ErrCacheMiss) {
+			uc.log.Warn("Failed to read result cache", zap.String("cache_key", key), zap.Error(err))
+		}
+		uc.countCacheStat(ctx, repository.CacheStatMiss)
+		return nil
+	}
+	uc.countCacheStat(ctx, repository.CacheStatHit)
+	return results
+}
+
+// cacheResults caches the provider results of a search that every provider
+// answered successfully.
+func (uc *flightUseCase) cacheResults(ctx context.Context, state *domain.SearchState, final domain.FlightSearchResult, answered map[string]domain.FlightSearchResult) {
+	if uc.cfg.CacheTTL <= 0 || state.CacheKey == "" || len(final.FailedProviders) > 0 {
+		return
+	}
+	if final.Status != domain.SearchStatusCompleted && final.Status != domain.SearchStatusNotFound {
+		return
+	}
+	if err := uc.repo.CacheResults(ctx, state.CacheKey, answered, uc.cfg.CacheTTL); err != nil {
+		uc.log.Warn("Failed to cache search results", zap.String("search_id", state.SearchID), zap.Error(err))
+	}
+}
+
+func (uc *flightUseCase) countCacheStat(ctx context.Context, stat string) {
+	if err := uc.repo.IncrCacheStat(ctx, stat); err != nil {
+		uc.log.Warn("Failed to count cache stat", zap.String("stat", stat), zap.Error(err))
+	}
+}
+
+func (uc *flightUseCase) CacheStats(ctx context.Context) (domain.CacheStats, error) {
+	return uc.repo.GetCacheStats(ctx)
+}
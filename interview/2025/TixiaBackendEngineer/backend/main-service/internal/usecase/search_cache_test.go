@@ -0,0 +1,33 @@
+package usecase
+
+import (
+	"testing"
+
+	"example.com/main-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchCacheKey(t *testing.T) {
+	base := domain.FlightSearchRequest{
+		SearchID:   "s1",
+		TripType:   domain.TripOneWay,
+		Legs:       []domain.SearchLeg{{From: "CGK", To: "DPS", Date: "2025-07-10"}},
+		Passengers: 2,
+		CabinClass: domain.CabinEconomy,
+	}
+	key := searchCacheKey(base, []string{"lion", "garuda"})
+	assert.Equal(t, "one_way:2:economy:CGK-DPS-2025-07-10:garuda,lion", key)
+
+	// Filters, sort order and the search ID are applied after the cache.
+	other := base
+	other.SearchID = "s2"
+	other.Filters = &domain.SearchFilters{MaxPrice: 100}
+	other.SortBy = domain.SortByPrice
+	assert.Equal(t, key, searchCacheKey(other, []string{"garuda", "lion"}))
+
+	other = base
+	other.Passengers = 3
+	assert.NotEqual(t, key, searchCacheKey(other, []string{"garuda", "lion"}))
+
+	assert.NotEqual(t, key, searchCacheKey(base, []string{"garuda"}))
+}
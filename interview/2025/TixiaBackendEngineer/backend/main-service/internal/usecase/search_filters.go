@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"sort"
+	"strings"
+
+	"example.com/main-service/internal/domain"
+)
+
+// applySearchOptions filters and sorts the flights of a result according to
+// the options stored on the request. Itineraries that reference a filtered
+// out flight are dropped as well.
+func applySearchOptions(req domain.FlightSearchRequest, results []domain.Flight, legs []domain.LegResult, itineraries []domain.Itinerary) ([]domain.Flight, []domain.LegResult, []domain.Itinerary) {
+	if req.Filters == nil && req.SortBy == "" {
+		return results, legs, itineraries
+	}
+
+	kept := make(map[string]domain.Flight)
+	results = filterFlights(req.Filters, results, kept)
+	sortFlights(req.SortBy, req.SortOrder, results)
+
+	filteredLegs := make([]domain.LegResult, len(legs))
+	for i, leg := range legs {
+		leg.Flights = filterFlights(req.Filters, leg.Flights, kept)
+		sortFlights(req.SortBy, req.SortOrder, leg.Flights)
+		filteredLegs[i] = leg
+	}
+
+	var filteredItineraries []domain.Itinerary
+	for _, it := range itineraries {
+		complete := true
+		for _, id := range it.FlightIDs {
+			if _, ok := kept[id]; !ok {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			filteredItineraries = append(filteredItineraries, it)
+		}
+	}
+	sortItineraries(req.SortBy, req.SortOrder, filteredItineraries, kept)
+
+	return results, filteredLegs, filteredItineraries
+}
+
+// filteredStatus reports a completed search whose flights were all filtered
+// out as not found, the same as if no provider had found any.
+func filteredStatus(req domain.FlightSearchRequest, status string, results []domain.Flight, itineraries []domain.Itinerary) string {
+	if status != domain.SearchStatusCompleted {
+		return status
+	}
+	found := len(results) > 0
+	if len(req.Legs) > 1 {
+		found = len(itineraries) > 0
+	}
+	if !found {
+		return domain.SearchStatusNotFound
+	}
+	return status
+}
+
+// filterFlights returns the flights passing filters and records them in
+// kept by ID.
+func filterFlights(filters *domain.SearchFilters, flights []domain.Flight, kept map[string]domain.Flight) []domain.Flight {
+	filtered := make([]domain.Flight, 0, len(flights))
+	for _, f := range flights {
+		if matchesFilters(filters, f) {
+			filtered = append(filtered, f)
+			kept[f.ID] = f
+		}
+	}
+	return filtered
+}
+
+func matchesFilters(filters *domain.SearchFilters, f domain.Flight) bool {
+	if filters == nil {
+		return true
+	}
+	if filters.MaxPrice > 0 && passengerPrice(f) > filters.MaxPrice {
+		return false
+	}
+	if len(filters.Airlines) > 0 {
+		found := false
+		for _, airline := range filters.Airlines {
+			if strings.EqualFold(airline, f.Airline) || strings.EqualFold(airline, airlineCode(f.FlightNumber)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !inWindow(filters.DepartureWindow, f.DepartureTime) {
+		return false
+	}
+	if !inWindow(filters.ArrivalWindow, f.ArrivalTime) {
+		return false
+	}
+	return true
+}
+
+// passengerPrice is the price of a flight for one passenger. Price is the
+// total for all passengers once a provider has priced the search.
+func passengerPrice(f domain.Flight) float64 {
+	if f.PricePerPassenger > 0 {
+		return f.PricePerPassenger
+	}
+	return f.Price
+}
+
+// airlineCode returns the IATA designator of a flight number such as GA123.
+func airlineCode(flightNumber string) string {
+	if len(flightNumber) < 2 {
+		return ""
+	}
+	return flightNumber[:2]
+}
+
+func inWindow(window *domain.TimeWindow, flightTime string) bool {
+	if window == nil {
+		return true
+	}
+	t, ok := domain.ParseFlightTime(flightTime)
+	if !ok {
+		return false
+	}
+	clock := t.Format("15:04")
+	if window.From <= window.To {
+		return clock >= window.From && clock <= window.To
+	}
+	return clock >= window.From || clock <= window.To
+}
+
+func sortFlights(sortBy, order string, flights []domain.Flight) {
+	if sortBy == "" {
+		return
+	}
+	sort.SliceStable(flights, func(i, j int) bool {
+		a, b := flightSortKey(sortBy, flights[i]), flightSortKey(sortBy, flights[j])
+		if order == domain.SortDesc {
+			return a > b
+		}
+		return a < b
+	})
+}
+
+func sortItineraries(sortBy, order string, itineraries []domain.Itinerary, flights map[string]domain.Flight) {
+	if sortBy == "" {
+		return
+	}
+	key := func(it domain.Itinerary) float64 {
+		first, last := flights[it.FlightIDs[0]], flights[it.FlightIDs[len(it.FlightIDs)-1]]
+		switch sortBy {
+		case domain.SortByDepartureTime:
+			return flightSortKey(sortBy, first)
+		case domain.SortByDuration:
+			dep, _ := domain.ParseFlightTime(first.DepartureTime)
+			arr, _ := domain.ParseFlightTime(last.ArrivalTime)
+			return arr.Sub(dep).Minutes()
+		}
+		return it.TotalPrice
+	}
+	sort.SliceStable(itineraries, func(i, j int) bool {
+		a, b := key(itineraries[i]), key(itineraries[j])
+		if order == domain.SortDesc {
+			return a > b
+		}
+		return a < b
+	})
+}
+
+func flightSortKey(sortBy string, f domain.Flight) float64 {
+	switch sortBy {
+	case domain.SortByDepartureTime:
+		dep, _ := domain.ParseFlightTime(f.DepartureTime)
+		return float64(dep.Unix())
+	case domain.SortByDuration:
+		dep, _ := domain.ParseFlightTime(f.DepartureTime)
+		arr, _ := domain.ParseFlightTime(f.ArrivalTime)
+		return arr.Sub(dep).Minutes()
+	}
+	return f.Price
+}
@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"testing"
+
+	"example.com/main-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplySearchOptions_FiltersAndSorts(t *testing.T) {
+	flights := []domain.Flight{
+		{ID: "ga", Airline: "Garuda Indonesia", FlightNumber: "GA123", DepartureTime: "2025-07-12 14:00", ArrivalTime: "2025-07-12 17:00", Price: 1000000},
+		{ID: "qz", Airline: "AirAsia Indonesia", FlightNumber: "QZ456", DepartureTime: "2025-07-12 08:30", ArrivalTime: "2025-07-12 11:30", Price: 750000},
+		{ID: "id", Airline: "Batik Air", FlightNumber: "ID234", DepartureTime: "2025-07-12 20:15", ArrivalTime: "2025-07-12 23:15", Price: 900000},
+		{ID: "jt", Airline: "Lion Air", FlightNumber: "JT123", DepartureTime: "2025-07-12 06:00", ArrivalTime: "2025-07-12 07:30", Price: 600000},
+	}
+	legs := []domain.LegResult{{Leg: 0, Flights: flights}}
+
+	req := domain.FlightSearchRequest{
+		Filters: &domain.SearchFilters{
+			MaxPrice:        950000,
+			Airlines:        []string{"QZ", "Batik Air", "Lion Air"},
+			DepartureWindow: &domain.TimeWindow{From: "07:00", To: "21:00"},
+		},
+		SortBy:    domain.SortByPrice,
+		SortOrder: domain.SortDesc,
+	}
+
+	results, gotLegs, _ := applySearchOptions(req, flights, legs, nil)
+
+	ids := func(fs []domain.Flight) []string {
+		var out []string
+		for _, f := range fs {
+			out = append(out, f.ID)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"id", "qz"}, ids(results))
+	assert.Equal(t, []string{"id", "qz"}, ids(gotLegs[0].Flights))
+	assert.Len(t, legs[0].Flights, 4, "input legs must not be modified")
+}
+
+func TestApplySearchOptions_DropsItinerariesWithFilteredFlights(t *testing.T) {
+	out := domain.Flight{ID: "out", DepartureTime: "2025-07-12 08:00", ArrivalTime: "2025-07-12 10:00", Price: 500000}
+	cheapRet := domain.Flight{ID: "ret-cheap", DepartureTime: "2025-07-16 23:30", ArrivalTime: "2025-07-17 01:30", Price: 300000}
+	ret := domain.Flight{ID: "ret", DepartureTime: "2025-07-16 12:00", ArrivalTime: "2025-07-16 14:00", Price: 400000}
+	itineraries := []domain.Itinerary{
+		{FlightIDs: []string{"out", "ret-cheap"}, TotalPrice: 800000},
+		{FlightIDs: []string{"out", "ret"}, TotalPrice: 900000},
+	}
+
+	req := domain.FlightSearchRequest{
+		Filters: &domain.SearchFilters{ArrivalWindow: &domain.TimeWindow{From: "06:00", To: "22:00"}},
+	}
+
+	_, _, got := applySearchOptions(req, []domain.Flight{out, cheapRet, ret}, nil, itineraries)
+
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, []string{"out", "ret"}, got[0].FlightIDs)
+	}
+}
+
+func TestInWindow_WrapsAroundMidnight(t *testing.T) {
+	window := &domain.TimeWindow{From: "22:00", To: "02:00"}
+
+	assert.True(t, inWindow(window, "2025-07-12 23:15"))
+	assert.True(t, inWindow(window, "2025-07-13 01:00"))
+	assert.False(t, inWindow(window, "2025-07-12 12:00"))
+}
+
+func TestApplySearchOptions_MaxPricePerPassenger(t *testing.T) {
+	flights := []domain.Flight{
+		{ID: "cheap", Price: 1800000, PricePerPassenger: 900000, Passengers: 2},
+		{ID: "dear", Price: 2000000, PricePerPassenger: 1000000, Passengers: 2},
+	}
+	req := domain.FlightSearchRequest{Filters: &domain.SearchFilters{MaxPrice: 950000}}
+
+	results, _, _ := applySearchOptions(req, flights, nil, nil)
+
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "cheap", results[0].ID)
+	}
+}
+
+func TestFilteredStatus(t *testing.T) {
+	oneWay := domain.FlightSearchRequest{Legs: []domain.SearchLeg{{From: "CGK", To: "DPS"}}}
+	roundTrip := domain.FlightSearchRequest{Legs: []domain.SearchLeg{{From: "CGK", To: "DPS"}, {From: "DPS", To: "CGK"}}}
+	flights := []domain.Flight{{ID: "ga"}}
+
+	assert.Equal(t, domain.SearchStatusCompleted, filteredStatus(oneWay, domain.SearchStatusCompleted, flights, nil))
+	assert.Equal(t, domain.SearchStatusNotFound, filteredStatus(oneWay, domain.SearchStatusCompleted, nil, nil))
+	assert.Equal(t, domain.SearchStatusNotFound, filteredStatus(roundTrip, domain.SearchStatusCompleted, flights, nil),
+		"flights of one leg make no itinerary")
+	assert.Equal(t, domain.SearchStatusPartial, filteredStatus(oneWay, domain.SearchStatusPartial, nil, nil))
+}
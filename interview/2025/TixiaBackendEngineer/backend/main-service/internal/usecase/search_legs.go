@@ -0,0 +1,172 @@
+package usecase
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/repository"
+)
+
+// maxSuggestions bounds the places suggested for an unknown code.
+const maxSuggestions = 3
+
+// buildLegs turns the request body into the trip type and ordered legs sent
+// to the provider, rejecting legs that go back in time.
+func buildLegs(req domain.CreateSearchBody) (string, []domain.SearchLeg, error) {
+	tripType := req.TripType
+	if tripType == "" {
+		tripType = domain.TripOneWay
+	}
+
+	var legs []domain.SearchLeg
+	switch tripType {
+	case domain.TripOneWay:
+		legs = []domain.SearchLeg{{From: req.From, To: req.To, Date: req.Date}}
+	case domain.TripRoundTrip:
+		legs = []domain.SearchLeg{
+			{From: req.From, To: req.To, Date: req.Date},
+			{From: req.To, To: req.From, Date: req.ReturnDate},
+		}
+	case domain.TripMultiCity:
+		for _, l := range req.Legs {
+			legs = append(legs, domain.SearchLeg{From: l.From, To: l.To, Date: l.Date})
+		}
+	default:
+		return "", nil, fmt.Errorf("%w: unknown trip type %q", domain.ErrInvalidSearch, tripType)
+	}
+
+	if len(legs) == 0 || len(legs) > domain.MaxSearchLegs {
+		return "", nil, fmt.Errorf("%w: a trip needs between 1 and %d legs", domain.ErrInvalidSearch, domain.MaxSearchLegs)
+	}
+
+	var prev time.Time
+	for i, l := range legs {
+		if l.From == l.To {
+			return "", nil, fmt.Errorf("%w: leg %d departs and arrives at %s", domain.ErrInvalidSearch, i+1, l.From)
+		}
+		date, err := time.Parse("2006-01-02", l.Date)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: leg %d has invalid date %q", domain.ErrInvalidSearch, i+1, l.Date)
+		}
+		if date.Before(prev) {
+			return "", nil, fmt.Errorf("%w: leg %d departs before leg %d", domain.ErrInvalidSearch, i+1, i)
+		}
+		prev = date
+	}
+
+	return tripType, legs, nil
+}
+
+// resolveLegs checks the codes of legs against the airport reference data.
+// When cities is set it lists the airports of the city codes, so the
+// providers match flights from any of them; otherwise the providers would
+// only match the city code itself, so city codes are rejected.
+func resolveLegs(airports repository.IAirportRepository, legs []domain.SearchLeg, cities bool) error {
+	for i := range legs {
+		leg := &legs[i]
+		from, ok := cityAirports(airports, leg.From)
+		if !ok {
+			return unknownLocation(airports, i+1, "departs from", leg.From)
+		}
+		to, ok := cityAirports(airports, leg.To)
+		if !ok {
+			return unknownLocation(airports, i+1, "arrives at", leg.To)
+		}
+		if !cities {
+			if len(from) > 0 {
+				return cityLocation(i+1, "departs from", leg.From, from)
+			}
+			if len(to) > 0 {
+				return cityLocation(i+1, "arrives at", leg.To, to)
+			}
+		}
+		leg.FromAirports, leg.ToAirports = from, to
+
+		destinations := leg.Destinations()
+		for _, code := range leg.Origins() {
+			if slices.Contains(destinations, code) {
+				return fmt.Errorf("%w: leg %d departs and arrives at %s", domain.ErrInvalidSearch, i+1, code)
+			}
+		}
+	}
+	return nil
+}
+
+// cityAirports returns the airports code stands for when it is a city code,
+// and false when it is neither an airport nor a city.
+func cityAirports(airports repository.IAirportRepository, code string) ([]string, bool) {
+	if _, ok := airports.GetAirport(code); ok {
+		return nil, true
+	}
+	if city, ok := airports.GetCity(code); ok {
+		return slices.Clone(city.Airports), true
+	}
+	return nil, false
+}
+
+// unknownLocation reports the unknown code of a leg with the places it may
+// be a typo of.
+func unknownLocation(airports repository.IAirportRepository, leg int, verb, code string) error {
+	msg := fmt.Sprintf("leg %d %s unknown airport or city %s", leg, verb, code)
+	if suggestions := suggestPlaces(airports.Places(), code); len(suggestions) > 0 {
+		msg += ", did you mean " + strings.Join(suggestions, ", ") + "?"
+	}
+	return fmt.Errorf("%w: %s", domain.ErrInvalidSearch, msg)
+}
+
+// cityLocation reports a city code of a leg with the airports to search
+// instead.
+func cityLocation(leg int, verb, code string, airports []string) error {
+	return fmt.Errorf("%w: leg %d %s city %s, search one of its airports: %s",
+		domain.ErrInvalidSearch, leg, verb, code, strings.Join(airports, ", "))
+}
+
+// suggestPlaces returns up to maxSuggestions places code may be a typo of:
+// the codes one letter or one swap of neighbouring letters away, then the
+// cities starting with it.
+func suggestPlaces(places []domain.Place, code string) []string {
+	var suggestions []string
+	seen := make(map[string]bool)
+	add := func(p domain.Place) {
+		if len(suggestions) < maxSuggestions && !seen[p.Code] {
+			seen[p.Code] = true
+			suggestions = append(suggestions, fmt.Sprintf("%s (%s)", p.Code, p.City))
+		}
+	}
+	for _, p := range places {
+		if isTypoOf(code, p.Code) {
+			add(p)
+		}
+	}
+	for _, p := range places {
+		if strings.HasPrefix(strings.ToUpper(p.City), code) {
+			add(p)
+		}
+	}
+	return suggestions
+}
+
+// isTypoOf reports whether a differs from b by one letter or by one swap of
+// neighbouring letters.
+func isTypoOf(a, b string) bool {
+	if len(a) != len(b) || a == b {
+		return false
+	}
+	var diff []int
+	for i := range a {
+		if a[i] != b[i] {
+			diff = append(diff, i)
+		}
+	}
+	switch len(diff) {
+	case 1:
+		return true
+	case 2:
+		i, j := diff[0], diff[1]
+		return j == i+1 && a[i] == b[j] && a[j] == b[i]
+	}
+	return false
+}
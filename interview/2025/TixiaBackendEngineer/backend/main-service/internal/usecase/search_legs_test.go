@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"testing"
+
+	"example.com/main-service/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveLegs_ExpandsCityCodes(t *testing.T) {
+	legs := []domain.SearchLeg{
+		{From: "JKT", To: "DPS", Date: "2025-08-15"},
+		{From: "DPS", To: "JKT", Date: "2025-08-20"},
+	}
+	require.NoError(t, resolveLegs(newFakeAirportRepo(), legs, true))
+
+	assert.Equal(t, []domain.SearchLeg{
+		{From: "JKT", To: "DPS", Date: "2025-08-15", FromAirports: []string{"CGK", "HLP"}},
+		{From: "DPS", To: "JKT", Date: "2025-08-20", ToAirports: []string{"CGK", "HLP"}},
+	}, legs)
+}
+
+func TestResolveLegs_RejectsCityCodesBeforeSchemaV3(t *testing.T) {
+	err := resolveLegs(newFakeAirportRepo(), []domain.SearchLeg{{From: "DPS", To: "JKT", Date: "2025-08-15"}}, false)
+	assert.ErrorIs(t, err, domain.ErrInvalidSearch)
+	assert.EqualError(t, err, "invalid search: leg 1 arrives at city JKT, search one of its airports: CGK, HLP")
+}
+
+func TestResolveLegs_RejectsInvalidCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		leg  domain.SearchLeg
+		want string
+	}{
+		{
+			name: "swapped letters",
+			leg:  domain.SearchLeg{From: "CKG", To: "DPS"},
+			want: "invalid search: leg 1 departs from unknown airport or city CKG, did you mean CGK (Jakarta)?",
+		},
+		{
+			name: "city prefix",
+			leg:  domain.SearchLeg{From: "CGK", To: "SUR"},
+			want: "invalid search: leg 1 arrives at unknown airport or city SUR, did you mean SUB (Surabaya)?",
+		},
+		{
+			name: "no suggestion",
+			leg:  domain.SearchLeg{From: "XYZ", To: "DPS"},
+			want: "invalid search: leg 1 departs from unknown airport or city XYZ",
+		},
+		{
+			name: "airport of the origin city",
+			leg:  domain.SearchLeg{From: "JKT", To: "HLP"},
+			want: "invalid search: leg 1 departs and arrives at HLP",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := resolveLegs(newFakeAirportRepo(), []domain.SearchLeg{tt.leg}, true)
+			assert.ErrorIs(t, err, domain.ErrInvalidSearch)
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
@@ -0,0 +1,233 @@
+// Package service assembles main-service from its config: the Fiber app
+// with its routes and the workers feeding it. cmd/main.go runs it as the
+// service and the end-to-end tests run it in-process.
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"example.com/bus"
+	"example.com/contract"
+	"example.com/main-service/internal/config"
+	"example.com/main-service/internal/domain"
+	"example.com/main-service/internal/handler"
+	"example.com/main-service/internal/middleware"
+	"example.com/main-service/internal/prefork"
+	"example.com/main-service/internal/repository"
+	"example.com/main-service/internal/usecase"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Name identifies main-service in logs, traces and published messages.
+const Name = "main-service"
+
+// Config holds every setting of main-service.
+type Config = config.Config
+
+// DefaultConfig returns the settings used for everything left unset.
+func DefaultConfig() Config {
+	return config.Default()
+}
+
+// drainer ends the open streams of the flight handler on shutdown.
+type drainer interface {
+	StopReady()
+	Drain()
+	Wait(ctx context.Context) error
+}
+
+// Service is main-service: its HTTP app and the workers behind it.
+type Service struct {
+	// App serves the API; listening is left to the caller.
+	App *fiber.App
+
+	hub     *repository.ResultHub
+	janitor *repository.StreamJanitor
+	flights drainer
+	// drainDelay is how long readiness fails before draining.
+	drainDelay time.Duration
+	// metrics shares the registry of this process with its prefork
+	// siblings; nil without prefork.
+	metrics *prefork.Metrics
+	log     *zap.Logger
+
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// New assembles the service. Search state lives in rdb and the search
+// streams are exchanged through b.
+func New(cfg *Config, rdb *redis.Client, b bus.IBus, log *zap.Logger) *Service {
+	streams := cfg.StreamNames()
+
+	app := fiber.New(fiber.Config{
+		Prefork:       cfg.Service.Prefork,
+		CaseSensitive: true,
+		StrictRouting: true,
+		ServerHeader:  "Fiber",
+		AppName:       Name,
+	})
+
+	resultHub := repository.NewResultHub(rdb, b, streams, log)
+	janitor := repository.NewStreamJanitor(rdb, repository.StreamJanitorConfig{
+		Retention:   cfg.Streams.Retention,
+		IdleTimeout: cfg.Streams.IdleTimeout,
+		Interval:    cfg.Streams.JanitorInterval,
+		Streams:     streams.All(),
+	}, log)
+
+	encoder := contract.Encoder{Version: cfg.Streams.SchemaVersion, Producer: Name}
+	flightRepo := repository.NewFlightRepository(rdb, b, resultHub, streams, encoder, cfg.Streams.Retention, log)
+	airportRepo := repository.NewAirportRepository()
+	flightUc := usecase.NewFlightUseCase(flightRepo, airportRepo, usecase.FlightUseCaseConfig{
+		SearchDeadline:   cfg.Search.Deadline,
+		ProviderDeadline: cfg.Search.ProviderDeadline,
+		Providers:        cfg.Search.Providers,
+		AbandonGrace:     cfg.Search.AbandonGrace,
+		CacheTTL:         cfg.Search.CacheTTL,
+		IdempotencyTTL:   cfg.Search.IdempotencyTTL,
+		SchemaVersion:    cfg.Streams.SchemaVersion,
+	}, log)
+	resultHub.OnRecorded(flightUc.ResultRecorded)
+	flightHandler := handler.NewFlightHandler(flightUc, cfg.Service.SSEHeartbeat, cfg.Service.ReconnectDelay, cfg.Search.Deadline, log)
+	airportHandler := handler.NewAirportHandler(usecase.NewAirportUseCase(airportRepo), log)
+
+	rateLimitRepo := repository.NewRateLimitRepository(rdb)
+	rateLimitCfg := middleware.RateLimitConfig{
+		Window:     cfg.Auth.RateLimitWindow,
+		IPLimit:    cfg.Auth.IPRateLimit,
+		PlanLimits: domain.DefaultPlanLimits,
+	}
+	apiKeyRepo := repository.NewAPIKeyRepository(rdb)
+	apiMiddleware := []fiber.Handler{middleware.RateLimitIP(rateLimitRepo, rateLimitCfg, log)}
+	if cfg.Auth.RequireAPIKey {
+		apiMiddleware = append(apiMiddleware,
+			middleware.APIKeyAuth(apiKeyRepo, log),
+			middleware.RateLimitAPIKey(rateLimitRepo, rateLimitCfg, log),
+		)
+	}
+
+	adminUc := usecase.NewAdminUseCase(repository.NewAdminRepository(rdb), streams.All(), log)
+	adminHandler := handler.NewAdminHandler(adminUc, log)
+
+	// Every prefork process has its own registry, and a scrape lands on any
+	// one child: each of them serves the metrics of all.
+	var preforkMetrics *prefork.Metrics
+	var gatherer prometheus.Gatherer = prometheus.DefaultGatherer
+	if cfg.Service.Prefork {
+		preforkMetrics = prefork.NewMetrics(prometheus.DefaultGatherer, log)
+		gatherer = preforkMetrics
+	}
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}),
+	)))
+
+	healthHandler := handler.NewHealthHandler(map[string]handler.ReadinessCheck{
+		"redis": func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		},
+		"result_hub": func(context.Context) error {
+			return resultHub.Ready(cfg.Service.ProgressTimeout)
+		},
+		"server": flightHandler.Ready,
+	}, log)
+	app.Get("/healthz", healthHandler.Liveness)
+	app.Get("/readyz", healthHandler.Readiness)
+
+	app.Use(middleware.RealIP(cfg.Service.ProxyHeader, cfg.Service.TrustedProxies, log), middleware.Metrics(), middleware.Tracing())
+	apiV1 := app.Group("api/v1", apiMiddleware...)
+	apiV1.Post("/flights/search", flightHandler.RejectWhileDraining, flightHandler.SearchFlights)
+	apiV1.Get("/flights/cache/stats", flightHandler.CacheStats)
+	apiV1.Get("/flights/search/:search_id", flightHandler.GetSearch)
+	apiV1.Delete("/flights/search/:search_id", flightHandler.CancelSearch)
+	apiV1.Get("/flights/search/:search_id/stream", flightHandler.StreamFlightResults)
+	apiV1.Get("/flights/ws", flightHandler.RejectWhileDraining, flightHandler.UpgradeWebSocket, websocket.New(flightHandler.FlightsWebSocket))
+	apiV1.Get("/airports", airportHandler.SearchAirports)
+
+	// The admin API always needs an admin key, even when the rest of the
+	// API is open.
+	admin := app.Group("admin",
+		middleware.RateLimitIP(rateLimitRepo, rateLimitCfg, log),
+		middleware.APIKeyAuth(apiKeyRepo, log),
+		middleware.RequireAdmin(log),
+	)
+	admin.Get("/searches", adminHandler.ActiveSearches)
+	admin.Get("/subscriptions", adminHandler.Subscriptions)
+	admin.Get("/streams", adminHandler.StreamHealth)
+
+	return &Service{
+		App:        app,
+		hub:        resultHub,
+		janitor:    janitor,
+		flights:    flightHandler,
+		drainDelay: cfg.Service.DrainDelay,
+		metrics:    preforkMetrics,
+		log:        log,
+		cancel:     func() {},
+	}
+}
+
+// Start runs the result hub and the stream janitor until Stop is called.
+func (s *Service) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	if s.metrics != nil {
+		if err := s.metrics.Serve(); err != nil {
+			s.log.Error("Failed to share metrics with prefork siblings", zap.Error(err))
+		}
+	}
+
+	s.workers.Add(2)
+	go func() {
+		defer s.workers.Done()
+		if err := s.hub.Start(ctx); err != nil {
+			s.log.Error("Result hub stopped with error", zap.Error(err))
+		}
+	}()
+	go func() {
+		defer s.workers.Done()
+		s.janitor.Start(ctx)
+	}()
+}
+
+// Shutdown fails readiness for the drain delay, so the load balancer
+// stops sending new clients, then refuses new searches and tells the open
+// streams to reconnect before the listener closes. It waits for the
+// streams to end or ctx to be done.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.flights.StopReady()
+	select {
+	case <-time.After(s.drainDelay):
+	case <-ctx.Done():
+	}
+	s.flights.Drain()
+	var errs []error
+	if err := s.App.ShutdownWithContext(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.flights.Wait(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Stop ends the workers started by Start and waits for them.
+func (s *Service) Stop() {
+	s.cancel()
+	s.workers.Wait()
+	if s.metrics != nil {
+		if err := s.metrics.Close(); err != nil {
+			s.log.Warn("Failed to close metrics socket", zap.Error(err))
+		}
+	}
+}
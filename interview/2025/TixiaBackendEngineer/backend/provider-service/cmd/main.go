@@ -3,24 +3,25 @@ package main
 import (
 	"context"
 	"flag"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"example.com/provider-service/internal/repository"
-	"example.com/provider-service/internal/worker"
+	"example.com/bus"
+	"example.com/provider-service/internal/config"
+	"example.com/provider-service/internal/health"
+	"example.com/provider-service/internal/metrics"
+	"example.com/provider-service/service"
+	"example.com/telemetry"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
-var (
-	serviceName  = "provider-service"
-	serviceLevel string
-)
-
 func main() {
-	flag.StringVar(&serviceLevel, "serviceLevel", "development", "Service level: development or production")
+	configFile := flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG_FILE"), "Path of the YAML config file; settings are overridden by "+config.EnvPrefix+"* environment variables")
 	flag.Parse()
 
 	baseLogger, err := zap.NewProduction()
@@ -29,27 +30,59 @@ func main() {
 	}
 	defer baseLogger.Sync()
 
-	logger := baseLogger.With(zap.String("service", serviceName))
+	logger := baseLogger.With(zap.String("service", service.Name))
 
-	redisAddr := "localhost:6379"
-	if serviceLevel == "production" {
-		redisAddr = "redis:6379"
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		logger.Fatal("Failed to load config", zap.String("file", *configFile), zap.Error(err))
+	}
+	logger.Info("Loaded config", zap.String("file", *configFile), zap.Any("config", cfg.Redacted()))
+
+	shutdownTracing, err := telemetry.Setup(context.Background(), telemetry.Config{
+		ServiceName:  service.Name,
+		Exporter:     cfg.Telemetry.TraceExporter,
+		FilePath:     cfg.Telemetry.TraceFile,
+		OTLPEndpoint: cfg.Telemetry.OTLPEndpoint,
+		SampleRatio:  cfg.Telemetry.TraceSampleRatio,
+	})
+	if err != nil {
+		logger.Fatal("Failed to set up tracing", zap.Error(err))
 	}
 
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: "",
-		DB:       0,
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
 	})
-	defer rdb.Close()
 
-	repo := repository.NewFlightRepository("tmp/sample.json", logger)
-	consumer := worker.NewFlightSearchConsumer(repo, rdb, logger)
+	consumer := service.New(cfg, bus.NewRedis(rdb), logger)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
+	var httpServer *http.Server
+	if httpPort := cfg.Service.HTTPPort; httpPort != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+		mux.Handle("/healthz", health.Liveness())
+		mux.Handle("/readyz", health.Readiness(map[string]health.Check{
+			"redis": func(ctx context.Context) error {
+				return rdb.Ping(ctx).Err()
+			},
+			"consumer": func(ctx context.Context) error {
+				return consumer.Ready(ctx, cfg.Service.ProgressTimeout)
+			},
+		}))
+		httpServer = &http.Server{Addr: ":" + httpPort, Handler: mux}
+		go func() {
+			logger.Info("Starting HTTP server", zap.String("port", httpPort))
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("HTTP server stopped", zap.Error(err))
+			}
+		}()
+	}
+
 	go func() {
 		if err := consumer.Start(ctx); err != nil {
 			logger.Error("Consumer stopped with error", zap.Error(err))
@@ -62,6 +95,17 @@ func main() {
 	logger.Info("Received shutdown signal", zap.String("signal", sig.String()))
 	cancel()
 	time.Sleep(2 * time.Second)
-	consumer.Stop(context.Background())
+	logger.Info("Closing Redis connection...")
+	if err := rdb.Close(); err != nil {
+		logger.Error("Error closing Redis connection", zap.Error(err))
+	}
+	if httpServer != nil {
+		if err := httpServer.Shutdown(context.Background()); err != nil {
+			logger.Error("Failed to stop HTTP server", zap.Error(err))
+		}
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Error("Failed to flush traces", zap.Error(err))
+	}
 	logger.Info("Shutdown complete")
 }
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"example.com/contract"
+	"example.com/envconfig"
+	"example.com/provider-service/internal/domain"
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables overriding the config file,
+// e.g. PROVIDER_REDIS_ADDR for redis.addr.
+const EnvPrefix = "PROVIDER_"
+
+const redacted = "[REDACTED]"
+
+// Config holds every setting of provider-service. Settings come from
+// Default, overridden by the config file and then by the environment.
+type Config struct {
+	Service   ServiceConfig   `yaml:"service"`
+	Provider  ProviderConfig  `yaml:"provider"`
+	Redis     RedisConfig     `yaml:"redis"`
+	Streams   StreamsConfig   `yaml:"streams"`
+	Telemetry TelemetryConfig `yaml:"telemetry"`
+}
+
+type ServiceConfig struct {
+	// HTTPPort serves /metrics, /healthz and /readyz; empty disables them.
+	HTTPPort string `yaml:"http_port" env:"HTTP_PORT" validate:"omitempty,numeric"`
+	// ProgressTimeout is how long the consumer loop may go without
+	// completing a read before /readyz fails.
+	ProgressTimeout time.Duration `yaml:"progress_timeout" env:"PROGRESS_TIMEOUT" validate:"gt=0"`
+}
+
+type ProviderConfig struct {
+	// ID tags the results of this provider; main-service must list it in
+	// search.providers.
+	ID string `yaml:"id" env:"ID" validate:"required"`
+	// SampleFile is the flight data served by this provider.
+	SampleFile string `yaml:"sample_file" env:"SAMPLE_FILE" validate:"required"`
+	// Deadline is the search.provider_deadline of main-service, after
+	// which the answers of this provider are no longer waited for.
+	Deadline time.Duration `yaml:"deadline" env:"DEADLINE" validate:"gt=0"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr" env:"REDIS_ADDR" validate:"required,hostname_port"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env:"REDIS_DB" validate:"gte=0"`
+}
+
+type StreamsConfig struct {
+	Requested string `yaml:"requested" env:"STREAM_REQUESTED" validate:"required"`
+	Results   string `yaml:"results" env:"STREAM_RESULTS" validate:"required"`
+	Cancelled string `yaml:"cancelled" env:"STREAM_CANCELLED" validate:"required"`
+	// Retention is the minimum age of the results stream entries trimmed on
+	// publish; zero keeps them all.
+	Retention time.Duration `yaml:"retention" env:"STREAM_RETENTION" validate:"gte=0"`
+	// Group defaults to flight_group:<provider id>.
+	Group string `yaml:"group" env:"CONSUMER_GROUP"`
+	// LegacyGroup is a group whose pending requests are answered too: set
+	// it to flight_group on one provider while upgrading from releases
+	// before per-provider groups, until that group has nothing pending.
+	LegacyGroup string `yaml:"legacy_group" env:"LEGACY_CONSUMER_GROUP"`
+	// Consumer names this instance in the group and defaults to
+	// <hostname>-<pid>. Instances of the same provider must use distinct
+	// names.
+	Consumer string `yaml:"consumer" env:"CONSUMER_NAME"`
+	// SchemaVersion of the published results, the current envelope version
+	// by default. Lower it to 1 only while a main-service that cannot read
+	// the envelope still runs; results are the same in 2 and 3.
+	SchemaVersion int `yaml:"schema_version" env:"STREAM_SCHEMA_VERSION" validate:"oneof=1 2 3"`
+	// ClaimAfter is how long a request may stay pending with another
+	// instance of the group before this one answers it; zero never claims.
+	// It must stay below provider.deadline, or a claimed request is
+	// answered after main-service stopped waiting for it.
+	ClaimAfter time.Duration `yaml:"claim_after" env:"STREAM_CLAIM_AFTER" validate:"gte=0"`
+}
+
+type TelemetryConfig struct {
+	TraceExporter    string  `yaml:"trace_exporter" env:"TRACE_EXPORTER" validate:"oneof=none stdout file otlp"`
+	TraceFile        string  `yaml:"trace_file" env:"TRACE_FILE" validate:"required_if=TraceExporter file"`
+	OTLPEndpoint     string  `yaml:"otlp_endpoint" env:"OTLP_ENDPOINT" validate:"required_if=TraceExporter otlp"`
+	TraceSampleRatio float64 `yaml:"trace_sample_ratio" env:"TRACE_SAMPLE_RATIO" validate:"gte=0,lte=1"`
+}
+
+// Default returns the settings used for everything the config file and the
+// environment leave out.
+func Default() Config {
+	return Config{
+		Service: ServiceConfig{
+			HTTPPort:        "9091",
+			ProgressTimeout: 30 * time.Second,
+		},
+		Provider: ProviderConfig{
+			ID:         "default",
+			SampleFile: "tmp/sample.json",
+			Deadline:   10 * time.Second,
+		},
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		Streams: StreamsConfig{
+			Requested:     domain.StreamFlightSearchRequested,
+			Results:       domain.StreamFlightSearchResults,
+			Cancelled:     domain.StreamFlightSearchCancelled,
+			Retention:     time.Hour,
+			SchemaVersion: contract.CurrentSchema,
+			ClaimAfter:    5 * time.Second,
+		},
+		Telemetry: TelemetryConfig{
+			TraceExporter:    "none",
+			TraceFile:        "traces.json",
+			OTLPEndpoint:     "localhost:4318",
+			TraceSampleRatio: 1,
+		},
+	}
+}
+
+// Load reads the config file at path, when path is not empty, applies the
+// environment overrides and validates the result.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := envconfig.Apply(&cfg, EnvPrefix); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks every setting and the constraints between them.
+func (c *Config) Validate() error {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		return strings.Split(f.Tag.Get("yaml"), ",")[0]
+	})
+	if err := v.Struct(c); err != nil {
+		var verrs validator.ValidationErrors
+		if !errors.As(err, &verrs) {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		msgs := make([]string, len(verrs))
+		for i, fe := range verrs {
+			field := strings.TrimPrefix(fe.Namespace(), "Config.")
+			msgs[i] = fmt.Sprintf("%s fails %s", field, fe.Tag())
+		}
+		return fmt.Errorf("invalid config: %s", strings.Join(msgs, "; "))
+	}
+
+	var errs []string
+	if c.Streams.ClaimAfter >= c.Provider.Deadline {
+		errs = append(errs, "streams.claim_after must stay below provider.deadline")
+	}
+	streams := c.StreamNames()
+	if streams.Requested == streams.Results || streams.Requested == streams.Cancelled || streams.Results == streams.Cancelled {
+		errs = append(errs, "streams must have distinct names")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// StreamNames returns the configured stream names.
+func (c *Config) StreamNames() domain.Streams {
+	return domain.Streams{
+		Requested: c.Streams.Requested,
+		Results:   c.Streams.Results,
+		Cancelled: c.Streams.Cancelled,
+	}
+}
+
+// Redacted returns the settings as a map fit for logging, with secrets
+// masked.
+func (c *Config) Redacted() map[string]interface{} {
+	cp := *c
+	if cp.Redis.Password != "" {
+		cp.Redis.Password = redacted
+	}
+
+	// A YAML round trip keeps the file's field names and prints durations
+	// as "30s" rather than nanoseconds.
+	var out map[string]interface{}
+	data, err := yaml.Marshal(cp)
+	if err == nil {
+		err = yaml.Unmarshal(data, &out)
+	}
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+
+	"example.com/contract"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("PROVIDER_ID", "lion")
+	t.Setenv("PROVIDER_REDIS_ADDR", "redis:6379")
+	t.Setenv("PROVIDER_REDIS_PASSWORD", "secret")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, "lion", cfg.Provider.ID)
+	assert.Equal(t, "redis:6379", cfg.Redis.Addr)
+	assert.Equal(t, redacted, cfg.Redacted()["redis"].(map[string]interface{})["password"])
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	t.Setenv("PROVIDER_ID", "")
+	t.Setenv("PROVIDER_STREAM_RESULTS", "flight.search.requested")
+
+	_, err := Load("")
+	assert.ErrorContains(t, err, "provider.id fails required")
+
+	t.Setenv("PROVIDER_ID", "lion")
+	_, err = Load("")
+	assert.ErrorContains(t, err, "streams must have distinct names")
+
+	t.Setenv("PROVIDER_STREAM_RESULTS", "flight.search.results")
+	t.Setenv("PROVIDER_STREAM_CLAIM_AFTER", "30s")
+	_, err = Load("")
+	assert.ErrorContains(t, err, "streams.claim_after must stay below provider.deadline")
+}
+
+func TestDefaultPublishesEnvelope(t *testing.T) {
+	t.Setenv("PROVIDER_ID", "lion")
+	shipped, err := Load("../../config.yaml")
+	require.NoError(t, err)
+
+	for name, cfg := range map[string]Config{"default": Default(), "config.yaml": *shipped} {
+		values, err := contract.Encoder{Version: cfg.Streams.SchemaVersion}.SearchResult(contract.SearchResult{
+			SearchID:   "s1",
+			ProviderID: "lion",
+			Status:     contract.StatusCompleted,
+		})
+		require.NoError(t, err, name)
+		assert.Equal(t, contract.CurrentSchema, values["schema_version"], name)
+		assert.Equal(t, contract.TypeSearchResult, values["type"], name)
+	}
+}
@@ -1,26 +1,42 @@
 package domain
 
+import "example.com/contract"
+
+// The messages exchanged with main-service and the flights they carry are
+// defined by the shared contract.
+
 const (
-	StreamFlightSearchRequested = "flight.search.requested"
-	StreamFlightSearchResults   = "flight.search.results"
+	StreamFlightSearchRequested = contract.StreamSearchRequested
+	StreamFlightSearchResults   = contract.StreamSearchResults
+	StreamFlightSearchCancelled = contract.StreamSearchCancelled
 )
 
-type Flight struct {
-	ID            string  `json:"id"`
-	Airline       string  `json:"airline"`
-	FlightNumber  string  `json:"flight_number"`
-	From          string  `json:"from"`
-	To            string  `json:"to"`
-	DepartureTime string  `json:"departure_time"`
-	ArrivalTime   string  `json:"arrival_time"`
-	Price         float64 `json:"price"`
-	Currency      string  `json:"currency"`
-	Available     bool    `json:"available"`
-}
-
-type FlightSearchRequest struct {
-	SearchID string `json:"search_id"`
-	From     string `json:"from"`
-	To       string `json:"to"`
-	Date     string `json:"date"`
-}
+const (
+	CabinEconomy  = contract.CabinEconomy
+	CabinBusiness = contract.CabinBusiness
+	CabinFirst    = contract.CabinFirst
+)
+
+const (
+	TripOneWay    = contract.TripOneWay
+	TripRoundTrip = contract.TripRoundTrip
+	TripMultiCity = contract.TripMultiCity
+
+	MaxSearchLegs = contract.MaxSearchLegs
+)
+
+const (
+	SearchStatusCompleted = contract.StatusCompleted
+	SearchStatusNotFound  = contract.StatusNotFound
+	SearchStatusFailed    = contract.StatusFailed
+)
+
+type (
+	Flight              = contract.Flight
+	SeatInventory       = contract.SeatInventory
+	SearchLeg           = contract.SearchLeg
+	LegResult           = contract.LegResult
+	Itinerary           = contract.Itinerary
+	FlightSearchRequest = contract.SearchRequested
+	FlightSearchResult  = contract.SearchResult
+)
@@ -0,0 +1,20 @@
+package domain
+
+// Streams names the Redis streams the services exchange searches over.
+type Streams struct {
+	Requested string
+	Results   string
+	Cancelled string
+}
+
+// DefaultStreams are the stream names used unless configured otherwise.
+var DefaultStreams = Streams{
+	Requested: StreamFlightSearchRequested,
+	Results:   StreamFlightSearchResults,
+	Cancelled: StreamFlightSearchCancelled,
+}
+
+// All returns the name of every stream.
+func (s Streams) All() []string {
+	return []string{s.Requested, s.Results, s.Cancelled}
+}
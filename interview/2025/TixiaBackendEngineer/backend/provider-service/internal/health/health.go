@@ -0,0 +1,61 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// checkTimeout bounds each readiness check, so a hung dependency fails the
+// probe instead of stalling it.
+const checkTimeout = 2 * time.Second
+
+// Check reports why a dependency is not ready, or nil when it is.
+type Check func(ctx context.Context) error
+
+// Liveness answers 200 as long as the process serves HTTP.
+func Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "ok",
+		})
+	}
+}
+
+// Readiness runs every check and answers 503 if any of them fails, with
+// the outcome of each check by name.
+func Readiness(checks map[string]Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		results := make(map[string]string, len(checks))
+		for name, check := range checks {
+			ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+			err := check(ctx)
+			cancel()
+			if err != nil {
+				status = http.StatusServiceUnavailable
+				results[name] = err.Error()
+				continue
+			}
+			results[name] = "ok"
+		}
+
+		message := "ready"
+		if status != http.StatusOK {
+			message = "not ready"
+		}
+		writeJSON(w, status, map[string]interface{}{
+			"success": status == http.StatusOK,
+			"message": message,
+			"data":    results,
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,90 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type probeResponse struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Data    map[string]string `json:"data"`
+}
+
+// probe serves one request with h and decodes the answer.
+func probe(t *testing.T, h http.Handler) (int, probeResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var body probeResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	return rec.Code, body
+}
+
+func TestLiveness(t *testing.T) {
+	status, body := probe(t, Liveness())
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, probeResponse{Success: true, Message: "ok"}, body)
+}
+
+func TestReadiness(t *testing.T) {
+	var consumerErr error
+	checks := map[string]Check{
+		"redis": func(context.Context) error {
+			return nil
+		},
+		"consumer": func(context.Context) error {
+			return consumerErr
+		},
+	}
+
+	status, body := probe(t, Readiness(checks))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, probeResponse{
+		Success: true,
+		Message: "ready",
+		Data:    map[string]string{"redis": "ok", "consumer": "ok"},
+	}, body)
+
+	consumerErr = errors.New("consumer group flight_group:lion does not exist")
+	status, body = probe(t, Readiness(checks))
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, probeResponse{
+		Message: "not ready",
+		Data:    map[string]string{"redis": "ok", "consumer": "consumer group flight_group:lion does not exist"},
+	}, body)
+}
+
+func TestReadiness_RedisDown(t *testing.T) {
+	// An address nothing listens on any more.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	rdb := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	status, body := probe(t, Readiness(map[string]Check{
+		"redis": func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		},
+		"consumer": func(context.Context) error {
+			return nil
+		},
+	}))
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.False(t, body.Success)
+	assert.Equal(t, "not ready", body.Message)
+	assert.Equal(t, "ok", body.Data["consumer"])
+	assert.Contains(t, body.Data["redis"], "connection refused")
+}
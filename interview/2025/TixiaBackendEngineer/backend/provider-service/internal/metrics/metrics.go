@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Registry holds the metrics of provider-service, with the Go runtime and
+// process metrics the default registry would export. It is kept apart from
+// the default registry because main-service exports some of the same
+// metric names there, and both services run in one process in the
+// end-to-end tests.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Outcomes of a stream message.
+const (
+	OutcomeRead    = "read"
+	OutcomeClaimed = "claimed"
+	OutcomeAcked   = "acked"
+	OutcomeFailed  = "failed"
+)
+
+// Statuses of the processing of a search besides the status of the result
+// sent: StatusFailed when none was sent, StatusCancelled when the search was
+// cancelled while it ran and StatusSkipped when before it started.
+const (
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusSkipped   = "skipped"
+)
+
+var (
+	ProcessingDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "flight_provider_processing_duration_seconds",
+		Help:    "Time taken to answer a search request, by provider and result status.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"provider_id", "status"})
+
+	StreamMessages = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "flight_stream_messages_total",
+		Help: "Messages handled per stream, by outcome: read, claimed, acked or failed.",
+	}, []string{"stream", "outcome"})
+)
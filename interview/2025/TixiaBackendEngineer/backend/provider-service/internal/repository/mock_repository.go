@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -11,7 +12,7 @@ import (
 
 //go:generate mockery --name=IFlightRepository
 type IFlightRepository interface {
-	GetAllFlights() ([]domain.Flight, error)
+	GetAllFlights(ctx context.Context) ([]domain.Flight, error)
 }
 
 type flightRepository struct {
@@ -26,7 +27,10 @@ func NewFlightRepository(filePath string, logger *zap.Logger) IFlightRepository
 	}
 }
 
-func (r *flightRepository) GetAllFlights() ([]domain.Flight, error) {
+func (r *flightRepository) GetAllFlights(ctx context.Context) ([]domain.Flight, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	r.log.Debug("Opening JSON file", zap.String("path", r.filePath))
 
 	data, err := os.ReadFile(r.filePath)
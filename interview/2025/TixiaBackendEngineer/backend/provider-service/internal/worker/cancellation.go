@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"example.com/bus"
+	"example.com/contract"
+	"example.com/provider-service/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// cancellationRetention is how long a cancelled search ID is remembered, so
+// requests still queued behind it are skipped.
+const cancellationRetention = 10 * time.Minute
+
+// cancellations keeps the recently cancelled search IDs and the contexts of
+// the searches being processed.
+type cancellations struct {
+	mu         sync.Mutex
+	cancelled  map[string]time.Time
+	inProgress map[string]context.CancelFunc
+}
+
+func newCancellations() *cancellations {
+	return &cancellations{
+		cancelled:  make(map[string]time.Time),
+		inProgress: make(map[string]context.CancelFunc),
+	}
+}
+
+func (cs *cancellations) isCancelled(searchID string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	_, ok := cs.cancelled[searchID]
+	return ok
+}
+
+// cancel records searchID as cancelled and aborts it if it is in progress.
+func (cs *cancellations) cancel(searchID string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.cancelled[searchID] = time.Now()
+	if abort, ok := cs.inProgress[searchID]; ok {
+		abort()
+	}
+}
+
+// track returns a context that is cancelled along with searchID. done must
+// be called once the search has been processed.
+func (cs *cancellations) track(ctx context.Context, searchID string) (context.Context, func()) {
+	ctx, abort := context.WithCancel(ctx)
+
+	cs.mu.Lock()
+	cs.inProgress[searchID] = abort
+	cs.mu.Unlock()
+
+	return ctx, func() {
+		cs.mu.Lock()
+		delete(cs.inProgress, searchID)
+		cs.mu.Unlock()
+		abort()
+	}
+}
+
+func (cs *cancellations) prune() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cutoff := time.Now().Add(-cancellationRetention)
+	for id, at := range cs.cancelled {
+		if at.Before(cutoff) {
+			delete(cs.cancelled, id)
+		}
+	}
+}
+
+// CancelSearch drops searchID: it is aborted if in progress and skipped if
+// still queued.
+func (c *FlightSearchConsumer) CancelSearch(searchID string) {
+	c.log.Info("Search cancelled", zap.String("search_id", searchID))
+	c.cancels.cancel(searchID)
+}
+
+// watchCancellations tails the cancellation stream until ctx is cancelled.
+// Every instance reads all cancellations, so it uses a plain read rather
+// than a consumer group.
+func (c *FlightSearchConsumer) watchCancellations(ctx context.Context) {
+	lastID := fmt.Sprintf("%d-0", time.Now().Add(-cancellationRetention).UnixMilli())
+	lastPrune := time.Now()
+
+	for ctx.Err() == nil {
+		messages, err := c.bus.Read(ctx, bus.ReadArgs{
+			Streams: map[string]string{c.streams.Cancelled: lastID},
+			Count:   100,
+			Block:   5 * time.Second,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.log.Error("Error reading cancellation stream", zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, msg := range messages {
+			lastID = msg.ID
+			metrics.StreamMessages.WithLabelValues(c.streams.Cancelled, metrics.OutcomeRead).Inc()
+			m, meta, err := contract.DecodeSearchCancelled(msg.Values)
+			if err != nil {
+				c.log.Warn("Invalid search cancellation",
+					zap.String("id", msg.ID),
+					zap.Int("schema_version", meta.SchemaVersion),
+					zap.Error(err),
+				)
+				metrics.StreamMessages.WithLabelValues(c.streams.Cancelled, metrics.OutcomeFailed).Inc()
+				continue
+			}
+			c.CancelSearch(m.SearchID)
+		}
+
+		if time.Since(lastPrune) > time.Minute {
+			c.cancels.prune()
+			lastPrune = time.Now()
+		}
+	}
+}
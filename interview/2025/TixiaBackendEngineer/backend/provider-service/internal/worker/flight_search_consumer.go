@@ -2,153 +2,481 @@ package worker
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"example.com/bus"
+	"example.com/contract"
 	"example.com/provider-service/internal/domain"
+	"example.com/provider-service/internal/metrics"
 	"example.com/provider-service/internal/repository"
-	"github.com/redis/go-redis/v9"
+	"example.com/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+var tracer = otel.Tracer("example.com/provider-service/internal/worker")
+
 const (
 	StreamFlightGroup = "flight_group"
 	StreamFlightApp   = "flight_app"
+
+	// readErrorBackoff is the pause after a failed read, so an unreachable
+	// Redis is not hammered.
+	readErrorBackoff = time.Second
+	// claimBatch is the number of stale requests claimed at once.
+	claimBatch = 10
 )
 
+// ConsumerConfig sets who a FlightSearchConsumer answers as and which
+// streams it uses.
+type ConsumerConfig struct {
+	// ProviderID tags the results; main-service must expect it.
+	ProviderID string
+	// Group is the consumer group, StreamFlightGroup:ProviderID by default.
+	// Each provider reads through its own group so that every provider sees
+	// every request, while instances of the same provider share the work.
+	Group string
+	// Consumer is the name of this instance in the group, the host name and
+	// process ID by default. Instances sharing a group must use distinct
+	// names, or they take over each other's pending requests.
+	Consumer string
+	// Streams default to domain.DefaultStreams.
+	Streams domain.Streams
+	// Retention trims the results stream to the entries of the last
+	// retention on every XADD; zero keeps them all.
+	Retention time.Duration
+	// SchemaVersion of the published results, contract.CurrentSchema by
+	// default. Requests of every supported version are read.
+	SchemaVersion int
+	// ClaimAfter is how long a request may stay pending with another
+	// instance of the group before this one takes it over, so requests read
+	// by an instance that went away are still answered; zero never claims.
+	ClaimAfter time.Duration
+	// LegacyGroup is a group whose pending requests this instance also
+	// claims after ClaimAfter, answers and acknowledges: StreamFlightGroup,
+	// which the single provider read through before every provider had a
+	// group of its own. Empty leaves other groups alone.
+	LegacyGroup string
+}
+
 type FlightSearchConsumer struct {
-	repo repository.IFlightRepository
-	rdb  *redis.Client
-	log  *zap.Logger
+	repo       repository.IFlightRepository
+	bus        bus.IBus
+	providerID string
+	group      string
+	consumer   string
+	streams    domain.Streams
+	retention  time.Duration
+	claimAfter time.Duration
+	legacy     string
+	encoder    contract.Encoder
+	cancels    *cancellations
+	log        *zap.Logger
+
+	// lastProgress is when the read loop last completed a read, in Unix
+	// nanoseconds; zero until it starts.
+	lastProgress atomic.Int64
 }
 
-func NewFlightSearchConsumer(repo repository.IFlightRepository, rdb *redis.Client, logger *zap.Logger) *FlightSearchConsumer {
+// defaultConsumerName names the instance after its host and process, which
+// is unique among the instances sharing a group.
+func defaultConsumerName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = StreamFlightApp
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// NewFlightSearchConsumer creates a consumer answering searches as
+// cfg.ProviderID.
+func NewFlightSearchConsumer(repo repository.IFlightRepository, b bus.IBus, cfg ConsumerConfig, logger *zap.Logger) *FlightSearchConsumer {
+	if cfg.Group == "" {
+		cfg.Group = StreamFlightGroup + ":" + cfg.ProviderID
+	}
+	if cfg.Consumer == "" {
+		cfg.Consumer = defaultConsumerName()
+	}
+	if cfg.Streams == (domain.Streams{}) {
+		cfg.Streams = domain.DefaultStreams
+	}
 	return &FlightSearchConsumer{
-		repo: repo,
-		rdb:  rdb,
-		log:  logger,
+		repo:       repo,
+		bus:        b,
+		providerID: cfg.ProviderID,
+		group:      cfg.Group,
+		consumer:   cfg.Consumer,
+		streams:    cfg.Streams,
+		retention:  cfg.Retention,
+		claimAfter: cfg.ClaimAfter,
+		legacy:     cfg.LegacyGroup,
+		encoder: contract.Encoder{
+			Version:  cfg.SchemaVersion,
+			Producer: "provider-service/" + cfg.ProviderID,
+		},
+		cancels: newCancellations(),
+		log:     logger.With(zap.String("provider_id", cfg.ProviderID)),
 	}
 }
 
 func (c *FlightSearchConsumer) Start(ctx context.Context) error {
 	c.log.Info("Starting FlightSearchConsumer...")
 
-	if err := c.rdb.XGroupCreateMkStream(ctx, domain.StreamFlightSearchRequested, StreamFlightGroup, "$").Err(); err != nil {
-		if !strings.Contains(err.Error(), "BUSYGROUP") {
-			c.log.Error("Failed to create consumer group", zap.Error(err))
-			return fmt.Errorf("failed to create consumer group: %w", err)
-		}
+	if err := c.createGroup(ctx); err != nil {
+		return err
 	}
+	c.markProgress()
+
+	go c.watchCancellations(ctx)
 
+	var lastClaim time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			c.log.Info("FlightSearchConsumer received shutdown signal, exiting loop...")
 			return nil
 		default:
-			messages, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
-				Group:    StreamFlightGroup,
-				Consumer: StreamFlightApp,
-				Streams:  []string{domain.StreamFlightSearchRequested, ">"},
+			if c.claimAfter > 0 && time.Since(lastClaim) >= c.claimAfter/2 {
+				c.claimStale(ctx, c.group)
+				if c.legacy != "" {
+					c.claimStale(ctx, c.legacy)
+				}
+				lastClaim = time.Now()
+			}
+
+			messages, err := c.bus.ReadGroup(ctx, bus.ReadGroupArgs{
+				Stream:   c.streams.Requested,
+				Group:    c.group,
+				Consumer: c.consumer,
 				Count:    1,
 				Block:    5 * time.Second,
-			}).Result()
-
-			if err != nil && err != redis.Nil {
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
 				c.log.Error("Error reading from stream", zap.Error(err))
+				// Deleting the stream drops its groups too; recreate ours
+				// rather than failing every read from now on.
+				if errors.Is(err, bus.ErrNoGroup) {
+					_ = c.createGroup(ctx)
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(readErrorBackoff):
+				}
 				continue
 			}
+			c.markProgress()
 
-			if len(messages) == 0 || len(messages[0].Messages) == 0 {
-				continue
+			for _, m := range messages {
+				metrics.StreamMessages.WithLabelValues(c.streams.Requested, metrics.OutcomeRead).Inc()
+				c.handle(ctx, c.group, m)
 			}
+		}
+	}
+}
 
-			for _, m := range messages[0].Messages {
-				c.log.Info("Processing message", zap.String("id", m.ID))
-				c.ProcessMessage(ctx, m.ID, m.Values)
-
-				if err := c.rdb.XAck(ctx, domain.StreamFlightSearchRequested, StreamFlightGroup, m.ID).Err(); err != nil {
-					c.log.Error("Failed to ack message", zap.String("id", m.ID), zap.Error(err))
-				} else {
-					c.log.Info("Message acknowledged", zap.String("id", m.ID))
-				}
-			}
+// claimStale takes over the requests pending in group with other instances
+// for longer than claimAfter and answers them.
+func (c *FlightSearchConsumer) claimStale(ctx context.Context, group string) {
+	messages, err := c.bus.Claim(ctx, bus.ClaimArgs{
+		Stream:   c.streams.Requested,
+		Group:    group,
+		Consumer: c.consumer,
+		MinIdle:  c.claimAfter,
+		Count:    claimBatch,
+	})
+	if err != nil {
+		if group == c.legacy && errors.Is(err, bus.ErrNoGroup) {
+			// Migrated already, or never there.
+			c.legacy = ""
+			return
+		}
+		if ctx.Err() == nil {
+			c.log.Error("Failed to claim stale requests", zap.String("group", group), zap.Error(err))
 		}
+		return
+	}
+	for _, m := range messages {
+		c.log.Warn("Claimed stale request", zap.String("id", m.ID), zap.String("group", group))
+		metrics.StreamMessages.WithLabelValues(c.streams.Requested, metrics.OutcomeClaimed).Inc()
+		c.handle(ctx, group, m)
 	}
 }
 
-func (c *FlightSearchConsumer) Stop(ctx context.Context) {
-	c.log.Info("Closing Redis connection for FlightSearchConsumer...")
-	if err := c.rdb.Close(); err != nil {
-		c.log.Error("Error closing Redis connection", zap.Error(err))
+// handle processes a request delivered to this instance and acknowledges
+// it in group.
+func (c *FlightSearchConsumer) handle(ctx context.Context, group string, m bus.Message) {
+	c.log.Info("Processing message", zap.String("id", m.ID))
+	c.ProcessMessage(ctx, m.ID, m.Values)
+
+	if err := c.bus.Ack(ctx, c.streams.Requested, group, m.ID); err != nil {
+		c.log.Error("Failed to ack message", zap.String("id", m.ID), zap.Error(err))
+		metrics.StreamMessages.WithLabelValues(c.streams.Requested, metrics.OutcomeFailed).Inc()
 	} else {
-		c.log.Info("Redis connection closed")
+		c.log.Info("Message acknowledged", zap.String("id", m.ID))
+		metrics.StreamMessages.WithLabelValues(c.streams.Requested, metrics.OutcomeAcked).Inc()
 	}
+	c.markProgress()
 }
 
+func (c *FlightSearchConsumer) createGroup(ctx context.Context) error {
+	if err := c.bus.CreateGroup(ctx, c.streams.Requested, c.group); err != nil {
+		c.log.Error("Failed to create consumer group", zap.Error(err))
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	return nil
+}
+
+func (c *FlightSearchConsumer) markProgress() {
+	c.lastProgress.Store(time.Now().UnixNano())
+}
+
+// Ready reports why the consumer cannot answer searches: its consumer group
+// is missing, or the read loop has not completed a read within staleAfter.
+// Reads block for at most 5 seconds, so a loop that stays silent longer is
+// stuck.
+func (c *FlightSearchConsumer) Ready(ctx context.Context, staleAfter time.Duration) error {
+	groups, err := c.bus.Groups(ctx, c.streams.Requested)
+	if err != nil {
+		return fmt.Errorf("failed to list consumer groups: %w", err)
+	}
+	if !slices.ContainsFunc(groups, func(g bus.GroupInfo) bool { return g.Name == c.group }) {
+		return fmt.Errorf("consumer group %s does not exist", c.group)
+	}
+
+	last := c.lastProgress.Load()
+	if last == 0 {
+		return errors.New("consumer loop has not started")
+	}
+	if idle := time.Since(time.Unix(0, last)); idle > staleAfter {
+		return fmt.Errorf("consumer loop made no progress for %s", idle.Round(time.Second))
+	}
+	return nil
+}
+
+// ProcessMessage answers one search request. It continues the trace the
+// request was published under, so the search can be followed from
+// main-service through the provider.
 func (c *FlightSearchConsumer) ProcessMessage(ctx context.Context, msgID string, values map[string]interface{}) {
-	var req domain.FlightSearchRequest
-	data, err := json.Marshal(values)
+	start := time.Now()
+	status := metrics.StatusFailed
+	defer func() {
+		metrics.ProcessingDuration.WithLabelValues(c.providerID, status).Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, span := tracer.Start(telemetry.ExtractStream(ctx, values), c.streams.Requested+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			telemetry.MessagingSystem,
+			semconv.MessagingDestinationName(c.streams.Requested),
+			semconv.MessagingMessageID(msgID),
+			attribute.String("provider_id", c.providerID),
+		),
+	)
+	defer span.End()
+
+	req, meta, err := contract.DecodeSearchRequested(values)
+	span.SetAttributes(
+		attribute.String("search_id", req.SearchID),
+		attribute.Int("schema_version", meta.SchemaVersion),
+	)
 	if err != nil {
-		c.log.Error("Failed to marshal message values", zap.Error(err))
+		c.log.Error("Invalid flight search request",
+			zap.String("id", msgID),
+			zap.Int("schema_version", meta.SchemaVersion),
+			zap.String("producer", meta.Producer),
+			zap.Error(err),
+		)
+		metrics.StreamMessages.WithLabelValues(c.streams.Requested, metrics.OutcomeFailed).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if req.SearchID != "" {
+			c.publishResult(ctx, c.failedResult(req.SearchID))
+		}
 		return
 	}
 
-	if err := json.Unmarshal(data, &req); err != nil {
-		c.log.Error("Failed to unmarshal message to FlightSearchRequest", zap.Error(err))
+	if c.cancels.isCancelled(req.SearchID) {
+		c.log.Info("Skipping cancelled search", zap.String("search_id", req.SearchID))
+		status = metrics.StatusSkipped
 		return
 	}
 
 	c.log.Info("Searching flights",
 		zap.String("search_id", req.SearchID),
-		zap.String("from", req.From),
-		zap.String("to", req.To),
-		zap.String("date", req.Date),
+		zap.String("trip_type", req.TripType),
+		zap.String("from", req.Legs[0].From),
+		zap.String("to", req.Legs[0].To),
+		zap.String("date", req.Legs[0].Date),
+		zap.Int("passengers", req.Passengers),
+		zap.String("cabin_class", req.CabinClass),
 	)
 
-	flights, err := c.repo.GetAllFlights()
+	searchCtx, done := c.cancels.track(ctx, req.SearchID)
+	defer done()
+
+	flights, err := c.repo.GetAllFlights(searchCtx)
+	if c.aborted(req.SearchID) {
+		span.SetAttributes(attribute.Bool("cancelled", true))
+		status = metrics.StatusCancelled
+		return
+	}
 	if err != nil {
 		c.log.Error("Failed to get flights", zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		c.publishResult(ctx, c.failedResult(req.SearchID))
 		return
 	}
 
-	var results []domain.Flight
-	for _, f := range flights {
-		if strings.EqualFold(f.From, req.From) &&
-			strings.EqualFold(f.To, req.To) &&
-			strings.HasPrefix(f.DepartureTime, req.Date) {
-			results = append(results, f)
+	var (
+		results    []domain.Flight
+		legResults []domain.LegResult
+		perLeg     [][]domain.Flight
+	)
+	for i, leg := range req.Legs {
+		if c.aborted(req.SearchID) {
+			status = metrics.StatusCancelled
+			return
+		}
+		matched := matchFlights(flights, leg, req)
+		results = append(results, matched...)
+		perLeg = append(perLeg, matched)
+		if matched == nil {
+			matched = []domain.Flight{}
 		}
+		legResults = append(legResults, domain.LegResult{
+			Leg:     i,
+			From:    leg.From,
+			To:      leg.To,
+			Date:    leg.Date,
+			Flights: matched,
+		})
 	}
 
-	c.log.Info("Flights found", zap.Int("count", len(results)), zap.String("search_id", req.SearchID))
+	c.log.Info("Flights found",
+		zap.Int("count", len(results)),
+		zap.Int("legs", len(req.Legs)),
+		zap.String("search_id", req.SearchID),
+	)
+
+	result := domain.FlightSearchResult{
+		SearchID:   req.SearchID,
+		ProviderID: c.providerID,
+		Status:     domain.SearchStatusCompleted,
+		TripType:   req.TripType,
+		Results:    results,
+		Legs:       legResults,
+	}
 
-	var resultMsg map[string]interface{}
-	if len(results) == 0 {
-		resultMsg = map[string]interface{}{
-			"search_id": req.SearchID,
-			"status":    "not_found",
-			"results":   []interface{}{},
+	found := len(results) > 0
+	if len(req.Legs) > 1 {
+		result.Itineraries = contract.BuildItineraries(perLeg)
+		found = len(result.Itineraries) > 0
+	}
+
+	if !found {
+		result.Status = domain.SearchStatusNotFound
+		result.Results = []domain.Flight{}
+	}
+	if c.aborted(req.SearchID) {
+		status = metrics.StatusCancelled
+		return
+	}
+	status = result.Status
+	c.publishResult(ctx, result)
+}
+
+// aborted reports whether searchID was cancelled while being processed, in
+// which case no result is published.
+func (c *FlightSearchConsumer) aborted(searchID string) bool {
+	if !c.cancels.isCancelled(searchID) {
+		return false
+	}
+	c.log.Info("Aborting cancelled search", zap.String("search_id", searchID))
+	return true
+}
+
+// matchFlights returns the flights of leg with enough seats in the requested
+// cabin, priced for all passengers. A flight from or to any airport of a
+// city code matches.
+func matchFlights(flights []domain.Flight, leg domain.SearchLeg, req domain.FlightSearchRequest) []domain.Flight {
+	origins, destinations := leg.Origins(), leg.Destinations()
+	var matched []domain.Flight
+	for _, f := range flights {
+		if containsFold(origins, f.From) &&
+			containsFold(destinations, f.To) &&
+			strings.HasPrefix(f.DepartureTime, leg.Date) &&
+			f.Available &&
+			f.Seats.Available(req.CabinClass) >= req.Passengers {
+			f.CabinClass = req.CabinClass
+			f.Passengers = req.Passengers
+			f.PricePerPassenger = f.Price
+			f.Price = f.Price * float64(req.Passengers)
+			matched = append(matched, f)
 		}
-	} else {
-		resultMsg = map[string]interface{}{
-			"search_id": req.SearchID,
-			"status":    "completed",
-			"results":   results,
+	}
+	return matched
+}
+
+// containsFold reports whether codes holds code, ignoring case.
+func containsFold(codes []string, code string) bool {
+	for _, c := range codes {
+		if strings.EqualFold(c, code) {
+			return true
 		}
 	}
+	return false
+}
 
-	resultData, _ := json.Marshal(resultMsg)
-	if err := c.rdb.XAdd(ctx, &redis.XAddArgs{
-		Stream: domain.StreamFlightSearchResults,
-		Values: map[string]interface{}{
-			"data": string(resultData),
-		},
-	}).Err(); err != nil {
-		c.log.Error("Failed to publish results", zap.String("search_id", req.SearchID), zap.Error(err))
+func (c *FlightSearchConsumer) failedResult(searchID string) domain.FlightSearchResult {
+	return domain.FlightSearchResult{
+		SearchID:   searchID,
+		ProviderID: c.providerID,
+		Status:     domain.SearchStatusFailed,
+		Results:    []domain.Flight{},
+	}
+}
+
+func (c *FlightSearchConsumer) publishResult(ctx context.Context, result domain.FlightSearchResult) {
+	searchID, status := result.SearchID, result.Status
+	ctx, span := tracer.Start(ctx, c.streams.Results+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			telemetry.MessagingSystem,
+			semconv.MessagingDestinationName(c.streams.Results),
+			attribute.String("search_id", searchID),
+			attribute.String("status", status),
+		),
+	)
+	defer span.End()
+
+	values, err := c.encoder.SearchResult(result)
+	if err != nil {
+		c.log.Error("Failed to encode results", zap.String("search_id", searchID), zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	telemetry.InjectStream(ctx, values)
+
+	if _, err := c.bus.Publish(ctx, c.streams.Results, values, c.retention); err != nil {
+		c.log.Error("Failed to publish results", zap.String("search_id", searchID), zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	} else {
-		c.log.Info("Published flight search results", zap.String("search_id", req.SearchID))
+		c.log.Info("Published flight search results", zap.String("search_id", searchID))
 	}
 }
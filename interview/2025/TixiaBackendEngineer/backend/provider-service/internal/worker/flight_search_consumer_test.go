@@ -3,66 +3,375 @@ package worker_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"slices"
 	"testing"
+	"time"
 
+	"example.com/bus"
+	"example.com/contract"
 	"example.com/provider-service/internal/domain"
 	"example.com/provider-service/internal/worker"
-	"github.com/go-redis/redismock/v9"
-	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
+// published returns the messages on the results stream.
+func published(t *testing.T, b bus.ISubscriber) []bus.Message {
+	t.Helper()
+	messages, err := b.Read(context.Background(), bus.ReadArgs{
+		Streams: map[string]string{domain.StreamFlightSearchResults: "0-0"},
+	})
+	require.NoError(t, err)
+	return messages
+}
+
 type MockFlightRepo struct {
 	mock.Mock
 }
 
-func (m *MockFlightRepo) GetAllFlights() ([]domain.Flight, error) {
-	args := m.Called()
+func (m *MockFlightRepo) GetAllFlights(ctx context.Context) ([]domain.Flight, error) {
+	args := m.Called(ctx)
 	return args.Get(0).([]domain.Flight), args.Error(1)
 }
 
 func TestProcessMessage_FindsFlights(t *testing.T) {
 	logger := zap.NewNop()
-	db, mockRedis := redismock.NewClientMock()
+	b := bus.NewMemory()
 
 	mockRepo := new(MockFlightRepo)
 	mockFlights := []domain.Flight{
-		{ID: "1", From: "JKT", To: "DPS", DepartureTime: "2025-08-15T08:00", Available: true},
-		{ID: "2", From: "SUB", To: "DPS", DepartureTime: "2025-08-15T10:00", Available: true},
+		{ID: "1", From: "JKT", To: "DPS", DepartureTime: "2025-08-15T08:00", Price: 500000, Available: true, Seats: domain.SeatInventory{Economy: 10}},
+		{ID: "2", From: "SUB", To: "DPS", DepartureTime: "2025-08-15T10:00", Price: 400000, Available: true, Seats: domain.SeatInventory{Economy: 10}},
+		{ID: "3", From: "JKT", To: "DPS", DepartureTime: "2025-08-15T12:00", Price: 450000, Available: true, Seats: domain.SeatInventory{Economy: 1, Business: 8}},
 	}
-	mockRepo.On("GetAllFlights").Return(mockFlights, nil)
+	mockRepo.On("GetAllFlights", mock.Anything).Return(mockFlights, nil)
 
-	consumer := worker.NewFlightSearchConsumer(mockRepo, db, logger)
+	consumer := worker.NewFlightSearchConsumer(mockRepo, b, worker.ConsumerConfig{ProviderID: "garuda"}, logger)
 
-	req := domain.FlightSearchRequest{
-		SearchID: "abc123",
-		From:     "JKT",
-		To:       "DPS",
-		Date:     "2025-08-15",
-	}
-	values := make(map[string]interface{})
-	b, _ := json.Marshal(req)
-	_ = json.Unmarshal(b, &values)
-
-	// Expect Redis XAdd to be called
-	resultMsg := map[string]interface{}{
-		"search_id": req.SearchID,
-		"status":    "completed",
-		"results":   []domain.Flight{mockFlights[0]},
-	}
-	resultData, _ := json.Marshal(resultMsg)
-	mockRedis.ExpectXAdd(&redis.XAddArgs{
-		Stream: "flight.search.results",
-		Values: map[string]interface{}{
-			"data": string(resultData),
+	values, err := contract.Encoder{Producer: "main-service"}.SearchRequested(domain.FlightSearchRequest{
+		SearchID:   "abc123",
+		TripType:   domain.TripOneWay,
+		Legs:       []domain.SearchLeg{{From: "JKT", To: "DPS", Date: "2025-08-15"}},
+		Passengers: 2,
+		CabinClass: domain.CabinEconomy,
+	})
+	require.NoError(t, err)
+
+	consumer.ProcessMessage(context.Background(), "1-0", values)
+	mockRepo.AssertExpectations(t)
+
+	// Flight 3 lacks economy seats for two passengers and the price covers
+	// both of them.
+	expected := mockFlights[0]
+	expected.CabinClass = domain.CabinEconomy
+	expected.Passengers = 2
+	expected.PricePerPassenger = 500000
+	expected.Price = 1000000
+
+	messages := published(t, b)
+	require.Len(t, messages, 1)
+	result, meta, err := contract.DecodeSearchResult(messages[0].Values)
+	require.NoError(t, err)
+	assert.Equal(t, contract.CurrentSchema, meta.SchemaVersion)
+	assert.Equal(t, "provider-service/garuda", meta.Producer)
+	assert.Equal(t, domain.FlightSearchResult{
+		SearchID:   "abc123",
+		ProviderID: "garuda",
+		Status:     domain.SearchStatusCompleted,
+		TripType:   domain.TripOneWay,
+		Results:    []domain.Flight{expected},
+		Legs: []domain.LegResult{
+			{Leg: 0, From: "JKT", To: "DPS", Date: "2025-08-15", Flights: []domain.Flight{expected}},
 		},
-	}).SetVal("123-0")
+	}, result)
+}
 
-	consumerTest := consumer
-	consumerTest.ProcessMessage(context.Background(), "1-0", values)
+func TestProcessMessage_RepoErrorPublishesFailed(t *testing.T) {
+	logger := zap.NewNop()
+	b := bus.NewMemory()
+
+	mockRepo := new(MockFlightRepo)
+	mockRepo.On("GetAllFlights", mock.Anything).Return([]domain.Flight(nil), errors.New("file not found"))
 
-	assert.NoError(t, mockRedis.ExpectationsWereMet())
+	// Version 1 throughout: a flat request in, the result JSON in data out.
+	consumer := worker.NewFlightSearchConsumer(mockRepo, b, worker.ConsumerConfig{
+		ProviderID:    "garuda",
+		SchemaVersion: contract.SchemaV1,
+	}, logger)
+
+	values := map[string]interface{}{
+		"search_id": "abc123",
+		"from":      "JKT",
+		"to":        "DPS",
+		"date":      "2025-08-15",
+	}
+
+	resultData, _ := json.Marshal(domain.FlightSearchResult{
+		SearchID:   "abc123",
+		ProviderID: "garuda",
+		Status:     domain.SearchStatusFailed,
+		Results:    []domain.Flight{},
+	})
+	consumer.ProcessMessage(context.Background(), "1-0", values)
 	mockRepo.AssertExpectations(t)
+
+	messages := published(t, b)
+	require.Len(t, messages, 1)
+	assert.Equal(t, map[string]interface{}{"data": string(resultData)}, messages[0].Values)
+}
+
+func TestProcessMessage_RoundTripBuildsItineraries(t *testing.T) {
+	logger := zap.NewNop()
+	b := bus.NewMemory()
+
+	seats := domain.SeatInventory{Economy: 10}
+	mockRepo := new(MockFlightRepo)
+	mockRepo.On("GetAllFlights", mock.Anything).Return([]domain.Flight{
+		{ID: "out-1", From: "CGK", To: "DPS", DepartureTime: "2025-08-15 08:00", ArrivalTime: "2025-08-15 11:00", Price: 700000, Currency: "IDR", Available: true, Seats: seats},
+		{ID: "out-2", From: "CGK", To: "DPS", DepartureTime: "2025-08-15 20:00", ArrivalTime: "2025-08-15 23:00", Price: 500000, Currency: "IDR", Available: true, Seats: seats},
+		{ID: "ret-1", From: "DPS", To: "CGK", DepartureTime: "2025-08-15 21:00", ArrivalTime: "2025-08-16 00:00", Price: 300000, Currency: "IDR", Available: true, Seats: seats},
+		{ID: "ret-2", From: "DPS", To: "CGK", DepartureTime: "2025-08-15 23:30", ArrivalTime: "2025-08-16 02:30", Price: 400000, Currency: "IDR", Available: true, Seats: seats},
+	}, nil)
+
+	consumer := worker.NewFlightSearchConsumer(mockRepo, b, worker.ConsumerConfig{ProviderID: "garuda"}, logger)
+
+	requestValues := map[string]interface{}{
+		"search_id":   "rt-1",
+		"trip_type":   "round_trip",
+		"from":        "CGK",
+		"to":          "DPS",
+		"date":        "2025-08-15",
+		"legs":        `[{"from":"CGK","to":"DPS","date":"2025-08-15"},{"from":"DPS","to":"CGK","date":"2025-08-15"}]`,
+		"passengers":  "1",
+		"cabin_class": "economy",
+	}
+
+	consumer.ProcessMessage(context.Background(), "1-0", requestValues)
+
+	messages := published(t, b)
+	require.Len(t, messages, 1)
+	result, _, err := contract.DecodeSearchResult(messages[0].Values)
+	require.NoError(t, err)
+	assert.Equal(t, "completed", result.Status)
+	assert.Len(t, result.Legs, 2)
+	// out-2 lands at 23:00 and so only connects with ret-2.
+	if assert.Len(t, result.Itineraries, 3) {
+		assert.Equal(t, []string{"out-2", "ret-2"}, result.Itineraries[0].FlightIDs)
+		assert.Equal(t, float64(900000), result.Itineraries[0].TotalPrice)
+		assert.Equal(t, []string{"out-1", "ret-1"}, result.Itineraries[1].FlightIDs)
+		assert.Equal(t, []string{"out-1", "ret-2"}, result.Itineraries[2].FlightIDs)
+	}
+}
+
+func TestProcessMessage_MatchesAirportsOfCity(t *testing.T) {
+	logger := zap.NewNop()
+	b := bus.NewMemory()
+
+	seats := domain.SeatInventory{Economy: 10}
+	mockRepo := new(MockFlightRepo)
+	mockRepo.On("GetAllFlights", mock.Anything).Return([]domain.Flight{
+		{ID: "cgk", From: "CGK", To: "DPS", DepartureTime: "2025-08-15T08:00", Price: 500000, Available: true, Seats: seats},
+		{ID: "hlp", From: "HLP", To: "DPS", DepartureTime: "2025-08-15T09:00", Price: 450000, Available: true, Seats: seats},
+		{ID: "sub", From: "SUB", To: "DPS", DepartureTime: "2025-08-15T10:00", Price: 400000, Available: true, Seats: seats},
+	}, nil)
+
+	consumer := worker.NewFlightSearchConsumer(mockRepo, b, worker.ConsumerConfig{ProviderID: "garuda"}, logger)
+
+	values, err := contract.Encoder{Producer: "main-service"}.SearchRequested(domain.FlightSearchRequest{
+		SearchID:   "city-1",
+		TripType:   domain.TripOneWay,
+		Legs:       []domain.SearchLeg{{From: "JKT", To: "DPS", Date: "2025-08-15", FromAirports: []string{"CGK", "HLP"}}},
+		Passengers: 1,
+		CabinClass: domain.CabinEconomy,
+	})
+	require.NoError(t, err)
+
+	consumer.ProcessMessage(context.Background(), "1-0", values)
+
+	messages := published(t, b)
+	require.Len(t, messages, 1)
+	result, _, err := contract.DecodeSearchResult(messages[0].Values)
+	require.NoError(t, err)
+	require.Len(t, result.Legs, 1)
+	assert.Equal(t, "JKT", result.Legs[0].From)
+	var ids []string
+	for _, f := range result.Legs[0].Flights {
+		ids = append(ids, f.ID)
+	}
+	assert.Equal(t, []string{"cgk", "hlp"}, ids)
+}
+
+func TestProcessMessage_SkipsCancelledSearch(t *testing.T) {
+	logger := zap.NewNop()
+	b := bus.NewMemory()
+
+	mockRepo := new(MockFlightRepo)
+	consumer := worker.NewFlightSearchConsumer(mockRepo, b, worker.ConsumerConfig{ProviderID: "garuda"}, logger)
+	consumer.CancelSearch("abc123")
+
+	values := map[string]interface{}{
+		"search_id": "abc123",
+		"from":      "JKT",
+		"to":        "DPS",
+		"date":      "2025-08-15",
+	}
+
+	// Nothing is published for a cancelled search.
+	consumer.ProcessMessage(context.Background(), "1-0", values)
+
+	assert.Empty(t, published(t, b))
+	mockRepo.AssertNotCalled(t, "GetAllFlights", mock.Anything)
+}
+
+func TestReady(t *testing.T) {
+	ctx := context.Background()
+	b := bus.NewMemory()
+	consumer := worker.NewFlightSearchConsumer(new(MockFlightRepo), b, worker.ConsumerConfig{ProviderID: "garuda"}, zap.NewNop())
+
+	require.NoError(t, b.CreateGroup(ctx, domain.StreamFlightSearchRequested, worker.StreamFlightGroup+":lion"))
+	err := consumer.Ready(ctx, time.Minute)
+	assert.ErrorContains(t, err, "consumer group flight_group:garuda does not exist")
+
+	// The group exists but the read loop never ran.
+	require.NoError(t, b.CreateGroup(ctx, domain.StreamFlightSearchRequested, worker.StreamFlightGroup+":garuda"))
+	err = consumer.Ready(ctx, time.Minute)
+	assert.ErrorContains(t, err, "consumer loop has not started")
+}
+
+// start runs consumer until the test ends and waits for it to read.
+func start(t *testing.T, consumer *worker.FlightSearchConsumer) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, consumer.Start(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	require.Eventually(t, func() bool {
+		return consumer.Ready(ctx, time.Minute) == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+// awaitResult waits for the next result published after afterID.
+func awaitResult(t *testing.T, b bus.ISubscriber, afterID string) bus.Message {
+	t.Helper()
+	messages, err := b.Read(context.Background(), bus.ReadArgs{
+		Streams: map[string]string{domain.StreamFlightSearchResults: afterID},
+		Count:   1,
+		Block:   2 * time.Second,
+	})
+	require.NoError(t, err)
+	require.Len(t, messages, 1, "no result published")
+	return messages[0]
+}
+
+func TestStart_AnswersAndAcksRequests(t *testing.T) {
+	ctx := context.Background()
+	b := bus.NewMemory()
+	mockRepo := new(MockFlightRepo)
+	mockRepo.On("GetAllFlights", mock.Anything).Return([]domain.Flight{
+		{ID: "1", From: "CGK", To: "DPS", DepartureTime: "2025-08-15T08:00", Price: 500000, Available: true, Seats: domain.SeatInventory{Economy: 10}},
+	}, nil)
+	consumer := worker.NewFlightSearchConsumer(mockRepo, b, worker.ConsumerConfig{ProviderID: "garuda"}, zap.NewNop())
+	start(t, consumer)
+
+	values, err := contract.Encoder{Producer: "main-service"}.SearchRequested(domain.FlightSearchRequest{
+		SearchID:   "s1",
+		TripType:   domain.TripOneWay,
+		Legs:       []domain.SearchLeg{{From: "CGK", To: "DPS", Date: "2025-08-15"}},
+		Passengers: 1,
+		CabinClass: domain.CabinEconomy,
+	})
+	require.NoError(t, err)
+	_, err = b.Publish(ctx, domain.StreamFlightSearchRequested, values, 0)
+	require.NoError(t, err)
+
+	result, _, err := contract.DecodeSearchResult(awaitResult(t, b, "0-0").Values)
+	require.NoError(t, err)
+	assert.Equal(t, "s1", result.SearchID)
+	assert.Equal(t, domain.SearchStatusCompleted, result.Status)
+	assert.Len(t, result.Results, 1)
+
+	assert.Eventually(t, func() bool {
+		groups, err := b.Groups(ctx, domain.StreamFlightSearchRequested)
+		return err == nil && len(groups) == 1 && groups[0].Pending == 0
+	}, time.Second, 10*time.Millisecond, "request not acknowledged")
+}
+
+func TestStart_ClaimsStaleRequests(t *testing.T) {
+	ctx := context.Background()
+	b := bus.NewMemory()
+	group := worker.StreamFlightGroup + ":garuda"
+	require.NoError(t, b.CreateGroup(ctx, domain.StreamFlightSearchRequested, group))
+
+	// Another instance read the request and went away without answering.
+	_, err := b.Publish(ctx, domain.StreamFlightSearchRequested, map[string]interface{}{
+		"search_id": "s1",
+		"from":      "CGK",
+		"to":        "DPS",
+		"date":      "2025-08-15",
+	}, 0)
+	require.NoError(t, err)
+	read, err := b.ReadGroup(ctx, bus.ReadGroupArgs{Stream: domain.StreamFlightSearchRequested, Group: group, Consumer: "gone"})
+	require.NoError(t, err)
+	require.Len(t, read, 1)
+	time.Sleep(60 * time.Millisecond)
+
+	mockRepo := new(MockFlightRepo)
+	mockRepo.On("GetAllFlights", mock.Anything).Return([]domain.Flight{}, nil)
+	consumer := worker.NewFlightSearchConsumer(mockRepo, b, worker.ConsumerConfig{
+		ProviderID: "garuda",
+		ClaimAfter: 50 * time.Millisecond,
+	}, zap.NewNop())
+	start(t, consumer)
+
+	result, _, err := contract.DecodeSearchResult(awaitResult(t, b, "0-0").Values)
+	require.NoError(t, err)
+	assert.Equal(t, "s1", result.SearchID)
+	assert.Equal(t, domain.SearchStatusNotFound, result.Status)
+}
+
+func TestStart_AnswersLegacyGroupRequests(t *testing.T) {
+	ctx := context.Background()
+	b := bus.NewMemory()
+	require.NoError(t, b.CreateGroup(ctx, domain.StreamFlightSearchRequested, worker.StreamFlightGroup))
+
+	// An instance of a release before per-provider groups read the request
+	// and was replaced before answering.
+	_, err := b.Publish(ctx, domain.StreamFlightSearchRequested, map[string]interface{}{
+		"search_id": "s1",
+		"from":      "CGK",
+		"to":        "DPS",
+		"date":      "2025-08-15",
+	}, 0)
+	require.NoError(t, err)
+	_, err = b.ReadGroup(ctx, bus.ReadGroupArgs{Stream: domain.StreamFlightSearchRequested, Group: worker.StreamFlightGroup, Consumer: "old"})
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	mockRepo := new(MockFlightRepo)
+	mockRepo.On("GetAllFlights", mock.Anything).Return([]domain.Flight{}, nil)
+	consumer := worker.NewFlightSearchConsumer(mockRepo, b, worker.ConsumerConfig{
+		ProviderID:  "default",
+		ClaimAfter:  10 * time.Millisecond,
+		LegacyGroup: worker.StreamFlightGroup,
+	}, zap.NewNop())
+	start(t, consumer)
+
+	result, _, err := contract.DecodeSearchResult(awaitResult(t, b, "0-0").Values)
+	require.NoError(t, err)
+	assert.Equal(t, "s1", result.SearchID)
+	assert.Eventually(t, func() bool {
+		groups, err := b.Groups(ctx, domain.StreamFlightSearchRequested)
+		return err == nil && slices.ContainsFunc(groups, func(g bus.GroupInfo) bool {
+			return g.Name == worker.StreamFlightGroup && g.Pending == 0
+		})
+	}, time.Second, 10*time.Millisecond, "legacy request not acknowledged")
 }
@@ -0,0 +1,38 @@
+// Package service assembles provider-service from its config. cmd/main.go
+// runs it as the service and the end-to-end tests run it in-process.
+package service
+
+import (
+	"example.com/bus"
+	"example.com/provider-service/internal/config"
+	"example.com/provider-service/internal/repository"
+	"example.com/provider-service/internal/worker"
+	"go.uber.org/zap"
+)
+
+// Name identifies provider-service in logs and traces.
+const Name = "provider-service"
+
+// Config holds every setting of provider-service.
+type Config = config.Config
+
+// DefaultConfig returns the settings used for everything left unset.
+func DefaultConfig() Config {
+	return config.Default()
+}
+
+// New creates the consumer answering the searches published on b with the
+// flights of cfg.Provider.SampleFile.
+func New(cfg *Config, b bus.IBus, log *zap.Logger) *worker.FlightSearchConsumer {
+	repo := repository.NewFlightRepository(cfg.Provider.SampleFile, log)
+	return worker.NewFlightSearchConsumer(repo, b, worker.ConsumerConfig{
+		ProviderID:    cfg.Provider.ID,
+		Group:         cfg.Streams.Group,
+		Consumer:      cfg.Streams.Consumer,
+		Streams:       cfg.StreamNames(),
+		Retention:     cfg.Streams.Retention,
+		SchemaVersion: cfg.Streams.SchemaVersion,
+		ClaimAfter:    cfg.Streams.ClaimAfter,
+		LegacyGroup:   cfg.Streams.LegacyGroup,
+	}, log)
+}
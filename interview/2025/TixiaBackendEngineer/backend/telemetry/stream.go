@@ -0,0 +1,54 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MessagingSystem is the messaging.system attribute of stream spans.
+var MessagingSystem = attribute.String("messaging.system", "redis")
+
+// StreamCarrier carries trace context in the fields of a stream message, as
+// W3C traceparent and tracestate entries next to the payload.
+type StreamCarrier map[string]interface{}
+
+var _ propagation.TextMapCarrier = StreamCarrier(nil)
+
+func (c StreamCarrier) Get(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+func (c StreamCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c StreamCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// InjectStream adds the trace context of ctx to the fields of a message
+// about to be published.
+func InjectStream(ctx context.Context, values map[string]interface{}) {
+	otel.GetTextMapPropagator().Inject(ctx, StreamCarrier(values))
+}
+
+// ExtractStream returns ctx carrying the trace context found in the fields
+// of a consumed message.
+func ExtractStream(ctx context.Context, values map[string]interface{}) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, StreamCarrier(values))
+}
+
+// SpanContextFromStream returns the span context a message was published
+// under, to link spans that handle it without being part of its trace.
+func SpanContextFromStream(values map[string]interface{}) trace.SpanContext {
+	return trace.SpanContextFromContext(ExtractStream(context.Background(), values))
+}
@@ -0,0 +1,81 @@
+package e2e_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"example.com/contract"
+	"example.com/e2e"
+	mainservice "example.com/main-service/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAPI(t *testing.T) {
+	// lion never answers, so the search stays in flight until the provider
+	// deadline.
+	h := e2e.Start(t, e2e.Options{
+		Providers: map[string][]contract.Flight{"garuda": flights},
+		Expected:  []string{"garuda", "lion"},
+		Configure: func(cfg *mainservice.Config) {
+			cfg.Search.Deadline = 20 * time.Second
+			cfg.Search.ProviderDeadline = 10 * time.Second
+		},
+	})
+	h.AddAPIKey(t, "ops-key", "premium", true)
+	h.AddAPIKey(t, "client-key", "premium", false)
+
+	assert.Equal(t, http.StatusUnauthorized, h.Get(t, "/admin/searches", "", nil))
+	assert.Equal(t, http.StatusForbidden, h.Get(t, "/admin/searches", "client-key", nil))
+
+	searchID := h.Search(t, oneWay("CGK", "DPS", "2025-07-10", 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _, _ = h.Stream(ctx, searchID) }()
+
+	type subscriptions struct {
+		SearchID    string           `json:"search_id"`
+		Total       int64            `json:"total"`
+		ByTransport map[string]int64 `json:"by_transport"`
+	}
+	require.Eventually(t, func() bool {
+		var subs []subscriptions
+		require.Equal(t, http.StatusOK, h.Get(t, "/admin/subscriptions", "ops-key", &subs))
+		return len(subs) == 1 && subs[0].ByTransport["sse"] == 1
+	}, 5*time.Second, 20*time.Millisecond, "the stream was not listed")
+
+	var searches []struct {
+		SearchID  string `json:"search_id"`
+		Status    string `json:"status"`
+		AgeMs     int64  `json:"age_ms"`
+		Providers []struct {
+			ProviderID string `json:"provider_id"`
+			Status     string `json:"status"`
+		} `json:"providers"`
+		Watchers map[string]int64 `json:"watchers"`
+	}
+	require.Eventually(t, func() bool {
+		require.Equal(t, http.StatusOK, h.Get(t, "/admin/searches", "ops-key", &searches))
+		return len(searches) == 1 && len(searches[0].Providers) == 2 && searches[0].Providers[0].Status == contract.StatusCompleted
+	}, 5*time.Second, 20*time.Millisecond, "garuda's answer was not listed: %+v", searches)
+	assert.Equal(t, searchID, searches[0].SearchID)
+	assert.Equal(t, "processing", searches[0].Status)
+	assert.Positive(t, searches[0].AgeMs)
+	assert.Equal(t, "garuda", searches[0].Providers[0].ProviderID)
+	assert.Equal(t, "lion", searches[0].Providers[1].ProviderID)
+	assert.Equal(t, "pending", searches[0].Providers[1].Status)
+	assert.Equal(t, int64(1), searches[0].Watchers["sse"])
+
+	// The services exchange messages over the in-memory bus here, so the
+	// streams are not in Redis.
+	var streams []struct {
+		Stream string `json:"stream"`
+		Exists bool   `json:"exists"`
+	}
+	require.Equal(t, http.StatusOK, h.Get(t, "/admin/streams", "ops-key", &streams))
+	require.Len(t, streams, 3)
+	assert.Equal(t, contract.StreamSearchRequested, streams[0].Stream)
+	assert.False(t, streams[0].Exists)
+}
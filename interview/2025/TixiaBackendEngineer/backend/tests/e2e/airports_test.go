@@ -0,0 +1,43 @@
+package e2e_test
+
+import (
+	"net/http"
+	"testing"
+
+	"example.com/contract"
+	"example.com/e2e"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchCityCode(t *testing.T) {
+	halim := contract.Flight{ID: "id-1", Airline: "Batik Air", FlightNumber: "ID6500", From: "HLP", To: "DPS", DepartureTime: "2025-07-10 09:00", ArrivalTime: "2025-07-10 12:00", Price: 800000, Currency: "IDR", Available: true, Seats: contract.SeatInventory{Economy: 30}}
+	// The default config publishes a schema version that lists the airports
+	// of city codes.
+	h := e2e.Start(t, e2e.Options{
+		Providers: map[string][]contract.Flight{"garuda": append([]contract.Flight{halim}, flights...)},
+	})
+
+	var places []struct {
+		Type     string   `json:"type"`
+		Code     string   `json:"code"`
+		Airports []string `json:"airports"`
+	}
+	require.Equal(t, http.StatusOK, h.Get(t, "/api/v1/airports?q=jakarta&limit=3", "", &places))
+	require.Len(t, places, 3)
+	assert.Equal(t, "JKT", places[0].Code)
+	assert.Equal(t, []string{"CGK", "HLP"}, places[0].Airports)
+
+	// JKT covers the flights from both CGK and HLP.
+	searchID := h.Search(t, oneWay("JKT", "DPS", "2025-07-10", 1))
+	result, _ := finalResult(t, stream(t, h, searchID))
+	assert.Equal(t, contract.StatusCompleted, result.Status)
+	var ids []string
+	origins := make(map[string]bool)
+	for _, f := range result.Results {
+		ids = append(ids, f.ID)
+		origins[f.From] = true
+	}
+	assert.ElementsMatch(t, []string{"garuda:id-1", "garuda:ga-1", "garuda:ga-2"}, ids)
+	assert.Equal(t, map[string]bool{"CGK": true, "HLP": true}, origins)
+}
@@ -0,0 +1,216 @@
+package e2e_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/contract"
+	"example.com/e2e"
+	mainservice "example.com/main-service/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var flights = []contract.Flight{
+	{ID: "ga-1", Airline: "Garuda Indonesia", FlightNumber: "GA123", From: "CGK", To: "DPS", DepartureTime: "2025-07-10 14:00", ArrivalTime: "2025-07-10 17:00", Price: 1000000, Currency: "IDR", Available: true, Seats: contract.SeatInventory{Economy: 120, Business: 12}},
+	{ID: "ga-2", Airline: "Garuda Indonesia", FlightNumber: "GA456", From: "CGK", To: "DPS", DepartureTime: "2025-07-10 20:00", ArrivalTime: "2025-07-10 23:00", Price: 900000, Currency: "IDR", Available: true, Seats: contract.SeatInventory{Economy: 1}},
+	{ID: "ga-3", Airline: "Garuda Indonesia", FlightNumber: "GA789", From: "CGK", To: "SUB", DepartureTime: "2025-07-11 08:00", ArrivalTime: "2025-07-11 09:30", Price: 600000, Currency: "IDR", Available: true, Seats: contract.SeatInventory{Economy: 50}},
+}
+
+func oneWay(from, to, date string, passengers int) map[string]interface{} {
+	return map[string]interface{}{
+		"from":       from,
+		"to":         to,
+		"date":       date,
+		"passengers": passengers,
+	}
+}
+
+// stream follows the result stream of searchID with a deadline.
+func stream(t *testing.T, h *e2e.Harness, searchID string) []e2e.Event {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events, err := h.Stream(ctx, searchID)
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	return events
+}
+
+// finalResult returns the result a completed stream ends with: the last
+// result event, followed by the summary.
+func finalResult(t *testing.T, events []e2e.Event) (e2e.Result, e2e.Summary) {
+	t.Helper()
+	require.GreaterOrEqual(t, len(events), 2, "events: %v", events)
+	last, final := events[len(events)-1], events[len(events)-2]
+	require.Equal(t, "summary", last.Event, "events: %v", events)
+	require.Equal(t, "result", final.Event)
+
+	var summary e2e.Summary
+	require.NoError(t, last.Decode(&summary))
+	var result e2e.Result
+	require.NoError(t, final.Decode(&result))
+	return result, summary
+}
+
+func TestSearchFound(t *testing.T) {
+	h := e2e.Start(t, e2e.Options{
+		Providers: map[string][]contract.Flight{"garuda": flights},
+	})
+
+	searchID := h.Search(t, oneWay("CGK", "DPS", "2025-07-10", 2))
+	result, summary := finalResult(t, stream(t, h, searchID))
+	assert.Equal(t, searchID, result.SearchID)
+	assert.Equal(t, contract.StatusCompleted, result.Status)
+	// ga-2 has a single economy seat left.
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, "garuda:ga-1", result.Results[0].ID)
+	assert.Equal(t, float64(2000000), result.Results[0].Price)
+	assert.Equal(t, e2e.Summary{
+		SearchID:        searchID,
+		Status:          contract.StatusCompleted,
+		TotalResults:    1,
+		FailedProviders: []string{},
+	}, summary)
+
+	// Following the search again answers from its recorded state.
+	result, _ = finalResult(t, stream(t, h, searchID))
+	assert.Equal(t, contract.StatusCompleted, result.Status)
+	assert.Len(t, result.Results, 1)
+}
+
+func TestSearchNotFound(t *testing.T) {
+	h := e2e.Start(t, e2e.Options{
+		Providers: map[string][]contract.Flight{"garuda": flights},
+	})
+
+	searchID := h.Search(t, oneWay("CGK", "SUB", "2025-07-12", 1))
+	result, summary := finalResult(t, stream(t, h, searchID))
+	assert.Equal(t, contract.StatusNotFound, result.Status)
+	assert.Empty(t, result.Results)
+	assert.Equal(t, contract.StatusNotFound, summary.Status)
+	assert.Zero(t, summary.TotalResults)
+}
+
+func TestSearchTimeout(t *testing.T) {
+	shortDeadlines := func(cfg *mainservice.Config) {
+		cfg.Search.Deadline = time.Second
+		cfg.Search.ProviderDeadline = 500 * time.Millisecond
+	}
+
+	t.Run("provider", func(t *testing.T) {
+		// lion never answers; the search completes without it once the
+		// provider deadline passes.
+		h := e2e.Start(t, e2e.Options{
+			Providers: map[string][]contract.Flight{"garuda": flights},
+			Expected:  []string{"garuda", "lion"},
+			Configure: shortDeadlines,
+		})
+
+		start := time.Now()
+		searchID := h.Search(t, oneWay("CGK", "DPS", "2025-07-10", 1))
+		events := stream(t, h, searchID)
+		assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+
+		// The search is still waiting for lion when the client connects:
+		// garuda's own answer comes first, then the aggregated result.
+		require.Len(t, events, 3)
+		var partial e2e.Result
+		require.NoError(t, events[0].Decode(&partial))
+		assert.Equal(t, "partial", partial.Status)
+		assert.Equal(t, "garuda", partial.ProviderID)
+		assert.Equal(t, contract.StatusCompleted, partial.ProviderStatus)
+		assert.NotEmpty(t, events[0].ID)
+
+		result, summary := finalResult(t, events)
+		assert.Equal(t, contract.StatusCompleted, result.Status)
+		assert.Len(t, result.Results, 2)
+		assert.Equal(t, []string{"lion"}, summary.FailedProviders)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		// No provider answers at all: the search expires at its deadline.
+		h := e2e.Start(t, e2e.Options{
+			Expected:  []string{"garuda"},
+			Configure: shortDeadlines,
+		})
+
+		searchID := h.Search(t, oneWay("CGK", "DPS", "2025-07-10", 1))
+		events := stream(t, h, searchID)
+		require.Len(t, events, 1)
+		assert.Equal(t, "timeout", events[0].Event)
+
+		var payload struct {
+			SearchID string `json:"search_id"`
+			Status   string `json:"status"`
+		}
+		require.NoError(t, events[0].Decode(&payload))
+		assert.Equal(t, searchID, payload.SearchID)
+		assert.Equal(t, "expired", payload.Status)
+	})
+}
+
+func TestConcurrentClients(t *testing.T) {
+	h := e2e.Start(t, e2e.Options{
+		Providers: map[string][]contract.Flight{
+			"garuda": flights,
+			"lion":   flights[:1],
+		},
+	})
+
+	const (
+		searches         = 10
+		clientsPerSearch = 3
+	)
+	dates := []string{"2025-07-10", "2025-07-11"}
+
+	// The clients only collect their streams; require may not be called
+	// from their goroutines, so the streams are checked once all have ended.
+	type client struct {
+		searchID string
+		date     string
+		events   []e2e.Event
+		err      error
+	}
+	clients := make([]client, 0, searches*clientsPerSearch)
+	for i := 0; i < searches; i++ {
+		date := dates[i%len(dates)]
+		searchID := h.Search(t, oneWay("CGK", "DPS", date, 1))
+		for j := 0; j < clientsPerSearch; j++ {
+			clients = append(clients, client{searchID: searchID, date: date})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(c *client) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			c.events, c.err = h.Stream(ctx, c.searchID)
+		}(&clients[i])
+	}
+	wg.Wait()
+
+	for _, c := range clients {
+		require.NoError(t, c.err)
+		result, summary := finalResult(t, c.events)
+		assert.Equal(t, c.searchID, result.SearchID)
+		if c.date == "2025-07-10" {
+			// Both providers serve ga-1, which keeps them apart; garuda
+			// also serves ga-2.
+			assert.Equal(t, contract.StatusCompleted, summary.Status)
+			assert.Equal(t, 3, summary.TotalResults)
+			var ids []string
+			for _, f := range result.Results {
+				ids = append(ids, f.ID)
+			}
+			assert.ElementsMatch(t, []string{"garuda:ga-1", "garuda:ga-2", "lion:ga-1"}, ids)
+		} else {
+			assert.Equal(t, contract.StatusNotFound, summary.Status)
+		}
+	}
+}
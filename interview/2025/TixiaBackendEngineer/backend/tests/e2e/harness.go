@@ -0,0 +1,244 @@
+// Package e2e runs main-service and provider-service in one process to test
+// the search flow end to end: a search is posted over HTTP, answered by the
+// provider consumers and streamed back over SSE.
+//
+// The services exchange their messages over an in-memory bus; the search
+// state main-service keeps in Redis lives in miniredis.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"example.com/bus"
+	"example.com/contract"
+	mainservice "example.com/main-service/service"
+	providerservice "example.com/provider-service/service"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// Options sets up a Harness.
+type Options struct {
+	// Providers are the provider-service instances to run, by provider ID,
+	// with the flights each of them serves.
+	Providers map[string][]contract.Flight
+	// Expected are the provider IDs main-service waits for; all of
+	// Providers by default. Listing one that does not run makes searches
+	// wait for it until the provider deadline.
+	Expected []string
+	// Configure adjusts the config of main-service before it starts.
+	Configure func(cfg *mainservice.Config)
+	// Log receives the logs of both services; discarded by default.
+	Log *zap.Logger
+}
+
+// Harness is a running main-service and its providers.
+type Harness struct {
+	// URL is the base URL of main-service.
+	URL    string
+	Bus    *bus.Memory
+	Redis  *miniredis.Miniredis
+	Client *http.Client
+}
+
+// Start runs main-service and the providers of opts until the test ends.
+func Start(t testing.TB, opts Options) *Harness {
+	t.Helper()
+	log := opts.Log
+	if log == nil {
+		log = zap.NewNop()
+	}
+
+	h := &Harness{
+		Bus:    bus.NewMemory(),
+		Redis:  miniredis.RunT(t),
+		Client: &http.Client{},
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: h.Redis.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	// Providers first: their consumer groups only receive the searches
+	// published after they were created.
+	ids := make([]string, 0, len(opts.Providers))
+	for id, flights := range opts.Providers {
+		ids = append(ids, id)
+		startProvider(t, h.Bus, id, flights, log)
+	}
+	sort.Strings(ids)
+
+	cfg := mainservice.DefaultConfig()
+	cfg.Service.Prefork = false
+	cfg.Service.DrainDelay = 0
+	cfg.Auth.RequireAPIKey = false
+	cfg.Redis.Addr = h.Redis.Addr()
+	cfg.Streams.JanitorInterval = 0
+	cfg.Search.Deadline = 5 * time.Second
+	cfg.Search.ProviderDeadline = 3 * time.Second
+	cfg.Search.CacheTTL = 0
+	cfg.Search.Providers = ids
+	if opts.Expected != nil {
+		cfg.Search.Providers = opts.Expected
+	}
+	if opts.Configure != nil {
+		opts.Configure(&cfg)
+	}
+	require.NoError(t, cfg.Validate())
+
+	srv := mainservice.New(&cfg, rdb, h.Bus, log.With(zap.String("service", mainservice.Name)))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv.Start()
+	go func() { _ = srv.App.Listener(ln) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+		srv.Stop()
+	})
+	h.URL = "http://" + ln.Addr().String()
+
+	require.Eventually(t, func() bool {
+		resp, err := h.Client.Get(h.URL + "/readyz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 20*time.Millisecond, "main-service did not become ready")
+	return h
+}
+
+// startProvider runs a provider-service consumer serving flights.
+func startProvider(t testing.TB, b bus.IBus, id string, flights []contract.Flight, log *zap.Logger) {
+	t.Helper()
+	data, err := json.Marshal(flights)
+	require.NoError(t, err)
+	sampleFile := filepath.Join(t.TempDir(), id+".json")
+	require.NoError(t, os.WriteFile(sampleFile, data, 0o600))
+
+	cfg := providerservice.DefaultConfig()
+	cfg.Provider.ID = id
+	cfg.Provider.SampleFile = sampleFile
+	require.NoError(t, cfg.Validate())
+
+	consumer := providerservice.New(&cfg, b, log.With(zap.String("service", providerservice.Name)))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = consumer.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	require.Eventually(t, func() bool {
+		return consumer.Ready(ctx, time.Minute) == nil
+	}, 5*time.Second, 10*time.Millisecond, "provider %s did not become ready", id)
+}
+
+// AddAPIKey stores an API key the way main-service looks keys up, under
+// the SHA-256 of the key.
+func (h *Harness) AddAPIKey(t testing.TB, key, plan string, admin bool) {
+	t.Helper()
+	sum := sha256.Sum256([]byte(key))
+	fields := []string{"name", key, "plan", plan}
+	if admin {
+		fields = append(fields, "admin", "1")
+	}
+	h.Redis.HSet("flight.apikey:"+hex.EncodeToString(sum[:]), fields...)
+}
+
+// Get sends a GET request to path with apiKey, when not empty, and decodes
+// the data of the response into data. It returns the status code.
+func (h *Harness) Get(t testing.TB, path, apiKey string, data interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, h.URL+path, nil)
+	require.NoError(t, err)
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	resp, err := h.Client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	out := struct {
+		Data interface{} `json:"data"`
+	}{Data: data}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	return resp.StatusCode
+}
+
+// Search posts a search and returns its ID.
+func (h *Harness) Search(t testing.TB, body map[string]interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	resp, err := h.Client.Post(h.URL+"/api/v1/flights/search", "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var out struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		Data    struct {
+			SearchID string `json:"search_id"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	require.True(t, out.Success, "search failed with %d: %s", resp.StatusCode, out.Message)
+	require.NotEmpty(t, out.Data.SearchID)
+	return out.Data.SearchID
+}
+
+// Stream follows the result stream of searchID until the server ends it or
+// ctx is done, and returns the events received.
+func (h *Harness) Stream(ctx context.Context, searchID string) ([]Event, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL+"/api/v1/flights/search/"+searchID+"/stream", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stream answered %d", resp.StatusCode)
+	}
+	return NewSSEReader(resp.Body).All()
+}
+
+// Result is the payload of result, error and cancelled events.
+type Result struct {
+	SearchID        string            `json:"search_id"`
+	Status          string            `json:"status"`
+	ProviderID      string            `json:"provider_id"`
+	ProviderStatus  string            `json:"provider_status"`
+	FailedProviders []string          `json:"failed_providers"`
+	Results         []contract.Flight `json:"results"`
+}
+
+// Summary is the payload of the summary event ending a completed search.
+type Summary struct {
+	SearchID        string   `json:"search_id"`
+	Status          string   `json:"status"`
+	TotalResults    int      `json:"total_results"`
+	FailedProviders []string `json:"failed_providers"`
+}
@@ -0,0 +1,95 @@
+package e2e
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one server-sent event.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	// Retry is the reconnection delay the event asks for, if any.
+	Retry time.Duration
+}
+
+// Decode unmarshals the JSON data of the event into v.
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(e.Data), v)
+}
+
+// SSEReader parses the events of a text/event-stream body.
+type SSEReader struct {
+	sc *bufio.Scanner
+}
+
+func NewSSEReader(r io.Reader) *SSEReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return &SSEReader{sc: sc}
+}
+
+// Next returns the next event. Comments, such as heartbeats, and a lone
+// retry field are skipped. At the end of the stream it returns io.EOF.
+func (r *SSEReader) Next() (Event, error) {
+	var (
+		ev   Event
+		data []string
+		seen bool
+	)
+	for r.sc.Scan() {
+		line := r.sc.Text()
+		if line == "" {
+			if seen && (ev.Event != "" || data != nil) {
+				ev.Data = strings.Join(data, "\n")
+				return ev, nil
+			}
+			ev, data, seen = Event{}, nil, false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		seen = true
+		switch field {
+		case "id":
+			ev.ID = value
+		case "event":
+			ev.Event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				ev.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := r.sc.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+// All reads the events until the end of the stream.
+func (r *SSEReader) All() ([]Event, error) {
+	var events []Event
+	for {
+		ev, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
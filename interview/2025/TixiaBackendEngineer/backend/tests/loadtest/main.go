@@ -0,0 +1,155 @@
+// Command loadtest fires concurrent flight searches at main-service, follows
+// each of them over SSE and reports how long the pipeline took to answer:
+//
+//	go run . -url http://localhost:8080 -api-key demo-key -n 500 -c 50 -rate 20
+//
+// While it runs, it prints its progress and the backlog of the request
+// stream, read from Redis, every -sample interval.
+//
+// main-service limits the requests of every IP and API key; raise
+// MAIN_IP_RATE_LIMIT and use a key on a large enough plan, or the searches
+// it rejects are reported as errors.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"example.com/contract"
+	"github.com/redis/go-redis/v9"
+)
+
+type options struct {
+	URL         string
+	APIKey      string
+	Searches    int
+	Concurrency int
+	// Rate is the number of searches started per second; 0 starts them as
+	// fast as Concurrency allows.
+	Rate        float64
+	Timeout     time.Duration
+	BypassCache bool
+	Search      searchBody
+
+	// RedisAddr is where the backlog of Stream is read; empty skips it.
+	RedisAddr string
+	Stream    string
+	Sample    time.Duration
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.URL, "url", "http://localhost:8080", "Base URL of main-service")
+	flag.StringVar(&opts.APIKey, "api-key", os.Getenv("LOADTEST_API_KEY"), "API key sent with every request; defaults to $LOADTEST_API_KEY")
+	flag.IntVar(&opts.Searches, "n", 100, "Number of searches")
+	flag.IntVar(&opts.Concurrency, "c", 10, "Maximum number of searches in flight")
+	flag.Float64Var(&opts.Rate, "rate", 0, "Searches started per second; 0 starts them as fast as -c allows")
+	flag.DurationVar(&opts.Timeout, "timeout", 45*time.Second, "Time a search may take, from submitting it to its final event")
+	flag.BoolVar(&opts.BypassCache, "bypass-cache", true, "Skip the result cache of main-service, so every search reaches the providers")
+	flag.StringVar(&opts.Search.From, "from", "CGK", "Origin airport")
+	flag.StringVar(&opts.Search.To, "to", "DPS", "Destination airport")
+	flag.StringVar(&opts.Search.Date, "date", "2025-07-10", "Departure date, YYYY-MM-DD")
+	flag.IntVar(&opts.Search.Passengers, "passengers", 1, "Number of passengers")
+	flag.StringVar(&opts.Search.CabinClass, "cabin", "economy", "Cabin class")
+	flag.StringVar(&opts.RedisAddr, "redis", "localhost:6379", "Redis address to read the stream backlog from; empty skips it")
+	flag.StringVar(&opts.Stream, "stream", contract.StreamSearchRequested, "Stream of the search requests")
+	flag.DurationVar(&opts.Sample, "sample", time.Second, "Interval of the progress and backlog lines")
+	flag.Parse()
+
+	if opts.Searches <= 0 || opts.Concurrency <= 0 || opts.Rate < 0 || opts.Timeout <= 0 || opts.Sample <= 0 {
+		log.Fatal("-n, -c, -timeout and -sample must be positive and -rate must not be negative")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := &searchClient{
+		http:        &http.Client{},
+		baseURL:     opts.URL,
+		apiKey:      opts.APIKey,
+		body:        opts.Search,
+		bypassCache: opts.BypassCache,
+		timeout:     opts.Timeout,
+	}
+
+	var rdb *redis.Client
+	if opts.RedisAddr != "" {
+		rdb = redis.NewClient(&redis.Options{Addr: opts.RedisAddr})
+		defer rdb.Close()
+	}
+	mon := newMonitor(rdb, opts.Stream)
+	monCtx, stopMonitor := context.WithCancel(context.Background())
+	monDone := make(chan struct{})
+	go func() {
+		defer close(monDone)
+		mon.Run(monCtx, os.Stderr, opts.Sample)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Running %d searches against %s, %d at a time", opts.Searches, opts.URL, opts.Concurrency)
+	if opts.Rate > 0 {
+		fmt.Fprintf(os.Stderr, ", %g per second", opts.Rate)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	started := time.Now()
+	outcomes := run(ctx, opts, client, mon)
+	elapsed := time.Since(started)
+
+	stopMonitor()
+	<-monDone
+	newReport(outcomes, elapsed, mon.Backlog()).Print(os.Stdout)
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Interrupted; the report covers the searches started before.")
+	}
+}
+
+// run starts opts.Searches searches, paced by opts.Rate and opts.Concurrency,
+// and returns their outcomes once they have all ended. When ctx is done no
+// more searches are started and the ones in flight are abandoned.
+func run(ctx context.Context, opts options, client *searchClient, mon *monitor) []outcome {
+	var tick <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	outcomes := make([]outcome, opts.Searches)
+	slots := make(chan struct{}, opts.Concurrency)
+	done := make(chan struct{})
+	started := 0
+	for ; started < opts.Searches; started++ {
+		if tick != nil && started > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+			}
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		mon.Started()
+		go func(i int) {
+			defer func() { done <- struct{}{} }()
+			outcomes[i] = client.Search(ctx)
+			mon.Finished(outcomes[i])
+			<-slots
+		}(started)
+	}
+	for i := 0; i < started; i++ {
+		<-done
+	}
+	return outcomes[:started]
+}
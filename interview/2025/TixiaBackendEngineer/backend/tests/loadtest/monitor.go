@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const backlogTimeout = 2 * time.Second
+
+// backlogSample is the backlog of a consumer group of the request stream.
+type backlogSample struct {
+	// Pending were delivered to a consumer and not acknowledged yet.
+	Pending int64
+	// Lag were not delivered yet; -1 when Redis cannot tell, as before
+	// Redis 7.
+	Lag int64
+}
+
+// Total is the number of requests the group has not answered yet.
+func (s backlogSample) Total() int64 {
+	if s.Lag < 0 {
+		return s.Pending
+	}
+	return s.Pending + s.Lag
+}
+
+func (s backlogSample) String() string {
+	lag := "?"
+	if s.Lag >= 0 {
+		lag = fmt.Sprint(s.Lag)
+	}
+	return fmt.Sprintf("%d (pending %d, lag %s)", s.Total(), s.Pending, lag)
+}
+
+// groupBacklog is the backlog of a consumer group over the run.
+type groupBacklog struct {
+	Group string
+	Peak  backlogSample
+	Last  backlogSample
+}
+
+// monitor counts the searches of the run and samples the backlog of the
+// request stream while they run.
+type monitor struct {
+	rdb    *redis.Client
+	stream string
+
+	started  atomic.Int64
+	finished atomic.Int64
+	errors   atomic.Int64
+	timeouts atomic.Int64
+
+	mu      sync.Mutex
+	backlog map[string]*groupBacklog
+}
+
+// newMonitor creates a monitor; a nil rdb skips the backlog.
+func newMonitor(rdb *redis.Client, stream string) *monitor {
+	return &monitor{
+		rdb:     rdb,
+		stream:  stream,
+		backlog: make(map[string]*groupBacklog),
+	}
+}
+
+func (m *monitor) Started() {
+	m.started.Add(1)
+}
+
+func (m *monitor) Finished(o outcome) {
+	m.finished.Add(1)
+	switch {
+	case o.Err != nil:
+		m.errors.Add(1)
+	case o.TimedOut:
+		m.timeouts.Add(1)
+	}
+}
+
+// Run writes a progress line to w every interval until ctx is done, and a
+// last one then.
+func (m *monitor) Run(ctx context.Context, w io.Writer, interval time.Duration) {
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			m.progress(w, time.Since(start))
+			return
+		case <-ticker.C:
+			m.progress(w, time.Since(start))
+		}
+	}
+}
+
+func (m *monitor) progress(w io.Writer, elapsed time.Duration) {
+	line := fmt.Sprintf("[%6s] started %d, finished %d, errors %d, timeouts %d",
+		elapsed.Round(time.Second), m.started.Load(), m.finished.Load(), m.errors.Load(), m.timeouts.Load())
+
+	if m.rdb != nil {
+		samples, err := m.sample()
+		switch {
+		case err != nil:
+			line += " | backlog: " + err.Error()
+		case len(samples) == 0:
+			line += " | backlog: no consumer groups"
+		default:
+			groups := make([]string, 0, len(samples))
+			for group, s := range samples {
+				groups = append(groups, fmt.Sprintf("%s %s", group, s))
+			}
+			sort.Strings(groups)
+			line += " | backlog " + strings.Join(groups, ", ")
+		}
+	}
+	fmt.Fprintln(w, line)
+}
+
+// sample reads the backlog of every consumer group of the request stream
+// and records it.
+func (m *monitor) sample() (map[string]backlogSample, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backlogTimeout)
+	defer cancel()
+	groups, err := m.rdb.XInfoGroups(ctx, m.stream).Result()
+	if err != nil {
+		// Streams are only created by their first entry or group.
+		if strings.Contains(err.Error(), "no such key") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	samples := make(map[string]backlogSample, len(groups))
+	for _, g := range groups {
+		s := backlogSample{Pending: g.Pending, Lag: g.Lag}
+		samples[g.Name] = s
+
+		b, ok := m.backlog[g.Name]
+		if !ok {
+			b = &groupBacklog{Group: g.Name}
+			m.backlog[g.Name] = b
+		}
+		if s.Total() > b.Peak.Total() {
+			b.Peak = s
+		}
+		b.Last = s
+	}
+	return samples, nil
+}
+
+// Backlog returns the backlog sampled over the run, by group.
+func (m *monitor) Backlog() []groupBacklog {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	backlog := make([]groupBacklog, 0, len(m.backlog))
+	for _, b := range m.backlog {
+		backlog = append(backlog, *b)
+	}
+	sort.Slice(backlog, func(i, j int) bool { return backlog[i].Group < backlog[j].Group })
+	return backlog
+}
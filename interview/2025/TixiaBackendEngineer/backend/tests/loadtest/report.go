@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// percentiles reported for every latency.
+var percentiles = []float64{50, 90, 95, 99}
+
+// maxErrorKinds bounds the distinct errors listed in a report.
+const maxErrorKinds = 10
+
+type latency struct {
+	Name    string
+	Samples []time.Duration
+}
+
+type errorCount struct {
+	Message string
+	Count   int
+}
+
+type report struct {
+	Searches int
+	Elapsed  time.Duration
+	// Statuses counts the searches by final status.
+	Statuses  map[string]int
+	Errors    int
+	Timeouts  int
+	Latencies []latency
+	// ErrorKinds counts the errors by message, most frequent first.
+	ErrorKinds []errorCount
+	Backlog    []groupBacklog
+}
+
+func newReport(outcomes []outcome, elapsed time.Duration, backlog []groupBacklog) report {
+	r := report{
+		Searches: len(outcomes),
+		Elapsed:  elapsed,
+		Statuses: make(map[string]int),
+		Backlog:  backlog,
+	}
+	accept := latency{Name: "accept"}
+	first := latency{Name: "first result"}
+	completed := latency{Name: "completed"}
+	errs := make(map[string]int)
+	for _, o := range outcomes {
+		if o.Accepted > 0 {
+			accept.Samples = append(accept.Samples, o.Accepted)
+		}
+		if o.FirstResult > 0 {
+			first.Samples = append(first.Samples, o.FirstResult)
+		}
+		if o.Completed > 0 {
+			completed.Samples = append(completed.Samples, o.Completed)
+		}
+		if o.Status != "" {
+			r.Statuses[o.Status]++
+		}
+		switch {
+		case o.Err != nil:
+			r.Errors++
+			errs[o.Err.Error()]++
+		case o.TimedOut:
+			r.Timeouts++
+		}
+	}
+	r.Latencies = []latency{accept, first, completed}
+
+	for msg, n := range errs {
+		r.ErrorKinds = append(r.ErrorKinds, errorCount{Message: msg, Count: n})
+	}
+	sort.Slice(r.ErrorKinds, func(i, j int) bool {
+		if r.ErrorKinds[i].Count != r.ErrorKinds[j].Count {
+			return r.ErrorKinds[i].Count > r.ErrorKinds[j].Count
+		}
+		return r.ErrorKinds[i].Message < r.ErrorKinds[j].Message
+	})
+	return r
+}
+
+func (r report) Print(w io.Writer) {
+	rate := 0.0
+	if r.Elapsed > 0 {
+		rate = float64(r.Searches) / r.Elapsed.Seconds()
+	}
+	fmt.Fprintf(w, "\n%d searches in %s (%.1f/s)\n", r.Searches, r.Elapsed.Round(time.Millisecond), rate)
+	for _, status := range []string{statusCompleted, statusNotFound, statusFailed, statusCancelled} {
+		fmt.Fprintf(w, "  %-10s %d\n", status, r.Statuses[status])
+	}
+	fmt.Fprintf(w, "  %-10s %d\n", "timeouts", r.Timeouts)
+	fmt.Fprintf(w, "  %-10s %d\n", "errors", r.Errors)
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "latency\tcount\t")
+	for _, p := range percentiles {
+		fmt.Fprintf(tw, "p%g\t", p)
+	}
+	fmt.Fprint(tw, "max\t\n")
+	for _, l := range r.Latencies {
+		sorted := append([]time.Duration(nil), l.Samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		fmt.Fprintf(tw, "%s\t%d\t", l.Name, len(sorted))
+		for _, p := range percentiles {
+			fmt.Fprintf(tw, "%s\t", formatLatency(sorted, p))
+		}
+		fmt.Fprintf(tw, "%s\t\n", formatLatency(sorted, 100))
+	}
+	tw.Flush()
+
+	if len(r.Backlog) > 0 {
+		fmt.Fprintln(w, "\nrequest stream backlog")
+		for _, b := range r.Backlog {
+			fmt.Fprintf(w, "  %s: peak %s, last %s\n", b.Group, b.Peak, b.Last)
+		}
+	}
+
+	if len(r.ErrorKinds) > 0 {
+		fmt.Fprintln(w, "\nerrors")
+		for i, e := range r.ErrorKinds {
+			if i == maxErrorKinds {
+				fmt.Fprintf(w, "  ... and %d more kinds\n", len(r.ErrorKinds)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %6d  %s\n", e.Count, e.Message)
+		}
+	}
+}
+
+func formatLatency(sorted []time.Duration, p float64) string {
+	if len(sorted) == 0 {
+		return "-"
+	}
+	return percentile(sorted, p).Round(time.Millisecond).String()
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted, which must
+// not be empty.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
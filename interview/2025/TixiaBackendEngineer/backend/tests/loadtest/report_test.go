@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	assert.Equal(t, 50*time.Millisecond, percentile(sorted, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(sorted, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(sorted, 100))
+	assert.Equal(t, time.Millisecond, percentile(sorted, 0))
+	assert.Equal(t, 7*time.Millisecond, percentile([]time.Duration{7 * time.Millisecond}, 95))
+}
+
+func TestNewReport(t *testing.T) {
+	limited := errors.New("search answered 429: Too many requests")
+	r := newReport([]outcome{
+		{Accepted: time.Millisecond, FirstResult: 10 * time.Millisecond, Completed: 20 * time.Millisecond, Status: statusCompleted},
+		{Accepted: time.Millisecond, FirstResult: 10 * time.Millisecond, Completed: 15 * time.Millisecond, Status: statusNotFound},
+		{Accepted: time.Millisecond, Status: statusExpired, TimedOut: true},
+		{Accepted: time.Millisecond, TimedOut: true},
+		{Err: limited},
+		{Err: limited},
+		{Accepted: time.Millisecond, Err: errors.New("stream answered 404")},
+	}, time.Second, nil)
+
+	assert.Equal(t, 7, r.Searches)
+	assert.Equal(t, map[string]int{statusCompleted: 1, statusNotFound: 1, statusExpired: 1}, r.Statuses)
+	assert.Equal(t, 2, r.Timeouts)
+	assert.Equal(t, 3, r.Errors)
+	assert.Equal(t, []errorCount{
+		{Message: limited.Error(), Count: 2},
+		{Message: "stream answered 404", Count: 1},
+	}, r.ErrorKinds)
+
+	counts := make(map[string]int)
+	for _, l := range r.Latencies {
+		counts[l.Name] = len(l.Samples)
+	}
+	assert.Equal(t, map[string]int{"accept": 5, "first result": 2, "completed": 2}, counts)
+}
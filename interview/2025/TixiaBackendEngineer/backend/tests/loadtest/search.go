@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Final statuses of a search, as carried by its last event.
+const (
+	statusCompleted = "completed"
+	statusNotFound  = "not_found"
+	statusFailed    = "failed"
+	statusCancelled = "cancelled"
+	statusExpired   = "expired"
+)
+
+// maxReconnects bounds the reconnections of a stream drained by a
+// main-service that shuts down.
+const maxReconnects = 5
+
+type searchBody struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Date       string `json:"date"`
+	Passengers int    `json:"passengers"`
+	CabinClass string `json:"cabin_class"`
+}
+
+// outcome is what happened to one search. Durations are measured from the
+// moment the search was submitted and are zero when not reached.
+type outcome struct {
+	Accepted    time.Duration
+	FirstResult time.Duration
+	Completed   time.Duration
+	// Status is the final status of the search, empty if none arrived.
+	Status string
+	// TimedOut is set when the search expired on main-service or did not
+	// end within the timeout of the client.
+	TimedOut bool
+	Err      error
+}
+
+type searchClient struct {
+	http        *http.Client
+	baseURL     string
+	apiKey      string
+	body        searchBody
+	bypassCache bool
+	timeout     time.Duration
+}
+
+// Search submits a search and follows its stream to the final event.
+func (c *searchClient) Search(ctx context.Context) outcome {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var o outcome
+	start := time.Now()
+	searchID, err := c.submit(ctx)
+	if err != nil {
+		return c.failed(ctx, o, err)
+	}
+	o.Accepted = time.Since(start)
+
+	lastEventID := ""
+	for reconnects := 0; ; reconnects++ {
+		retry, err := c.follow(ctx, searchID, &lastEventID, start, &o)
+		if err != nil {
+			return c.failed(ctx, o, err)
+		}
+		if retry < 0 {
+			return o
+		}
+		if reconnects == maxReconnects {
+			o.Err = errors.New("stream still draining after reconnecting")
+			return o
+		}
+		select {
+		case <-time.After(retry):
+		case <-ctx.Done():
+			return c.failed(ctx, o, ctx.Err())
+		}
+	}
+}
+
+// failed records err in o, telling the timeout of the search apart.
+func (c *searchClient) failed(ctx context.Context, o outcome, err error) outcome {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		o.TimedOut = true
+		return o
+	}
+	o.Err = err
+	return o
+}
+
+func (c *searchClient) submit(ctx context.Context) (string, error) {
+	data, err := json.Marshal(c.body)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/flights/search", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.bypassCache {
+		req.Header.Set("X-Cache-Bypass", "1")
+	}
+	c.authorize(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Message string `json:"message"`
+		Data    struct {
+			SearchID string `json:"search_id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("decode search response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("search answered %d: %s", resp.StatusCode, out.Message)
+	}
+	if out.Data.SearchID == "" {
+		return "", errors.New("search answered without a search_id")
+	}
+	return out.Data.SearchID, nil
+}
+
+// follow reads the stream of searchID into o until its final event, and
+// returns the delay after which to reconnect, or -1 once the search ended.
+func (c *searchClient) follow(ctx context.Context, searchID string, lastEventID *string, start time.Time, o *outcome) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/flights/search/"+searchID+"/stream", nil)
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastEventID != "" {
+		req.Header.Set("Last-Event-ID", *lastEventID)
+	}
+	c.authorize(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		// Only answered to a resumed stream whose final event was sent.
+		return -1, nil
+	default:
+		return -1, fmt.Errorf("stream answered %d", resp.StatusCode)
+	}
+
+	events := newSSEReader(resp.Body)
+	for {
+		ev, err := events.Next()
+		if errors.Is(err, io.EOF) {
+			return -1, errors.New("stream ended before the search did")
+		}
+		if err != nil {
+			return -1, err
+		}
+		if ev.ID != "" {
+			*lastEventID = ev.ID
+		}
+
+		var payload struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		}
+		if ev.Data != "" {
+			if err := json.Unmarshal([]byte(ev.Data), &payload); err != nil {
+				return -1, fmt.Errorf("decode %s event: %w", ev.Event, err)
+			}
+		}
+
+		switch ev.Event {
+		case "result":
+			if o.FirstResult == 0 {
+				o.FirstResult = time.Since(start)
+			}
+			if payload.Status == statusCompleted || payload.Status == statusNotFound {
+				o.Completed = time.Since(start)
+				o.Status = payload.Status
+				return -1, nil
+			}
+		case "error":
+			if payload.Status != statusFailed {
+				return -1, fmt.Errorf("stream error: %s", payload.Message)
+			}
+			o.Completed = time.Since(start)
+			o.Status = payload.Status
+			return -1, nil
+		case "cancelled":
+			o.Completed = time.Since(start)
+			o.Status = statusCancelled
+			return -1, nil
+		case "timeout":
+			o.Status = statusExpired
+			o.TimedOut = true
+			return -1, nil
+		case "reconnect":
+			return ev.Retry, nil
+		}
+	}
+}
+
+func (c *searchClient) authorize(req *http.Request) {
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+}
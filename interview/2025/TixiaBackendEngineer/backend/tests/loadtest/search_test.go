@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch_FollowsStreamAcrossReconnect(t *testing.T) {
+	var streams atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/flights/search", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "demo-key", r.Header.Get("X-API-Key"))
+		assert.NotEmpty(t, r.Header.Get("X-Cache-Bypass"))
+		fmt.Fprint(w, `{"success":true,"data":{"search_id":"s1"}}`)
+	})
+	mux.HandleFunc("GET /api/v1/flights/search/s1/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if streams.Add(1) == 1 {
+			fmt.Fprint(w, "retry: 3000\n\n:heartbeat\n\n")
+			fmt.Fprint(w, "id: 1-0\nevent: result\ndata: {\"status\":\"partial\",\"provider_id\":\"garuda\"}\n\n")
+			fmt.Fprint(w, "retry: 10\nevent: reconnect\ndata: {\"message\":\"server shutting down\"}\n\n")
+			return
+		}
+		assert.Equal(t, "1-0", r.Header.Get("Last-Event-ID"))
+		fmt.Fprint(w, "id: 2-0\nevent: result\ndata: {\"status\":\"completed\"}\n\n")
+		fmt.Fprint(w, "id: 2-0\nevent: summary\ndata: {\"status\":\"completed\"}\n\n")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := &searchClient{
+		http:        srv.Client(),
+		baseURL:     srv.URL,
+		apiKey:      "demo-key",
+		bypassCache: true,
+		timeout:     5 * time.Second,
+	}
+	o := client.Search(context.Background())
+
+	require.NoError(t, o.Err)
+	assert.Equal(t, statusCompleted, o.Status)
+	assert.False(t, o.TimedOut)
+	assert.Positive(t, o.Accepted)
+	assert.GreaterOrEqual(t, o.FirstResult, o.Accepted)
+	assert.GreaterOrEqual(t, o.Completed, o.FirstResult)
+	assert.Equal(t, int32(2), streams.Load())
+}
+
+func TestSearch_ReportsRejectedSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"success":false,"message":"Too many requests"}`)
+	}))
+	defer srv.Close()
+
+	client := &searchClient{http: srv.Client(), baseURL: srv.URL, timeout: 5 * time.Second}
+	o := client.Search(context.Background())
+
+	require.EqualError(t, o.Err, "search answered 429: Too many requests")
+	assert.Zero(t, o.Accepted)
+	assert.Empty(t, o.Status)
+}
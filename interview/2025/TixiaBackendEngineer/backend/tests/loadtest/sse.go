@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseEvent is one server-sent event.
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+	// Retry is the reconnection delay the event asks for, if any.
+	Retry time.Duration
+}
+
+// sseReader parses the events of a text/event-stream body.
+type sseReader struct {
+	sc *bufio.Scanner
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return &sseReader{sc: sc}
+}
+
+// Next returns the next event. Comments, such as heartbeats, and a lone
+// retry field are skipped. At the end of the stream it returns io.EOF.
+func (r *sseReader) Next() (sseEvent, error) {
+	var (
+		ev   sseEvent
+		data []string
+		seen bool
+	)
+	for r.sc.Scan() {
+		line := r.sc.Text()
+		if line == "" {
+			if seen && (ev.Event != "" || data != nil) {
+				ev.Data = strings.Join(data, "\n")
+				return ev, nil
+			}
+			ev, data, seen = sseEvent{}, nil, false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		seen = true
+		switch field {
+		case "id":
+			ev.ID = value
+		case "event":
+			ev.Event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				ev.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := r.sc.Err(); err != nil {
+		return sseEvent{}, err
+	}
+	return sseEvent{}, io.EOF
+}